@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// achievements tracks the achievements of every machine and keeps the
+// progress file up to date with their unlocks
+type achievements struct {
+	mu       sync.Mutex // Serialises the writes of the progress file
+	filename string
+	progress *c8.Progress
+}
+
+// defaultProgressFile returns where unlocks are saved when -progress is
+// not given
+func defaultProgressFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".chip8", "progress.json")
+}
+
+// loadAchievements reads the progress file, if there is one. Nothing is
+// saved when filename is empty.
+func loadAchievements(filename string) (*achievements, error) {
+	a := &achievements{filename: filename, progress: c8.NewProgress()}
+	if filename == "" {
+		return a, nil
+	}
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if a.progress, err = c8.ReadProgress(file); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// track unlocks the achievements of the ROM of a machine, announcing them
+// in the log and on the window if there is one
+func (a *achievements) track(m *c8.Machine) {
+	list := c8.DefaultAchievements.Lookup(m.ROMHash())
+	if len(list) == 0 {
+		return
+	}
+	hash := m.ROMHash()
+	c8.NewTracker(m, list, a.progress.Unlocked(hash), func(achievement *c8.Achievement) {
+		log.Printf("Achievement unlocked: %s, %s", achievement.Title, achievement.Description)
+		if prog != nil {
+			prog.Toast("Achievement unlocked: " + achievement.Title)
+		}
+		a.progress.Unlock(hash, achievement.ID, time.Now())
+		if err := a.save(); err != nil {
+			log.Printf("saving achievements: %v", err)
+		}
+	})
+}
+
+func (a *achievements) save() error {
+	if a.filename == "" {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(a.filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(a.filename)
+	if err != nil {
+		return err
+	}
+	if err := a.progress.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
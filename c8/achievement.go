@@ -0,0 +1,231 @@
+package c8
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Achievement is a goal of a game, reached when its condition holds
+type Achievement struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+
+	// Condition is an Expr, which can be followed by "for N frames" when
+	// it must hold for N frames in a row, such as
+	//
+	//	byte 0x3F0 >= 10 for 3 frames
+	Condition string `json:"condition"`
+
+	expr   *Expr
+	frames int
+}
+
+func (a *Achievement) parse() error {
+	condition, frames := a.Condition, 1
+	fields := strings.Fields(condition)
+	if n := len(fields); n > 3 && fields[n-3] == "for" && (fields[n-1] == "frames" || fields[n-1] == "frame") {
+		var err error
+		if frames, err = strconv.Atoi(fields[n-2]); err != nil || frames < 1 {
+			return fmt.Errorf("achievement %q: invalid number of frames %q", a.ID, fields[n-2])
+		}
+		condition = strings.Join(fields[:n-3], " ")
+	}
+	expr, err := ParseExpr(condition)
+	if err != nil {
+		return fmt.Errorf("achievement %q: %v", a.ID, err)
+	}
+	a.expr, a.frames = expr, frames
+	return nil
+}
+
+// Achievements maps the SHA-1 of ROMs to their achievements. It reads JSON
+// files such as
+//
+//	{
+//		"f13766c14aeb02ad8d4d103cb5eadd282d20cddc": [{
+//			"id": "brix-first-brick",
+//			"title": "Crack",
+//			"description": "Break a brick",
+//			"condition": "V5 > 0"
+//		}]
+//	}
+type Achievements struct {
+	mu   sync.Mutex
+	roms map[string][]*Achievement
+}
+
+// DefaultAchievements has achievements for some of the bundled games and
+// can be extended with Load
+var DefaultAchievements = mustLoadAchievements(builtinAchievements)
+
+// NewAchievements generates a new empty Achievements
+func NewAchievements() *Achievements {
+	return &Achievements{roms: map[string][]*Achievement{}}
+}
+
+func mustLoadAchievements(data string) *Achievements {
+	a := NewAchievements()
+	if err := a.Load(strings.NewReader(data)); err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Load adds the achievements of a JSON file, replacing those of the ROMs it
+// lists
+func (a *Achievements) Load(r io.Reader) error {
+	var roms map[string][]*Achievement
+	if err := json.NewDecoder(r).Decode(&roms); err != nil {
+		return err
+	}
+	for _, achievements := range roms {
+		for _, achievement := range achievements {
+			if err := achievement.parse(); err != nil {
+				return err
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for hash, achievements := range roms {
+		a.roms[strings.ToLower(hash)] = achievements
+	}
+	return nil
+}
+
+// Lookup returns the achievements of a ROM, given its SHA-1 in hex
+func (a *Achievements) Lookup(romHash string) []*Achievement {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.roms[romHash]
+}
+
+// Tracker checks the conditions of achievements at the end of every frame
+// of a machine
+type Tracker struct {
+	mu           sync.Mutex
+	achievements []*Achievement
+	held         []int // Frames in a row the condition of each achievement held
+	unlocked     map[string]bool
+	prev         *View
+	unlock       func(*Achievement)
+}
+
+// NewTracker tracks achievements on a machine, except those whose IDs are
+// already unlocked. unlock is called from the goroutine running the
+// machine, once for every achievement reached.
+func NewTracker(m *Machine, achievements []*Achievement, unlocked []string, unlock func(*Achievement)) *Tracker {
+	t := &Tracker{
+		achievements: achievements,
+		held:         make([]int, len(achievements)),
+		unlocked:     map[string]bool{},
+		unlock:       unlock,
+	}
+	for _, id := range unlocked {
+		t.unlocked[id] = true
+	}
+	m.AddFrameHook(func() error {
+		t.update(m.View())
+		return nil
+	})
+	return t
+}
+
+func (t *Tracker) update(now *View) {
+	t.mu.Lock()
+	prev := t.prev
+	if prev == nil {
+		prev = now
+	}
+	t.prev = now
+	var reached []*Achievement
+	for i, a := range t.achievements {
+		if t.unlocked[a.ID] {
+			continue
+		}
+		if !a.expr.True(now, prev) {
+			t.held[i] = 0
+			continue
+		}
+		if t.held[i]++; t.held[i] >= a.frames {
+			t.unlocked[a.ID] = true
+			reached = append(reached, a)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, a := range reached {
+		t.unlock(a)
+	}
+}
+
+// Unlocked reports whether an achievement was reached
+func (t *Tracker) Unlocked(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.unlocked[id]
+}
+
+// Progress is when the achievements of every ROM were unlocked
+type Progress struct {
+	mu   sync.Mutex
+	roms map[string]map[string]time.Time // By ROM hash then achievement ID
+}
+
+// NewProgress generates a new Progress without any unlock
+func NewProgress() *Progress {
+	return &Progress{roms: map[string]map[string]time.Time{}}
+}
+
+// Unlock records that an achievement of a ROM was reached
+func (p *Progress) Unlock(romHash, id string, when time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.roms[romHash] == nil {
+		p.roms[romHash] = map[string]time.Time{}
+	}
+	if _, ok := p.roms[romHash][id]; !ok {
+		p.roms[romHash][id] = when
+	}
+}
+
+// Unlocked returns the IDs of the achievements reached on a ROM, sorted
+func (p *Progress) Unlocked(romHash string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ids []string
+	for id := range p.roms[romHash] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Write saves the progress as JSON
+func (p *Progress) Write(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(p.roms)
+}
+
+// ReadProgress reads progress saved by Write
+func ReadProgress(r io.Reader) (*Progress, error) {
+	p := NewProgress()
+	if err := json.NewDecoder(r).Decode(&p.roms); err != nil {
+		return nil, err
+	}
+	if p.roms == nil {
+		p.roms = map[string]map[string]time.Time{}
+	}
+	return p, nil
+}
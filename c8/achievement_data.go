@@ -0,0 +1,23 @@
+package c8
+
+// builtinAchievements are goals for some of the games of the c8games
+// directory, in the format documented on Achievements
+const builtinAchievements = `{
+	"f13766c14aeb02ad8d4d103cb5eadd282d20cddc": [
+		{"id": "brix-first-brick", "title": "Crack", "description": "Break a brick.", "condition": "V5 > 0"},
+		{"id": "brix-50", "title": "Half a wall", "description": "Score 50 points.", "condition": "V5 >= 50"},
+		{"id": "brix-flawless", "title": "Flawless", "description": "Score 20 points without losing a ball.", "condition": "V5 >= 20 and VE == 5"},
+		{"id": "brix-minute", "title": "Steady hands", "description": "Keep all five balls for a minute.", "condition": "VE == 5 for 3600 frames"}
+	],
+	"5f518084744bf3cb8733f6e5454dfd1634320563": [
+		{"id": "tetris-line", "title": "Clean sweep", "description": "Clear a line.", "condition": "delta VA > 0"},
+		{"id": "tetris-10", "title": "Ten lines", "description": "Clear ten lines.", "condition": "VA >= 10"}
+	],
+	"bdb92475acfe11bc7814a2f5eade13fcd09b756a": [
+		{"id": "ufo-hit", "title": "Contact", "description": "Shoot down a UFO.", "condition": "delta V7 > 0"},
+		{"id": "ufo-sharpshooter", "title": "Sharpshooter", "description": "Score 50 points with 10 missiles left.", "condition": "V7 >= 50 and V8 >= 10"}
+	],
+	"d666688a8fce468a7d88b536bc1ef5f35ba12031": [
+		{"id": "wipeoff-50", "title": "Wiped", "description": "Score 50 points.", "condition": "V6 >= 50"}
+	]
+}`
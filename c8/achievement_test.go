@@ -0,0 +1,168 @@
+package c8
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAchievementConditions(t *testing.T) {
+	a := NewAchievements()
+	err := a.Load(strings.NewReader(`{"ABCD": [
+		{"id": "once", "condition": "V0 >= 3"},
+		{"id": "held", "condition": "V0 >= 3 for 2 frames"},
+		{"id": "one", "condition": "V0 == 1 for 1 frame"},
+		{"id": "named", "condition": "frame for 3 frames"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := a.Lookup("abcd")
+	if len(list) != 4 {
+		t.Fatalf("ROM has %d achievements, want 4", len(list))
+	}
+	for i, want := range []struct {
+		expr   string
+		frames int
+	}{{"V0 >= 3", 1}, {"V0 >= 3", 2}, {"V0 == 1", 1}, {"frame", 3}} {
+		if list[i].expr.String() != want.expr || list[i].frames != want.frames {
+			t.Errorf("%s is %q for %d frames, want %q for %d", list[i].ID, list[i].expr, list[i].frames, want.expr, want.frames)
+		}
+	}
+
+	for _, condition := range []string{"V0 >=", "V0 for 0 frames", "V0 for x frames", "V0 for -1 frames"} {
+		err := NewAchievements().Load(strings.NewReader(`{"abcd": [{"id": "bad", "condition": "` + condition + `"}]}`))
+		if err == nil {
+			t.Errorf("condition %q loaded", condition)
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	m := NewMachine()
+	// V0 counts the frames: add 1, then jump back, every frame
+	if err := m.LoadROM(bytes.NewReader([]byte{0x70, 0x01, 0x12, 0x00})); err != nil {
+		t.Fatal(err)
+	}
+	m.TickRate = 2
+
+	a := NewAchievements()
+	err := a.Load(strings.NewReader(`{"hash": [
+		{"id": "three", "condition": "V0 >= 3"},
+		{"id": "held", "condition": "V0 >= 3 for 2 frames"},
+		{"id": "step", "condition": "delta V0 == 1 and prev V0 == 5"},
+		{"id": "never", "condition": "delta V0 > 1"},
+		{"id": "saved", "condition": "V0 >= 1"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlocked := map[string]uint64{}
+	tracker := NewTracker(m, a.Lookup("hash"), []string{"saved"}, func(a *Achievement) {
+		if _, ok := unlocked[a.ID]; ok {
+			t.Errorf("%s unlocked twice", a.ID)
+		}
+		unlocked[a.ID] = m.State().Frames
+	})
+	for i := 0; i < 10; i++ {
+		if err := m.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]uint64{"three": 3, "held": 4, "step": 6}
+	if !reflect.DeepEqual(unlocked, want) {
+		t.Errorf("unlocked at frames %v, want %v", unlocked, want)
+	}
+	for _, id := range []string{"three", "held", "step", "saved"} {
+		if !tracker.Unlocked(id) {
+			t.Errorf("%s is not unlocked", id)
+		}
+	}
+	if tracker.Unlocked("never") {
+		t.Errorf("never is unlocked")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	p := NewProgress()
+	first := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	p.Unlock("rom", "b", first)
+	p.Unlock("rom", "a", first.Add(time.Hour))
+	p.Unlock("rom", "b", first.Add(2*time.Hour))
+	p.Unlock("other", "c", first)
+	if got := p.Unlocked("rom"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("unlocked %v, want [a b]", got)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadProgress(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.roms, p.roms) {
+		t.Errorf("read back %v, want %v", read.roms, p.roms)
+	}
+	if when := read.roms["rom"]["b"]; !when.Equal(first) {
+		t.Errorf("b was unlocked at %v, want the first unlock at %v", when, first)
+	}
+
+	empty, err := ReadProgress(strings.NewReader("null"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty.Unlock("rom", "a", first)
+	if got := empty.Unlocked("rom"); len(got) != 1 {
+		t.Errorf("unlocked %v after reading null", got)
+	}
+}
+
+// The built-in achievements are for the bundled games
+func TestDefaultAchievements(t *testing.T) {
+	games, err := filepath.Glob("../c8games/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]string{}
+	for _, game := range games {
+		rom, err := ioutil.ReadFile(game)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha1.Sum(rom)
+		hash := hex.EncodeToString(sum[:])
+		if len(DefaultAchievements.Lookup(hash)) > 0 {
+			found[filepath.Base(game)] = hash
+		}
+	}
+	if len(found) != len(DefaultAchievements.roms) {
+		t.Errorf("achievements are for %d ROMs, of which %v are bundled", len(DefaultAchievements.roms), found)
+	}
+}
+
+// The ball of BRIX breaks a brick on its own, even with nobody playing
+func TestBrixAchievement(t *testing.T) {
+	m := loadGame(t, "BRIX")
+	m.SetSeed(1)
+	tracker := NewTracker(m, DefaultAchievements.Lookup(m.ROMHash()), nil, func(*Achievement) {})
+	for i := 0; i < 600 && !tracker.Unlocked("brix-first-brick"); i++ {
+		if err := m.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !tracker.Unlocked("brix-first-brick") {
+		t.Errorf("no brick broken after 600 frames, V5 is %d", m.State().V[5])
+	}
+	if tracker.Unlocked("brix-50") {
+		t.Errorf("scored 50 with the first brick")
+	}
+}
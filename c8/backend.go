@@ -0,0 +1,92 @@
+package c8
+
+import (
+	"image/color"
+	"time"
+)
+
+const frameRate = 60 // Frames per second
+
+// Display shows the board to the user
+type Display interface {
+	// Refresh is called at the end of a frame in which the board changed.
+	// The board must not be kept after Refresh returns.
+	Refresh(b *Board)
+}
+
+// Keypad reports the state of the 16 hex keys
+type Keypad interface {
+	// Keys returns a bit mask with bit N set while key N is held down
+	Keys() uint16
+}
+
+// Audio plays the buzzer
+type Audio interface {
+	// Beep starts the buzzer when on is true, stops it otherwise
+	Beep(on bool)
+}
+
+// Clock paces the interpreter
+type Clock interface {
+	// Tick blocks until the next frame is due
+	Tick()
+}
+
+// Overlay shows shapes over the board, such as those drawn by scripts
+type Overlay interface {
+	// SetShapes replaces the shapes shown. The slice must not be kept
+	// after SetShapes returns.
+	SetShapes(shapes []Shape)
+}
+
+// Shape is a text or a filled rectangle, placed in pixels of the board
+type Shape struct {
+	Text          string // Drawn from X, Y when not empty, instead of a rectangle
+	X, Y          int
+	Width, Height int
+	Color         color.RGBA // Frontends may draw text in a colour of their own
+}
+
+// HeadlessDisplay discards everything drawn on it
+type HeadlessDisplay struct{}
+
+// Refresh does nothing
+func (HeadlessDisplay) Refresh(b *Board) {}
+
+// HeadlessKeypad never has a key held down
+type HeadlessKeypad struct{}
+
+// Keys always returns 0
+func (HeadlessKeypad) Keys() uint16 { return 0 }
+
+// HeadlessAudio is silent
+type HeadlessAudio struct{}
+
+// Beep does nothing
+func (HeadlessAudio) Beep(on bool) {}
+
+// HeadlessClock runs frames back to back as fast as possible
+type HeadlessClock struct{}
+
+// Tick returns immediately
+func (HeadlessClock) Tick() {}
+
+// RealTimeClock ticks at 60 frames per second
+type RealTimeClock struct {
+	ticker *time.Ticker
+}
+
+// NewRealTimeClock generates a new RealTimeClock
+func NewRealTimeClock() *RealTimeClock {
+	return &RealTimeClock{ticker: time.NewTicker(time.Second / frameRate)}
+}
+
+// Tick waits for the next 60 Hz tick
+func (c *RealTimeClock) Tick() {
+	<-c.ticker.C
+}
+
+// Stop releases the underlying ticker
+func (c *RealTimeClock) Stop() {
+	c.ticker.Stop()
+}
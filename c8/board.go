@@ -1,21 +1,72 @@
 package c8
 
+import "image"
+
 const (
-	pixelSize          = 10
 	pixelsHorizontally = 64
 	pixelsVertically   = 32
 
-	BoardWidth  = pixelsHorizontally * pixelSize
-	BoardHeight = pixelsVertically * pixelSize
+	// MaxBoardWidth and MaxBoardHeight are the size of the hires board
+	MaxBoardWidth  = 2 * pixelsHorizontally
+	MaxBoardHeight = 2 * pixelsVertically
 )
 
-type board struct {
-	tiles [pixelsVertically][pixelsHorizontally]byte
+// Board holds the pixels of the display, either in lores 64x32 or in
+// SUPER-CHIP hires 128x64
+type Board struct {
+	hires  bool
+	tiles  [MaxBoardHeight][MaxBoardWidth]byte
+	sprite Sprite
+}
+
+// Sprite describes the area drawn by a DXYN instruction
+type Sprite struct {
+	X, Y          int // Top left corner on the board
+	Width, Height int // Visible size
+
+	// Collisions are the pixels the sprite turned off, which set VF
+	Collisions []image.Point
+}
+
+// Width returns the number of pixels in a row
+func (b *Board) Width() int {
+	if b.hires {
+		return MaxBoardWidth
+	}
+	return pixelsHorizontally
+}
+
+// Height returns the number of pixels in a column
+func (b *Board) Height() int {
+	if b.hires {
+		return MaxBoardHeight
+	}
+	return pixelsVertically
 }
 
-var b2 board
+// Hires reports whether the board is in hires mode
+func (b *Board) Hires() bool {
+	return b.hires
+}
+
+// Pixel returns the value of the pixel at the given row and column
+func (b *Board) Pixel(row, col int) byte {
+	return b.tiles[row][col]
+}
+
+// LastSprite returns the sprite most recently drawn
+func (b *Board) LastSprite() Sprite {
+	return b.sprite
+}
+
+// clear turns off every pixel, keeping the resolution
+func (b *Board) clear() {
+	b.tiles = [MaxBoardHeight][MaxBoardWidth]byte{}
+	b.sprite = Sprite{}
+}
 
-// newBoard is to create board
-func newBoard() (*board, error) {
-	return &b2, nil
+// setHires switches the resolution, which also clears the board
+func (b *Board) setHires(hires bool) {
+	b.hires = hires
+	b.clear()
 }
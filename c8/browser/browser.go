@@ -0,0 +1,187 @@
+// Package browser runs a machine for the WebAssembly build of the page in
+// directory wasm. It knows nothing of JavaScript: the page hands it ROMs
+// and keys, has it run the frames due at every animation frame and draws
+// its pixels, and keeps the save states it is given. This lets it be tested
+// natively.
+package browser
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+const (
+	// Width and Height are the size of the pixels, those of the hires board
+	Width  = c8.MaxBoardWidth
+	Height = c8.MaxBoardHeight
+
+	frameTime = time.Second / 60
+
+	// maxFrames is the most frames run at once, when the page was in the
+	// background for a while
+	maxFrames = 4
+)
+
+// ErrNoROM is returned when there is no ROM to run or to save
+var ErrNoROM = errors.New("no ROM is loaded")
+
+// ErrNoState is returned by Restore when the ROM was never saved
+var ErrNoState = errors.New("there is no save state for this ROM")
+
+// Storage keeps the save states, localStorage in a browser
+type Storage interface {
+	Get(key string) (value string, ok bool)
+	Set(key, value string) error
+}
+
+// Emulator runs the ROM loaded last. It is not safe for concurrent use,
+// the page calls it from its event handlers one at a time.
+type Emulator struct {
+	palette c8.Palette
+	storage Storage
+
+	m       *c8.Machine
+	name    string
+	late    time.Duration // Behind the frames due
+	keys    uint16
+	beep    bool
+	changed bool   // Pixels were drawn since the last call to Pixels
+	pixels  []byte // RGBA
+}
+
+// NewEmulator generates a new Emulator drawing in the colours of palette
+// and saving into storage
+func NewEmulator(palette c8.Palette, storage Storage) *Emulator {
+	e := &Emulator{palette: palette, storage: storage, pixels: make([]byte, 4*Width*Height)}
+	e.fill()
+	return e
+}
+
+// Load replaces the machine with a new one running rom
+func (e *Emulator) Load(name string, rom []byte) error {
+	m := c8.NewMachine()
+	if err := m.LoadROM(bytes.NewReader(rom)); err != nil {
+		return err
+	}
+	m.Display, m.Keypad, m.Audio = e, e, e
+	e.m, e.name, e.late, e.beep = m, name, 0, false
+	e.fill()
+	return nil
+}
+
+// Name returns the name of the ROM given to Load
+func (e *Emulator) Name() string {
+	return e.name
+}
+
+// Advance runs the frames due after some time went by
+func (e *Emulator) Advance(elapsed time.Duration) error {
+	if e.m == nil {
+		return ErrNoROM
+	}
+	e.late += elapsed
+	if e.late > maxFrames*frameTime {
+		e.late = maxFrames * frameTime
+	}
+	for ; e.late >= frameTime; e.late -= frameTime {
+		if err := e.m.RunFrame(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetKey holds or releases a key of the hex keypad
+func (e *Emulator) SetKey(key int, down bool) {
+	if key < 0 || key > 0xF {
+		return
+	}
+	if down {
+		e.keys |= 1 << uint(key)
+	} else {
+		e.keys &^= 1 << uint(key)
+	}
+}
+
+// Keys returns the keys held
+func (e *Emulator) Keys() uint16 {
+	return e.keys
+}
+
+// Beep starts or stops the buzzer
+func (e *Emulator) Beep(on bool) {
+	e.beep = on
+}
+
+// Beeping reports whether the buzzer is on
+func (e *Emulator) Beeping() bool {
+	return e.beep
+}
+
+// Refresh draws the board into the pixels
+func (e *Emulator) Refresh(b *c8.Board) {
+	// Lores pixels cover two hires pixels in both directions
+	zoom := Width / b.Width()
+	for row := 0; row < Height; row++ {
+		for col := 0; col < Width; col++ {
+			c := e.palette.Color(b.Pixel(row/zoom, col/zoom))
+			i := 4 * (row*Width + col)
+			e.pixels[i], e.pixels[i+1], e.pixels[i+2], e.pixels[i+3] = c.R, c.G, c.B, 0xFF
+		}
+	}
+	e.changed = true
+}
+
+// fill clears the pixels to the background colour
+func (e *Emulator) fill() {
+	c := e.palette.Color(0)
+	for i := 0; i < len(e.pixels); i += 4 {
+		e.pixels[i], e.pixels[i+1], e.pixels[i+2], e.pixels[i+3] = c.R, c.G, c.B, 0xFF
+	}
+	e.changed = true
+}
+
+// Pixels returns the RGBA pixels of the board, Width by Height, and whether
+// they changed since the last call
+func (e *Emulator) Pixels() ([]byte, bool) {
+	changed := e.changed
+	e.changed = false
+	return e.pixels, changed
+}
+
+// stateKey is where the save state of the running ROM is stored
+func (e *Emulator) stateKey() string {
+	return "chip8/state/" + e.m.ROMHash()
+}
+
+// Save stores the state of the machine, replacing the previous save state
+// of the ROM
+func (e *Emulator) Save() error {
+	if e.m == nil {
+		return ErrNoROM
+	}
+	var buf bytes.Buffer
+	if err := e.m.Snapshot().Write(&buf); err != nil {
+		return err
+	}
+	return e.storage.Set(e.stateKey(), buf.String())
+}
+
+// Restore puts the machine back in its saved state
+func (e *Emulator) Restore() error {
+	if e.m == nil {
+		return ErrNoROM
+	}
+	data, ok := e.storage.Get(e.stateKey())
+	if !ok {
+		return ErrNoState
+	}
+	s, err := c8.ReadSnapshot(bytes.NewBufferString(data))
+	if err != nil {
+		return err
+	}
+	return e.m.Restore(s)
+}
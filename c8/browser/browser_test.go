@@ -0,0 +1,198 @@
+package browser
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// memoryStorage keeps save states in a map, as localStorage would
+type memoryStorage map[string]string
+
+func (s memoryStorage) Get(key string) (string, bool) {
+	value, ok := s[key]
+	return value, ok
+}
+
+func (s memoryStorage) Set(key, value string) error {
+	s[key] = value
+	return nil
+}
+
+func loadMaze(t *testing.T) (*Emulator, memoryStorage) {
+	rom, err := ioutil.ReadFile("../../c8games/MAZE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := memoryStorage{}
+	e := NewEmulator(c8.Palettes[0], storage)
+	if err := e.Load("MAZE", rom); err != nil {
+		t.Fatal(err)
+	}
+	return e, storage
+}
+
+// lit counts the pixels not in the background colour
+func lit(pixels []byte) int {
+	background := c8.Palettes[0].Color(0)
+	n := 0
+	for i := 0; i < len(pixels); i += 4 {
+		if pixels[i] != background.R || pixels[i+1] != background.G || pixels[i+2] != background.B {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPlay(t *testing.T) {
+	e, _ := loadMaze(t)
+	if pixels, changed := e.Pixels(); !changed || lit(pixels) != 0 {
+		t.Fatalf("a new ROM starts with %d pixels lit, changed %v", lit(pixels), changed)
+	}
+	if _, changed := e.Pixels(); changed {
+		t.Errorf("the pixels changed without running")
+	}
+
+	// A frame is run every 60th of a second, however the time is split
+	for i := 0; i < 60; i++ {
+		if err := e.Advance(time.Second / 120); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if frames := e.m.State().Frames; frames != 30 {
+		t.Errorf("half a second ran %d frames, want 30", frames)
+	}
+	pixels, changed := e.Pixels()
+	if !changed || lit(pixels) == 0 {
+		t.Errorf("the maze shows %d pixels, changed %v", lit(pixels), changed)
+	}
+
+	// A page left in the background does not catch up
+	if err := e.Advance(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if frames := e.m.State().Frames; frames != 30+maxFrames {
+		t.Errorf("a minute in the background ran %d frames, want %d", frames-30, maxFrames)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	e := NewEmulator(c8.Palettes[0], memoryStorage{})
+	if err := e.Advance(time.Second); err != ErrNoROM {
+		t.Errorf("running without a ROM returned %v", err)
+	}
+	e.SetKey(0xA, true)
+	e.SetKey(3, true)
+	e.SetKey(16, true)
+	e.SetKey(-1, true)
+	e.SetKey(3, false)
+	if keys := e.Keys(); keys != 1<<0xA {
+		t.Errorf("keys are %04X, want %04X", keys, 1<<0xA)
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	e, storage := loadMaze(t)
+	if err := e.Restore(); err != ErrNoState {
+		t.Errorf("restoring before saving returned %v", err)
+	}
+	if err := e.Advance(frameTime); err != nil {
+		t.Fatal(err)
+	}
+	saved := e.m.Snapshot()
+	if err := e.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if len(storage) != 1 {
+		t.Errorf("storage has %d values after saving, want 1", len(storage))
+	}
+	for i := 0; i < 10; i++ {
+		e.Advance(frameTime)
+	}
+	if err := e.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.m.Snapshot(); got.Checksum() != saved.Checksum() {
+		t.Errorf("restored frame %d, want frame %d", got.Frames, saved.Frames)
+	}
+}
+
+// smokeTest runs the WebAssembly build in Node with the page replaced by
+// the script: it plays MAZE for a second, then saves and restores it
+const smokeTest = `
+const [wasmExec, wasm, rom] = process.argv.slice(2);
+const fs = require("fs");
+require(wasmExec);
+const storage = {};
+globalThis.localStorage = {
+	getItem: key => key in storage ? storage[key] : null,
+	setItem: (key, value) => { storage[key] = String(value); },
+};
+function fail(message) {
+	console.log(message);
+	process.exit(1);
+}
+globalThis.chip8Ready = () => {
+	let err = chip8.load("MAZE", new Uint8Array(fs.readFileSync(rom)));
+	if (err) fail("load: " + err);
+	let lit = 0;
+	for (let i = 0; i < 60; i++) {
+		const result = chip8.frame(17);
+		if (result.error) fail("frame: " + result.error);
+		if (result.pixels) lit = result.pixels.filter((v, i) => i % 4 == 0 && v != 0).length;
+	}
+	if (lit == 0) fail("no pixel is lit");
+	if (chip8.restore() === null) fail("restored before saving");
+	if ((err = chip8.save()) !== null) fail("save: " + err);
+	if (Object.keys(storage).length != 1) fail("nothing saved");
+	if ((err = chip8.restore()) !== null) fail("restore: " + err);
+	console.log("ok");
+	process.exit(0);
+};
+const go = new Go();
+WebAssembly.instantiate(fs.readFileSync(wasm), go.importObject).then(r => go.run(r.instance));
+`
+
+func TestWasm(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the WebAssembly emulator")
+	}
+	dir, err := ioutil.TempDir("", "browser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wasm := filepath.Join(dir, "chip8.wasm")
+	build := exec.Command("go", "build", "-o", wasm, "../../wasm")
+	build.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is needed to run the build")
+	}
+	var wasmExec string
+	for _, dir := range []string{"lib", "misc"} {
+		wasmExec = filepath.Join(runtime.GOROOT(), dir, "wasm", "wasm_exec.js")
+		if _, err := os.Stat(wasmExec); err == nil {
+			break
+		}
+	}
+	script := filepath.Join(dir, "smoke.js")
+	if err := ioutil.WriteFile(script, []byte(smokeTest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rom, _ := filepath.Abs("../../c8games/MAZE")
+	out, err := exec.Command(node, script, wasmExec, wasm, rom).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+}
@@ -0,0 +1,127 @@
+// Package c8test provides c8 backends for use in tests
+package c8test
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// Display keeps a text copy of the last board it was given
+type Display struct {
+	mu        sync.Mutex
+	refreshes int
+	lines     []string
+}
+
+// Refresh stores the board, one line per row with '#' for a set pixel
+func (d *Display) Refresh(b *c8.Board) {
+	lines := make([]string, b.Height())
+	for row := range lines {
+		var sb strings.Builder
+		for col := 0; col < b.Width(); col++ {
+			if b.Pixel(row, col) > 0 {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		lines[row] = sb.String()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.refreshes++
+	d.lines = lines
+}
+
+// Refreshes returns how many times Refresh was called
+func (d *Display) Refreshes() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.refreshes
+}
+
+// String returns the last board as text
+func (d *Display) String() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return strings.Join(d.lines, "\n")
+}
+
+// Keypad holds the keys set by the test
+type Keypad struct {
+	mu   sync.Mutex
+	keys uint16
+}
+
+// Press holds the given key down
+func (k *Keypad) Press(key byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys |= 1 << (key & 0xF)
+}
+
+// Release lets go of the given key
+func (k *Keypad) Release(key byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys &^= 1 << (key & 0xF)
+}
+
+// Keys returns the keys currently held
+func (k *Keypad) Keys() uint16 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.keys
+}
+
+// Audio records every buzzer change
+type Audio struct {
+	mu    sync.Mutex
+	beeps []bool
+}
+
+// Beep records the change
+func (a *Audio) Beep(on bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.beeps = append(a.beeps, on)
+}
+
+// Beeps returns the recorded changes in order
+func (a *Audio) Beeps() []bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]bool(nil), a.beeps...)
+}
+
+// Clock lets the test decide when each frame runs
+type Clock struct {
+	ticks chan struct{}
+}
+
+// NewClock generates a new Clock
+func NewClock() *Clock {
+	return &Clock{ticks: make(chan struct{})}
+}
+
+// Tick blocks until Advance is called
+func (c *Clock) Tick() {
+	<-c.ticks
+}
+
+// Advance lets n more frames run, blocking until each has started
+func (c *Clock) Advance(n int) {
+	for i := 0; i < n; i++ {
+		c.ticks <- struct{}{}
+	}
+}
+
+var (
+	_ c8.Display = (*Display)(nil)
+	_ c8.Keypad  = (*Keypad)(nil)
+	_ c8.Audio   = (*Audio)(nil)
+	_ c8.Clock   = (*Clock)(nil)
+)
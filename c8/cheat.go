@@ -0,0 +1,179 @@
+package c8
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Comparison selects the addresses a Search keeps
+type Comparison int
+
+// Comparisons of the value of an address now with its value at the
+// previous search, or with a given value for Equal
+const (
+	Equal Comparison = iota
+	Changed
+	Unchanged
+	Increased
+	Decreased
+)
+
+// Search narrows down the addresses holding a value of a game, such as the
+// lives or the score, by comparing memory between snapshots
+type Search struct {
+	previous   []byte
+	candidates []uint16
+}
+
+// NewSearch starts a search among all of memory, as it is now
+func NewSearch(m *Machine) *Search {
+	s := &Search{previous: m.Peek(0, memorySize)}
+	for addr := range s.previous {
+		s.candidates = append(s.candidates, uint16(addr))
+	}
+	return s
+}
+
+// Filter keeps the candidates whose value compares as asked with the last
+// search, then remembers memory as it is now. value is only used by Equal.
+func (s *Search) Filter(m *Machine, c Comparison, value byte) {
+	memory := m.Peek(0, memorySize)
+	kept := s.candidates[:0]
+	for _, addr := range s.candidates {
+		now, before := memory[addr], s.previous[addr]
+		var keep bool
+		switch c {
+		case Equal:
+			keep = now == value
+		case Changed:
+			keep = now != before
+		case Unchanged:
+			keep = now == before
+		case Increased:
+			keep = now > before
+		case Decreased:
+			keep = now < before
+		}
+		if keep {
+			kept = append(kept, addr)
+		}
+	}
+	s.candidates = kept
+	s.previous = memory
+}
+
+// Candidates returns the addresses still matching every filter
+func (s *Search) Candidates() []uint16 {
+	return s.candidates
+}
+
+// Previous returns the value of an address at the last search
+func (s *Search) Previous(addr uint16) byte {
+	return s.previous[addr]
+}
+
+// Cheat freezes a byte of memory
+type Cheat struct {
+	Addr  uint16
+	Value byte
+	Name  string
+}
+
+// Cheats are rewritten into memory at the end of every frame by the
+// machine they are given to
+type Cheats struct {
+	mu     sync.Mutex
+	cheats []Cheat // By address
+}
+
+// Freeze adds a cheat, replacing any other on the same address
+func (c *Cheats) Freeze(cheat Cheat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(cheat.Addr)
+	c.cheats = append(c.cheats, cheat)
+	sort.Slice(c.cheats, func(i, j int) bool { return c.cheats[i].Addr < c.cheats[j].Addr })
+}
+
+// Unfreeze removes the cheat of an address
+func (c *Cheats) Unfreeze(addr uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(addr)
+}
+
+func (c *Cheats) remove(addr uint16) {
+	for i, cheat := range c.cheats {
+		if cheat.Addr == addr {
+			c.cheats = append(c.cheats[:i], c.cheats[i+1:]...)
+			return
+		}
+	}
+}
+
+// List returns the cheats by address
+func (c *Cheats) List() []Cheat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Cheat(nil), c.cheats...)
+}
+
+func (c *Cheats) apply(memory []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cheat := range c.cheats {
+		if int(cheat.Addr) < len(memory) {
+			memory[cheat.Addr] = cheat.Value
+		}
+	}
+}
+
+// Write saves the cheats as text, one per line with the address, the
+// value in hex and a name:
+//
+//	# Cheats for Space Invaders
+//	3F0 09 lives
+func (c *Cheats) Write(w io.Writer, title string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Cheats for %s\n", title)
+	for _, cheat := range c.List() {
+		line := fmt.Sprintf("%03X %02X %s", cheat.Addr, cheat.Value, cheat.Name)
+		fmt.Fprintln(bw, strings.TrimSpace(line))
+	}
+	return bw.Flush()
+}
+
+// ReadCheats reads cheats saved by Write. Lines starting with # are
+// comments.
+func ReadCheats(r io.Reader) (*Cheats, error) {
+	c := &Cheats{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: want an address and a value", line)
+		}
+		addr, err := strconv.ParseUint(fields[0], 16, 12)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", line, fields[0])
+		}
+		value, err := strconv.ParseUint(fields[1], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value %q", line, fields[1])
+		}
+		// The name is the rest of the line, with its spaces
+		name := strings.TrimSpace(strings.TrimPrefix(text, fields[0]))
+		name = strings.TrimSpace(strings.TrimPrefix(name, fields[1]))
+		c.Freeze(Cheat{Addr: uint16(addr), Value: byte(value), Name: name})
+	}
+	return c, scanner.Err()
+}
@@ -0,0 +1,130 @@
+package c8
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	before := []byte{5, 5, 5, 5}
+	after := []byte{5, 7, 3, 0xAB}
+	tests := []struct {
+		comparison Comparison
+		value      byte
+		want       []uint16
+	}{
+		{Equal, 0xAB, []uint16{0x303}},
+		{Equal, 5, []uint16{0x300}},
+		{Changed, 0, []uint16{0x301, 0x302, 0x303}},
+		{Increased, 0, []uint16{0x301, 0x303}},
+		{Decreased, 0, []uint16{0x302}},
+	}
+	for _, test := range tests {
+		m := NewMachine()
+		for i, val := range before {
+			m.Poke(0x300+uint16(i), val)
+		}
+		s := NewSearch(m)
+		if n := len(s.Candidates()); n != memorySize {
+			t.Fatalf("a new search has %d candidates", n)
+		}
+		for i, val := range after {
+			m.Poke(0x300+uint16(i), val)
+		}
+		s.Filter(m, test.comparison, test.value)
+		if got := s.Candidates(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("comparison %d with %d kept %X, want %X", test.comparison, test.value, got, test.want)
+		}
+		if got := s.Previous(0x303); got != 0xAB {
+			t.Errorf("previous value is %d after filtering, want the value then", got)
+		}
+	}
+
+	// Unchanged keeps the rest of memory, and filters narrow each other down
+	m := NewMachine()
+	s := NewSearch(m)
+	m.Poke(0x300, 1)
+	s.Filter(m, Unchanged, 0)
+	if n := len(s.Candidates()); n != memorySize-1 || s.Candidates()[0x300] != 0x301 {
+		t.Errorf("unchanged kept %d candidates", n)
+	}
+	m.Poke(0x301, 1)
+	s.Filter(m, Increased, 0)
+	if got := s.Candidates(); !reflect.DeepEqual(got, []uint16{0x301}) {
+		t.Errorf("unchanged then increased kept %X", got)
+	}
+}
+
+func TestCheatsRoundTrip(t *testing.T) {
+	c := &Cheats{}
+	c.Freeze(Cheat{Addr: 0x3F0, Value: 9, Name: "lives"})
+	c.Freeze(Cheat{Addr: 0x200, Value: 0xFF})
+	c.Freeze(Cheat{Addr: 0x3F0, Value: 3, Name: "three lives"})
+	c.Freeze(Cheat{Addr: 0x210, Value: 1, Name: "level"})
+	c.Unfreeze(0x210)
+	want := []Cheat{{Addr: 0x200, Value: 0xFF}, {Addr: 0x3F0, Value: 3, Name: "three lives"}}
+	if !reflect.DeepEqual(c.List(), want) {
+		t.Fatalf("cheats are %+v, want %+v", c.List(), want)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Write(&buf, "Space Invaders"); err != nil {
+		t.Fatal(err)
+	}
+	if text := "# Cheats for Space Invaders\n200 FF\n3F0 03 three lives\n"; buf.String() != text {
+		t.Errorf("written as %q, want %q", buf.String(), text)
+	}
+	read, err := ReadCheats(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.List(), want) {
+		t.Errorf("read back %+v, want %+v", read.List(), want)
+	}
+}
+
+func TestReadCheats(t *testing.T) {
+	c, err := ReadCheats(strings.NewReader("# Comment\n\n  3f0  9   lives  left  \nABC\t0\n200 \t 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Cheat{{Addr: 0x200, Value: 1}, {Addr: 0x3F0, Value: 9, Name: "lives  left"}, {Addr: 0xABC, Value: 0}}
+	if !reflect.DeepEqual(c.List(), want) {
+		t.Errorf("read %+v, want %+v", c.List(), want)
+	}
+
+	errors := []struct {
+		text, err string
+	}{
+		{"3F0\n", "line 1: want an address and a value"},
+		{"\n1000 1\n", `line 2: invalid address "1000"`},
+		{"3F0 100\n", `line 1: invalid value "100"`},
+		{"3F0 x lives\n", `line 1: invalid value "x"`},
+	}
+	for _, test := range errors {
+		if _, err := ReadCheats(strings.NewReader(test.text)); err == nil || err.Error() != test.err {
+			t.Errorf("%q returned %v, want %s", test.text, err, test.err)
+		}
+	}
+}
+
+func TestCheatsApply(t *testing.T) {
+	m := NewMachine()
+	m.initSprites()
+	// Count V0 up forever
+	copy(m.memory[programCounterStart:], []byte{0x70, 0x01, 0x12, 0x00})
+	m.Cheats = &Cheats{}
+	m.Cheats.Freeze(Cheat{Addr: 0x300, Value: 42})
+	if err := m.RunFrame(); err != nil {
+		t.Fatal(err)
+	}
+	m.Poke(0x300, 0)
+	if err := m.RunFrame(); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Peek(0x300, 1)[0]; got != 42 {
+		t.Errorf("frozen byte is %d after a frame, want 42", got)
+	}
+}
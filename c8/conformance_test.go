@@ -0,0 +1,662 @@
+package c8
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden boards of the conformance tests")
+
+// conformanceCase is a small program, run from 0x200 until it jumps to
+// itself, and what it must leave behind
+type conformanceCase struct {
+	op      string // Instruction tested, such as 8XY5
+	name    string
+	quirks  Quirks
+	keys    uint16 // Held during every frame
+	program []uint16
+
+	regs   map[string]int // V0-VF, I, PC, DT, ST and SP, the depth of the stack
+	memory map[int][]byte // By address
+	board  string         // Golden file in testdata/conformance, the board is blank without it
+	check  func(m *Machine) error
+	wait   bool // The program never stops, it is run for maxFrames
+	frames int  // Run before stopping, unless 0
+}
+
+// maxFrames is how long a program may run
+const maxFrames = 10
+
+var conformanceCases = []conformanceCase{
+	{op: "00E0", name: "clear", program: []uint16{
+		0xA100, // I = 0 of the font
+		0xD005, // Draw it at V0,V0
+		0x00E0, // Clear
+		0x1206,
+	}},
+	{op: "00FF", name: "hires", board: "00FF_hires", program: []uint16{
+		0x00FF, // Hires
+		0x6078, // V0 = 120
+		0x613A, // V1 = 58
+		0xA100, // I = 0 of the font
+		0xD015, // Draw it at 120,58
+		0x120A,
+	}},
+	{op: "00FE", name: "lores", program: []uint16{
+		0x00FF, // Hires
+		0xA100, // I = 0 of the font
+		0xD005, // Draw it
+		0x00FE, // Lores
+		0x1208,
+	}, check: func(m *Machine) error {
+		if m.board.Hires() {
+			return fmt.Errorf("the board is still hires")
+		}
+		return nil
+	}},
+	{op: "00EE", name: "return", regs: map[string]int{"V0": 5, "V1": 2, "I": 0x123, "SP": 0, "PC": 0x206}, program: []uint16{
+		0x6005, // V0 = 5
+		0x220A, // Call 20A
+		0x6102, // V1 = 2
+		0x1206,
+		0x0000,
+		0xA123, // 20A: I = 123, kept by the return
+		0x00EE, // Return
+	}},
+	{op: "00EE", name: "registers", regs: map[string]int{"V0": 7, "V1": 0, "SP": 0, "PC": 0x202}, program: []uint16{
+		0x2206, // Call 206
+		0x1202,
+		0x6101, // 204: never run
+		0x6007, // 206: V0 = 7, kept by the return
+		0x00EE, // Return
+	}},
+	{op: "2NNN", name: "nested", regs: map[string]int{"V0": 2, "SP": 2, "PC": 0x20A}, program: []uint16{
+		0x2204, // Call 204
+		0x0000,
+		0x7001, // 204: V0 += 1
+		0x2208, // Call 208
+		0x7001, // 208: V0 += 1
+		0x120A,
+	}},
+	{op: "1NNN", name: "jump", regs: map[string]int{"V1": 0, "V2": 2}, program: []uint16{
+		0x1204, // Jump over
+		0x6101, // V1 = 1
+		0x6202, // V2 = 2
+		0x1206,
+	}},
+	{op: "3XNN", name: "equal", regs: map[string]int{"V1": 0}, program: []uint16{
+		0x6042, // V0 = 42
+		0x3042, // Skip if V0 == 42
+		0x6101, // V1 = 1
+		0x1206,
+	}},
+	{op: "3XNN", name: "not equal", regs: map[string]int{"V1": 1}, program: []uint16{
+		0x6042, // V0 = 42
+		0x3043, // Skip if V0 == 43
+		0x6101, // V1 = 1
+		0x1206,
+	}},
+	{op: "4XNN", name: "equal", regs: map[string]int{"V1": 1}, program: []uint16{
+		0x6042, // V0 = 42
+		0x4042, // Skip if V0 != 42
+		0x6101, // V1 = 1
+		0x1206,
+	}},
+	{op: "4XNN", name: "not equal", regs: map[string]int{"V1": 0}, program: []uint16{
+		0x6042, // V0 = 42
+		0x4043, // Skip if V0 != 43
+		0x6101, // V1 = 1
+		0x1206,
+	}},
+	{op: "5XY0", name: "equal", regs: map[string]int{"V2": 0}, program: []uint16{
+		0x6007, // V0 = 7
+		0x6107, // V1 = 7
+		0x5010, // Skip if V0 == V1
+		0x6201, // V2 = 1
+		0x1208,
+	}},
+	{op: "5XY0", name: "not equal", regs: map[string]int{"V2": 1}, program: []uint16{
+		0x6007, // V0 = 7
+		0x6108, // V1 = 8
+		0x5010, // Skip if V0 == V1
+		0x6201, // V2 = 1
+		0x1208,
+	}},
+	{op: "6XNN", name: "set", regs: map[string]int{"V0": 0xAB, "VE": 0xCD}, program: []uint16{
+		0x60AB, // V0 = AB
+		0x6ECD, // VE = CD
+		0x1204,
+	}},
+	{op: "7XNN", name: "add", regs: map[string]int{"V0": 0x30}, program: []uint16{
+		0x6010, // V0 = 10
+		0x7020, // V0 += 20
+		0x1204,
+	}},
+	{op: "7XNN", name: "no carry", regs: map[string]int{"V0": 0x01, "VF": 5}, program: []uint16{
+		0x6F05, // VF = 5
+		0x6002, // V0 = 2
+		0x70FF, // V0 += FF
+		0x1206,
+	}},
+	{op: "8XY0", name: "assign", regs: map[string]int{"V0": 0x55, "V1": 0x55}, program: []uint16{
+		0x6155, // V1 = 55
+		0x8010, // V0 = V1
+		0x1204,
+	}},
+	{op: "8XY1", name: "or", regs: map[string]int{"V0": 0xFC, "VF": 5}, program: []uint16{
+		0x6F05, // VF = 5
+		0x60CC, // V0 = CC
+		0x613C, // V1 = 3C
+		0x8011, // V0 |= V1
+		0x1208,
+	}},
+	{op: "8XY1", name: "logic quirk", quirks: Quirks{Logic: true}, regs: map[string]int{"V0": 0xFC, "VF": 0}, program: []uint16{
+		0x6F05, // VF = 5
+		0x60CC, // V0 = CC
+		0x613C, // V1 = 3C
+		0x8011, // V0 |= V1
+		0x1208,
+	}},
+	{op: "8XY2", name: "and", regs: map[string]int{"V0": 0x0C, "VF": 5}, program: []uint16{
+		0x6F05, // VF = 5
+		0x60CC, // V0 = CC
+		0x613C, // V1 = 3C
+		0x8012, // V0 &= V1
+		0x1208,
+	}},
+	{op: "8XY2", name: "logic quirk", quirks: Quirks{Logic: true}, regs: map[string]int{"V0": 0x0C, "VF": 0}, program: []uint16{
+		0x6F05, // VF = 5
+		0x60CC, // V0 = CC
+		0x613C, // V1 = 3C
+		0x8012, // V0 &= V1
+		0x1208,
+	}},
+	{op: "8XY3", name: "xor", regs: map[string]int{"V0": 0xF0, "VF": 5}, program: []uint16{
+		0x6F05, // VF = 5
+		0x60CC, // V0 = CC
+		0x613C, // V1 = 3C
+		0x8013, // V0 ^= V1
+		0x1208,
+	}},
+	{op: "8XY3", name: "logic quirk", quirks: Quirks{Logic: true}, regs: map[string]int{"V0": 0xF0, "VF": 0}, program: []uint16{
+		0x6F05, // VF = 5
+		0x60CC, // V0 = CC
+		0x613C, // V1 = 3C
+		0x8013, // V0 ^= V1
+		0x1208,
+	}},
+	{op: "8XY4", name: "no carry", regs: map[string]int{"V0": 0xFF, "VF": 0}, program: []uint16{
+		0x6F05, // VF = 5
+		0x60F0, // V0 = F0
+		0x610F, // V1 = 0F
+		0x8014, // V0 += V1
+		0x1208,
+	}},
+	{op: "8XY4", name: "carry", regs: map[string]int{"V0": 0x0F, "VF": 1}, program: []uint16{
+		0x60F0, // V0 = F0
+		0x611F, // V1 = 1F
+		0x8014, // V0 += V1
+		0x1206,
+	}},
+	{op: "8XY4", name: "flag in VF", regs: map[string]int{"VF": 1}, program: []uint16{
+		0x6FF0, // VF = F0
+		0x6120, // V1 = 20
+		0x8F14, // VF += V1
+		0x1206,
+	}},
+	{op: "8XY5", name: "no borrow", regs: map[string]int{"V0": 0x20, "VF": 1}, program: []uint16{
+		0x6030, // V0 = 30
+		0x6110, // V1 = 10
+		0x8015, // V0 -= V1
+		0x1206,
+	}},
+	{op: "8XY5", name: "equal", regs: map[string]int{"V0": 0, "VF": 1}, program: []uint16{
+		0x6030, // V0 = 30
+		0x6130, // V1 = 30
+		0x8015, // V0 -= V1
+		0x1206,
+	}},
+	{op: "8XY5", name: "borrow", regs: map[string]int{"V0": 0xE0, "VF": 0}, program: []uint16{
+		0x6010, // V0 = 10
+		0x6130, // V1 = 30
+		0x8015, // V0 -= V1
+		0x1206,
+	}},
+	{op: "8XY5", name: "flag in VF", regs: map[string]int{"VF": 0}, program: []uint16{
+		0x6F10, // VF = 10
+		0x6130, // V1 = 30
+		0x8F15, // VF -= V1
+		0x1206,
+	}},
+	{op: "8XY6", name: "shift VY", regs: map[string]int{"V0": 0x02, "V1": 0x05, "VF": 1}, program: []uint16{
+		0x60FF, // V0 = FF
+		0x6105, // V1 = 5
+		0x8016, // V0 = V1 >> 1
+		0x1206,
+	}},
+	{op: "8XY6", name: "shift quirk", quirks: Quirks{Shift: true}, regs: map[string]int{"V0": 0x40, "V1": 0x05, "VF": 0}, program: []uint16{
+		0x6080, // V0 = 80
+		0x6105, // V1 = 5
+		0x8016, // V0 >>= 1
+		0x1206,
+	}},
+	{op: "8XY6", name: "flag in VF", regs: map[string]int{"VF": 0}, program: []uint16{
+		0x6102, // V1 = 2
+		0x8F16, // VF = V1 >> 1
+		0x1204,
+	}},
+	{op: "8XY7", name: "no borrow", regs: map[string]int{"V0": 0x20, "VF": 1}, program: []uint16{
+		0x6010, // V0 = 10
+		0x6130, // V1 = 30
+		0x8017, // V0 = V1 - V0
+		0x1206,
+	}},
+	{op: "8XY7", name: "borrow", regs: map[string]int{"V0": 0xE0, "VF": 0}, program: []uint16{
+		0x6030, // V0 = 30
+		0x6110, // V1 = 10
+		0x8017, // V0 = V1 - V0
+		0x1206,
+	}},
+	{op: "8XY7", name: "flag in VF", regs: map[string]int{"VF": 1}, program: []uint16{
+		0x6F10, // VF = 10
+		0x6130, // V1 = 30
+		0x8F17, // VF = V1 - VF
+		0x1206,
+	}},
+	{op: "8XYE", name: "shift VY", regs: map[string]int{"V0": 0x0A, "V1": 0x85, "VF": 1}, program: []uint16{
+		0x6001, // V0 = 1
+		0x6185, // V1 = 85
+		0x801E, // V0 = V1 << 1
+		0x1206,
+	}},
+	{op: "8XYE", name: "shift quirk", quirks: Quirks{Shift: true}, regs: map[string]int{"V0": 0x82, "V1": 0x85, "VF": 0}, program: []uint16{
+		0x6041, // V0 = 41
+		0x6185, // V1 = 85
+		0x801E, // V0 <<= 1
+		0x1206,
+	}},
+	{op: "8XYE", name: "flag in VF", regs: map[string]int{"VF": 1}, program: []uint16{
+		0x61C0, // V1 = C0
+		0x8F1E, // VF = V1 << 1
+		0x1204,
+	}},
+	{op: "9XY0", name: "equal", regs: map[string]int{"V2": 1}, program: []uint16{
+		0x6007, // V0 = 7
+		0x6107, // V1 = 7
+		0x9010, // Skip if V0 != V1
+		0x6201, // V2 = 1
+		0x1208,
+	}},
+	{op: "9XY0", name: "not equal", regs: map[string]int{"V2": 0}, program: []uint16{
+		0x6007, // V0 = 7
+		0x6108, // V1 = 8
+		0x9010, // Skip if V0 != V1
+		0x6201, // V2 = 1
+		0x1208,
+	}},
+	{op: "ANNN", name: "set I", regs: map[string]int{"I": 0xABC}, program: []uint16{
+		0xAABC, // I = ABC
+		0x1202,
+	}},
+	{op: "BNNN", name: "plus V0", regs: map[string]int{"V1": 0, "V2": 2, "PC": 0x20A}, program: []uint16{
+		0x6004, // V0 = 4
+		0x6208, // V2 = 8
+		0xB204, // Jump to 204 + V0
+		0x6101, // V1 = 1
+		0x6202, // 208: V2 = 2
+		0x120A,
+	}},
+	{op: "BNNN", name: "jump quirk", quirks: Quirks{Jump: true}, regs: map[string]int{"V1": 0, "V2": 2, "PC": 0x20A}, program: []uint16{
+		0x6004, // V0 = 4
+		0x6204, // V2 = 4
+		0xB204, // Jump to 204 + V2
+		0x6101, // V1 = 1
+		0x6202, // 208: V2 = 2
+		0x120A,
+	}},
+	{op: "CXNN", name: "mask", program: []uint16{
+		0xC000, // V0 = random & 00
+		0xC10F, // V1 = random & 0F
+		0xC2F0, // V2 = random & F0
+		0x1206,
+	}, check: func(m *Machine) error {
+		if v := m.regs.v; v[0] != 0 || v[1]&0xF0 != 0 || v[2]&0x0F != 0 {
+			return fmt.Errorf("V0-V2 are %02X %02X %02X, outside their masks", v[0], v[1], v[2])
+		}
+		return nil
+	}},
+	{op: "DXYN", name: "draw", board: "DXYN_draw", regs: map[string]int{"VF": 0, "I": 0x10A}, program: []uint16{
+		0x6001, // V0 = 1
+		0x6102, // V1 = 2
+		0x6202, // V2 = 2
+		0xF229, // I = 2 of the font
+		0xD015, // Draw it at 1,2
+		0x120A,
+	}},
+	{op: "DXYN", name: "collision", board: "DXYN_collision", regs: map[string]int{"VF": 1}, program: []uint16{
+		0xA100, // I = 0 of the font
+		0xD005, // Draw it at 0,0
+		0x6002, // V0 = 2
+		0xD005, // Draw it at 2,2, over the first
+		0x1208,
+	}},
+	{op: "DXYN", name: "erase", regs: map[string]int{"VF": 1}, program: []uint16{
+		0xA100, // I = 0 of the font
+		0xD005, // Draw it at 0,0
+		0xD005, // Draw it again
+		0x1206,
+	}},
+	{op: "DXYN", name: "clip", board: "DXYN_clip", regs: map[string]int{"VF": 0}, program: []uint16{
+		0x603C, // V0 = 60
+		0x611F, // V1 = 31
+		0xA20A, // I = 20A
+		0xD012, // Draw 2 rows at 60,31
+		0x1208,
+		0xFFFF, // 20A
+	}},
+	{op: "DXYN", name: "wrap quirk", quirks: Quirks{Wrap: true}, board: "DXYN_wrap", regs: map[string]int{"VF": 0}, program: []uint16{
+		0x603C, // V0 = 60
+		0x611F, // V1 = 31
+		0xA20A, // I = 20A
+		0xD012, // Draw 2 rows at 60,31
+		0x1208,
+		0xFFFF, // 20A
+	}},
+	{op: "DXYN", name: "start modulo", board: "DXYN_modulo", program: []uint16{
+		0x6044, // V0 = 68
+		0x6122, // V1 = 34
+		0xA100, // I = 0 of the font
+		0xD015, // Draw it at 4,2
+		0x1208,
+	}},
+	{op: "DXYN", name: "vblank quirk", quirks: Quirks{VBlank: true}, board: "DXYN_vblank", frames: 3, program: []uint16{
+		0xA100, // I = 0 of the font
+		0xD005, // Draw it at 0,0, then wait for the next frame
+		0x6005, // V0 = 5
+		0xD005, // Draw it at 5,5
+		0x1208,
+	}},
+	{op: "EX9E", name: "held", keys: 1 << 0xA, regs: map[string]int{"V1": 0}, program: []uint16{
+		0x600A, // V0 = A
+		0xE09E, // Skip if key V0 is held
+		0x6101, // V1 = 1
+		0x1206,
+	}},
+	{op: "EX9E", name: "not held", keys: 1 << 0xB, regs: map[string]int{"V1": 1}, program: []uint16{
+		0x600A, // V0 = A
+		0xE09E, // Skip if key V0 is held
+		0x6101, // V1 = 1
+		0x1206,
+	}},
+	{op: "EXA1", name: "held", keys: 1 << 0xA, regs: map[string]int{"V1": 1}, program: []uint16{
+		0x600A, // V0 = A
+		0xE0A1, // Skip if key V0 is not held
+		0x6101, // V1 = 1
+		0x1206,
+	}},
+	{op: "EXA1", name: "not held", keys: 1 << 0xB, regs: map[string]int{"V1": 0}, program: []uint16{
+		0x600A, // V0 = A
+		0xE0A1, // Skip if key V0 is not held
+		0x6101, // V1 = 1
+		0x1206,
+	}},
+	{op: "FX07", name: "delay timer", regs: map[string]int{"V1": 7, "DT": 7}, program: []uint16{
+		0x6007, // V0 = 7
+		0xF015, // Delay timer = V0
+		0xF107, // V1 = delay timer
+		0x1206,
+	}},
+	{op: "FX07", name: "countdown", regs: map[string]int{"V1": 3, "DT": 3}, frames: 3, program: []uint16{
+		0x6005, // V0 = 5
+		0xF015, // Delay timer = V0
+		0xF107, // 204: V1 = delay timer
+		0x3103, // Skip if V1 == 3
+		0x1204, // Loop
+		0x120A,
+	}},
+	{op: "FX0A", name: "key", keys: 1<<7 | 1<<9, regs: map[string]int{"V3": 7}, program: []uint16{
+		0xF30A, // V3 = key
+		0x1202,
+	}},
+	{op: "FX0A", name: "wait", wait: true, regs: map[string]int{"V3": 0xFF, "PC": 0x202}, program: []uint16{
+		0x63FF, // V3 = FF
+		0xF30A, // V3 = key
+		0x1204,
+	}},
+	{op: "FX15", name: "delay timer", regs: map[string]int{"DT": 0x42}, program: []uint16{
+		0x6542, // V5 = 42
+		0xF515, // Delay timer = V5
+		0x1204,
+	}},
+	{op: "FX18", name: "sound timer", regs: map[string]int{"ST": 0x42}, program: []uint16{
+		0x6542, // V5 = 42
+		0xF518, // Sound timer = V5
+		0x1204,
+	}},
+	{op: "FX1E", name: "add to I", regs: map[string]int{"I": 0x310, "VF": 5}, program: []uint16{
+		0x6F05, // VF = 5
+		0x6010, // V0 = 10
+		0xA300, // I = 300
+		0xF01E, // I += V0
+		0x1208,
+	}},
+	{op: "FX29", name: "font", regs: map[string]int{"I": screenMemoryStart + 5*0xC}, program: []uint16{
+		0x640C, // V4 = C
+		0xF429, // I = C of the font
+		0x1204,
+	}},
+	{op: "FX33", name: "BCD", regs: map[string]int{"I": 0x300}, memory: map[int][]byte{0x300: {2, 5, 4}}, program: []uint16{
+		0x60FE, // V0 = 254
+		0xA300, // I = 300
+		0xF033, // BCD of V0
+		0x1206,
+	}},
+	{op: "FX33", name: "BCD small", memory: map[int][]byte{0x300: {0, 0, 7}}, program: []uint16{
+		0x6007, // V0 = 7
+		0xA300, // I = 300
+		0xF033, // BCD of V0
+		0x1206,
+	}},
+	{op: "FX55", name: "store", regs: map[string]int{"I": 0x303}, memory: map[int][]byte{0x300: {1, 2, 3, 0}}, program: storeProgram},
+	{op: "FX55", name: "increment by X quirk", quirks: Quirks{MemoryIncrementByX: true}, regs: map[string]int{"I": 0x302}, memory: map[int][]byte{0x300: {1, 2, 3, 0}}, program: storeProgram},
+	{op: "FX55", name: "leave I quirk", quirks: Quirks{MemoryLeaveIUnchanged: true}, regs: map[string]int{"I": 0x300}, memory: map[int][]byte{0x300: {1, 2, 3, 0}}, program: storeProgram},
+	{op: "FX65", name: "load", regs: map[string]int{"V0": 9, "V1": 8, "V2": 7, "V3": 0, "I": 0x303}, program: loadProgram},
+	{op: "FX65", name: "increment by X quirk", quirks: Quirks{MemoryIncrementByX: true}, regs: map[string]int{"V0": 9, "V1": 8, "V2": 7, "V3": 0, "I": 0x302}, program: loadProgram},
+	{op: "FX65", name: "leave I quirk", quirks: Quirks{MemoryLeaveIUnchanged: true}, regs: map[string]int{"V0": 9, "V1": 8, "V2": 7, "V3": 0, "I": 0x300}, program: loadProgram},
+}
+
+// storeProgram stores V0-V2 at 300
+var storeProgram = []uint16{
+	0x6001, // V0 = 1
+	0x6102, // V1 = 2
+	0x6203, // V2 = 3
+	0xA300, // I = 300
+	0xF255, // Store V0-V2
+	0x120A,
+}
+
+// loadProgram loads V0-V2 from 300, where 09 08 07 are stored
+var loadProgram = []uint16{
+	0x6009, // V0 = 9
+	0x6108, // V1 = 8
+	0x6207, // V2 = 7
+	0xA300, // I = 300
+	0xF255, // Store V0-V2
+	0x6000, // V0 = 0
+	0x6100, // V1 = 0
+	0x6200, // V2 = 0
+	0xA300, // I = 300
+	0xF265, // Load V0-V2
+	0x1214,
+}
+
+// run loads the program of a case into a new machine and runs it
+func (c *conformanceCase) run() (*Machine, error) {
+	m := NewMachine()
+	m.initSprites()
+	for i, word := range c.program {
+		m.memory[programCounterStart+2*i] = byte(word >> 8)
+		m.memory[programCounterStart+2*i+1] = byte(word)
+	}
+	m.Quirks = c.quirks
+	m.TickRate = 1000
+	m.Input = func(frame uint64, held uint16) uint16 { return c.keys }
+
+	for frame := 1; frame <= maxFrames; frame++ {
+		err := m.RunFrame()
+		switch {
+		case err == ErrStopped && c.wait:
+			return m, fmt.Errorf("stopped during frame %d, want it to wait", frame)
+		case err == ErrStopped && c.frames != 0 && frame != c.frames:
+			return m, fmt.Errorf("stopped during frame %d, want frame %d", frame, c.frames)
+		case err == ErrStopped:
+			return m, nil
+		case err != nil:
+			return m, err
+		}
+	}
+	if !c.wait {
+		return m, fmt.Errorf("still running after %d frames", maxFrames)
+	}
+	return m, nil
+}
+
+// registers returns the registers of the case, by name
+func registers(m *Machine) map[string]int {
+	regs := map[string]int{
+		"I":  int(m.regs.index),
+		"PC": int(m.regs.progCounter),
+		"DT": int(m.regs.delayTimer),
+		"ST": int(m.regs.soundTimer),
+		"SP": len(m.stack),
+	}
+	for i, v := range m.regs.v {
+		regs[fmt.Sprintf("V%X", i)] = int(v)
+	}
+	return regs
+}
+
+// boardText draws the board with a # for each pixel set, one line per row
+func boardText(b *Board) string {
+	var sb strings.Builder
+	for row := 0; row < b.Height(); row++ {
+		for col := 0; col < b.Width(); col++ {
+			if b.Pixel(row, col) > 0 {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// verify returns what the machine got wrong
+func (c *conformanceCase) verify(m *Machine) []string {
+	var wrong []string
+	regs := registers(m)
+	var names []string
+	for name := range c.regs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if got, want := regs[name], c.regs[name]; got != want {
+			wrong = append(wrong, fmt.Sprintf("%s is %#x, want %#x", name, got, want))
+		}
+	}
+	for addr, want := range c.memory {
+		if got := m.memory[addr : addr+len(want)]; string(got) != string(want) {
+			wrong = append(wrong, fmt.Sprintf("memory at %#x is % X, want % X", addr, got, want))
+		}
+	}
+	if c.check != nil {
+		if err := c.check(m); err != nil {
+			wrong = append(wrong, err.Error())
+		}
+	}
+
+	got := boardText(&m.board)
+	want := boardText(&Board{hires: m.board.hires})
+	if c.board != "" {
+		filename := filepath.Join("testdata", "conformance", c.board+".txt")
+		if *update {
+			if err := ioutil.WriteFile(filename, []byte(got), 0644); err != nil {
+				return append(wrong, err.Error())
+			}
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return append(wrong, err.Error())
+		}
+		want = string(data)
+	}
+	if got != want {
+		wrong = append(wrong, fmt.Sprintf("the board is\n%swant\n%s", got, want))
+	}
+	return wrong
+}
+
+// quirkList names the quirks set, for the report
+func quirkList(q Quirks) string {
+	var names []string
+	for i, flag := range q.flags() {
+		if *flag {
+			names = append(names, quirkNames[i])
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
+
+// TestConformance runs a small program per instruction and quirk, and
+// reports which instructions pass
+func TestConformance(t *testing.T) {
+	type result struct {
+		passed, total int
+		failed        []string
+	}
+	results := map[string]*result{}
+	var ops []string
+	for i := range conformanceCases {
+		c := &conformanceCases[i]
+		r := results[c.op]
+		if r == nil {
+			r = &result{}
+			results[c.op] = r
+			ops = append(ops, c.op)
+		}
+		r.total++
+		ok := t.Run(c.op+"/"+c.name, func(t *testing.T) {
+			m, err := c.run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, wrong := range c.verify(m) {
+				t.Error(wrong)
+			}
+		})
+		if ok {
+			r.passed++
+		} else {
+			r.failed = append(r.failed, fmt.Sprintf("%s (quirks %s)", c.name, quirkList(c.quirks)))
+		}
+	}
+
+	sort.Strings(ops)
+	var report strings.Builder
+	fmt.Fprintf(&report, "%-6s %-6s %s\n", "OPCODE", "PASSED", "FAILED")
+	for _, op := range ops {
+		r := results[op]
+		fmt.Fprintf(&report, "%-6s %d/%-4d %s\n", op, r.passed, r.total, strings.Join(r.failed, "; "))
+	}
+	t.Logf("conformance report:\n%s", report.String())
+}
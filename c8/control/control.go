@@ -0,0 +1,431 @@
+// Package control serves a local HTTP API driving the running machine, for
+// external tools and test harnesses. Every endpoint speaks JSON, except
+// for the PNG of the screen:
+//
+//	POST /rom        {"file": "c8games/BRIX"} loads and starts a ROM
+//	POST /pause      stops running frames
+//	POST /resume
+//	POST /reset      goes back to the state right after the ROM was read
+//	GET  /keys       {"keys": 16} the keys held through the API, as a mask
+//	POST /keys       {"press": [4], "release": [6]}
+//	GET  /memory     ?addr=0x200&length=16 gives {"addr": 512, "hex": "..."}
+//	POST /memory     {"addr": 512, "hex": "A2F0"} writes memory
+//	GET  /registers  c8.State
+//	POST /registers  the fields of c8.State to change, such as {"I": 768}
+//	GET  /screen     {"width": 64, "height": 32, "rows": ["..#..", ...]}
+//	GET  /screen.png
+//	GET  /state      c8.Snapshot
+//	POST /state      c8.Snapshot to restore
+//
+// Errors are answered with {"error": "..."}. POST requests must have the
+// Content-Type application/json, even those without a body, and the Host
+// of every request must be the address listened on, any address when
+// listening on every interface, or localhost when listening on it or on
+// every interface. Web pages of other sites can then neither post forms
+// to the API nor reach it through DNS rebinding.
+package control
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// LoadFunc loads a ROM and starts it on a new machine, which the frontend
+// must give to Attach before running it
+type LoadFunc func(filename string) error
+
+// Server is the HTTP API of the machines given to Attach, the last one
+// being driven
+type Server struct {
+	load    LoadFunc
+	palette c8.Palette
+	addr    string                            // Listened on
+	routes  map[string]map[string]handlerFunc // By path then method
+
+	mu     sync.Mutex
+	m      *c8.Machine
+	start  *c8.Snapshot  // Of m, right after its ROM was read
+	keys   uint16        // Held through the API
+	resume chan struct{} // Closed on resume, nil unless paused
+}
+
+// handlerFunc answers a request with a value to encode as JSON, or an
+// image to encode as PNG
+type handlerFunc func(m *c8.Machine, r *http.Request) (interface{}, error)
+
+// errNoMachine is answered while no ROM runs
+var errNoMachine = errors.New("no ROM is running")
+
+// NewServer generates a new Server listening on addr, such as the Addr of
+// its net.Listener, which loads ROMs with load and draws the PNG of the
+// screen with palette
+func NewServer(addr string, load LoadFunc, palette c8.Palette) *Server {
+	s := &Server{load: load, palette: palette, addr: addr}
+	s.routes = map[string]map[string]handlerFunc{
+		"/rom":        {"POST": s.postROM},
+		"/pause":      {"POST": s.postPause},
+		"/resume":     {"POST": s.postResume},
+		"/reset":      {"POST": s.postReset},
+		"/keys":       {"GET": s.getKeys, "POST": s.postKeys},
+		"/memory":     {"GET": getMemory, "POST": postMemory},
+		"/registers":  {"GET": getRegisters, "POST": postRegisters},
+		"/screen":     {"GET": getScreen},
+		"/screen.png": {"GET": s.getScreenPNG},
+		"/state":      {"GET": getState, "POST": postState},
+	}
+	return s
+}
+
+// Attach makes the API drive a machine which has just read its ROM. It
+// must be called before the machine runs.
+func (s *Server) Attach(m *c8.Machine) {
+	start := m.Snapshot()
+	next := m.Input
+	m.Input = func(frame uint64, keys uint16) uint16 {
+		if next != nil {
+			keys = next(frame, keys)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.m == m {
+			keys |= s.keys
+		}
+		return keys
+	}
+	m.AddFrameHook(func() error {
+		s.mu.Lock()
+		resume := s.resume
+		if s.m != m {
+			resume = nil
+		}
+		s.mu.Unlock()
+		if resume != nil {
+			<-resume
+		}
+		return nil
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releasePause()
+	s.m, s.start, s.keys = m, start, 0
+}
+
+// releasePause lets the machine run again. s.mu must be held.
+func (s *Server) releasePause() {
+	if s.resume != nil {
+		close(s.resume)
+		s.resume = nil
+	}
+}
+
+// statusError is an error answered with its own status
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return &statusError{http.StatusBadRequest, fmt.Errorf(format, a...)}
+}
+
+// ServeHTTP answers the requests of the API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.allowedHost(r.Host) {
+		writeError(w, &statusError{http.StatusForbidden, fmt.Errorf("host %q is not %s", r.Host, s.addr)})
+		return
+	}
+	methods, ok := s.routes[r.URL.Path]
+	if !ok {
+		writeError(w, &statusError{http.StatusNotFound, fmt.Errorf("no endpoint %s", r.URL.Path)})
+		return
+	}
+	h, ok := methods[r.Method]
+	if !ok {
+		writeError(w, &statusError{http.StatusMethodNotAllowed, fmt.Errorf("%s does not take %s", r.URL.Path, r.Method)})
+		return
+	}
+
+	if r.Method == "POST" {
+		if typ, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); typ != "application/json" {
+			writeError(w, &statusError{http.StatusUnsupportedMediaType, errors.New("POST wants the Content-Type application/json")})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	m := s.m
+	s.mu.Unlock()
+	if m == nil && r.URL.Path != "/rom" {
+		writeError(w, &statusError{http.StatusConflict, errNoMachine})
+		return
+	}
+	val, err := h(m, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if img, ok := val.(image.Image); ok {
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, img)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(val)
+}
+
+// allowedHost reports whether the Host of a request names the address
+// listened on. Addresses are safe from DNS rebinding, which needs a name.
+func (s *Server) allowedHost(host string) bool {
+	if host == s.addr {
+		return true
+	}
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return false
+	}
+	listenHost, listenPort, err := net.SplitHostPort(s.addr)
+	listenIP := net.ParseIP(listenHost)
+	if err != nil || port != listenPort || listenIP == nil {
+		return false
+	}
+	if name == "localhost" {
+		return listenIP.IsLoopback() || listenIP.IsUnspecified()
+	}
+	ip := net.ParseIP(name)
+	return ip != nil && (listenIP.IsUnspecified() || ip.Equal(listenIP))
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if se, ok := err.(*statusError); ok {
+		status = se.status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// decode reads the JSON body of a request into val
+func decode(r *http.Request, val interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(val); err != nil {
+		return badRequest("invalid body: %v", err)
+	}
+	return nil
+}
+
+// success is answered by the requests which only succeed or fail
+var success = map[string]bool{"ok": true}
+
+func (s *Server) postROM(m *c8.Machine, r *http.Request) (interface{}, error) {
+	var req struct {
+		File string `json:"file"`
+	}
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if req.File == "" {
+		return nil, badRequest("no file")
+	}
+	if err := s.load(req.File); err != nil {
+		return nil, err
+	}
+	return success, nil
+}
+
+func (s *Server) postPause(m *c8.Machine, r *http.Request) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resume == nil {
+		s.resume = make(chan struct{})
+	}
+	return success, nil
+}
+
+func (s *Server) postResume(m *c8.Machine, r *http.Request) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releasePause()
+	return success, nil
+}
+
+func (s *Server) postReset(m *c8.Machine, r *http.Request) (interface{}, error) {
+	s.mu.Lock()
+	start := s.start
+	s.keys = 0
+	s.mu.Unlock()
+	return success, m.Restore(start)
+}
+
+type keys struct {
+	Keys uint16 `json:"keys"`
+}
+
+func (s *Server) getKeys(m *c8.Machine, r *http.Request) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return keys{s.keys}, nil
+}
+
+func (s *Server) postKeys(m *c8.Machine, r *http.Request) (interface{}, error) {
+	var req struct {
+		Press   []int `json:"press"`
+		Release []int `json:"release"`
+	}
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	for _, key := range append(req.Press, req.Release...) {
+		if key < 0 || key > 0xF {
+			return nil, badRequest("there is no key %d", key)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range req.Press {
+		s.keys |= 1 << uint(key)
+	}
+	for _, key := range req.Release {
+		s.keys &^= 1 << uint(key)
+	}
+	return keys{s.keys}, nil
+}
+
+type memory struct {
+	Addr uint16 `json:"addr"`
+	Hex  string `json:"hex"`
+}
+
+func getMemory(m *c8.Machine, r *http.Request) (interface{}, error) {
+	addr, err := queryInt(r, "addr", 0)
+	if err != nil {
+		return nil, err
+	}
+	length, err := queryInt(r, "length", 0x1000)
+	if err != nil {
+		return nil, err
+	}
+	if addr < 0 || addr >= 0x1000 || length < 0 {
+		return nil, badRequest("invalid range %d+%d", addr, length)
+	}
+	return memory{uint16(addr), strings.ToUpper(hex.EncodeToString(m.Peek(uint16(addr), length)))}, nil
+}
+
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	val, err := strconv.ParseInt(s, 0, 32)
+	if err != nil {
+		return 0, badRequest("invalid %s %q", name, s)
+	}
+	return int(val), nil
+}
+
+func postMemory(m *c8.Machine, r *http.Request) (interface{}, error) {
+	var req memory
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(req.Hex)
+	if err != nil {
+		return nil, badRequest("invalid hex: %v", err)
+	}
+	if int(req.Addr)+len(data) > 0x1000 {
+		return nil, badRequest("%d bytes at %d go past the end of memory", len(data), req.Addr)
+	}
+	for i, b := range data {
+		m.Poke(req.Addr+uint16(i), b)
+	}
+	return success, nil
+}
+
+func getRegisters(m *c8.Machine, r *http.Request) (interface{}, error) {
+	return m.State(), nil
+}
+
+func postRegisters(m *c8.Machine, r *http.Request) (interface{}, error) {
+	// The fields missing from the body keep their value
+	state := m.State()
+	if err := decode(r, &state); err != nil {
+		return nil, err
+	}
+	m.SetState(state)
+	return m.State(), nil
+}
+
+// screen is the board as seen in a snapshot
+type screen struct {
+	Width  int      `json:"width"`
+	Height int      `json:"height"`
+	Rows   []string `json:"rows"` // # for lit pixels, . for the others
+	pixels []byte
+}
+
+func newScreen(m *c8.Machine) *screen {
+	snapshot := m.Snapshot()
+	sc := &screen{Width: c8.MaxBoardWidth / 2, Height: c8.MaxBoardHeight / 2}
+	if snapshot.Hires {
+		sc.Width, sc.Height = c8.MaxBoardWidth, c8.MaxBoardHeight
+	}
+	for row := 0; row < sc.Height; row++ {
+		line := snapshot.Board[row*c8.MaxBoardWidth : row*c8.MaxBoardWidth+sc.Width]
+		sc.pixels = append(sc.pixels, line...)
+		var text strings.Builder
+		for _, pixel := range line {
+			if pixel != 0 {
+				text.WriteByte('#')
+			} else {
+				text.WriteByte('.')
+			}
+		}
+		sc.Rows = append(sc.Rows, text.String())
+	}
+	return sc
+}
+
+func getScreen(m *c8.Machine, r *http.Request) (interface{}, error) {
+	return newScreen(m), nil
+}
+
+func (s *Server) getScreenPNG(m *c8.Machine, r *http.Request) (interface{}, error) {
+	sc := newScreen(m)
+	img := image.NewRGBA(image.Rect(0, 0, sc.Width, sc.Height))
+	for i, pixel := range sc.pixels {
+		img.SetRGBA(i%sc.Width, i/sc.Width, s.palette.Color(pixel))
+	}
+	return img, nil
+}
+
+func getState(m *c8.Machine, r *http.Request) (interface{}, error) {
+	return m.Snapshot(), nil
+}
+
+func postState(m *c8.Machine, r *http.Request) (interface{}, error) {
+	snapshot, err := c8.ReadSnapshot(r.Body)
+	if err != nil {
+		return nil, badRequest("invalid snapshot: %v", err)
+	}
+	if err := m.Restore(snapshot); err != nil {
+		return nil, badRequest("%v", err)
+	}
+	return success, nil
+}
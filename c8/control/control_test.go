@@ -0,0 +1,286 @@
+package control
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// testROM draws the 0 of the font at 5,3 then waits for a key
+var testROM = []byte{
+	0x60, 0x00, // V0 = 0
+	0xF0, 0x29, // I = sprite of V0
+	0x61, 0x05, // V1 = 5
+	0x62, 0x03, // V2 = 3
+	0xD1, 0x25, // Draw 5 rows at V1,V2
+	0xF3, 0x0A, // V3 = key
+	0x12, 0x0A, // Wait again
+}
+
+// newTestServer serves the API of a machine which ran a frame of testROM.
+// The ROMs loaded through the API are appended to loaded.
+func newTestServer(t *testing.T, loaded *[]string) (*c8.Machine, *Server, *httptest.Server) {
+	m := c8.NewMachine()
+	if err := m.LoadROM(bytes.NewReader(testROM)); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(nil)
+	load := func(filename string) error {
+		*loaded = append(*loaded, filename)
+		return nil
+	}
+	s := NewServer(ts.Listener.Addr().String(), load, c8.Palettes[0])
+	s.Attach(m)
+	if err := m.RunFrame(); err != nil {
+		t.Fatal(err)
+	}
+	ts.Config.Handler = s
+	ts.Start()
+	return m, s, ts
+}
+
+// call sends a request to the API and decodes its JSON answer into val,
+// returning the status
+func call(t *testing.T, ts *httptest.Server, method, path, body string, val interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method == "POST" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if val != nil {
+		if err := json.NewDecoder(resp.Body).Decode(val); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestEndpoints(t *testing.T) {
+	var loaded []string
+	m, _, ts := newTestServer(t, &loaded)
+	defer ts.Close()
+
+	var state c8.State
+	if call(t, ts, "POST", "/registers", `{"I": 768, "V": [1, 2]}`, &state) != http.StatusOK || state.I != 768 || state.V[1] != 2 {
+		t.Errorf("registers set to %+v", state)
+	}
+	if call(t, ts, "GET", "/registers", "", &state); state.I != 768 || state.PC != 0x20A {
+		t.Errorf("registers are %+v", state)
+	}
+
+	var mem memory
+	call(t, ts, "POST", "/memory", `{"addr": 768, "hex": "a2f0"}`, nil)
+	if call(t, ts, "GET", "/memory?addr=0x2FF&length=3", "", &mem); mem != (memory{0x2FF, "00A2F0"}) {
+		t.Errorf("memory is %+v", mem)
+	}
+
+	var k keys
+	if call(t, ts, "POST", "/keys", `{"press": [4, 6, 7], "release": [7]}`, &k); k.Keys != 1<<4|1<<6 {
+		t.Errorf("keys pressed are %04X", k.Keys)
+	}
+	if call(t, ts, "GET", "/keys", "", &k); k.Keys != 1<<4|1<<6 {
+		t.Errorf("keys held are %04X", k.Keys)
+	}
+	if keys := m.Input(1, 1); keys != 1|1<<4|1<<6 {
+		t.Errorf("machine reads the keys %04X", keys)
+	}
+
+	var sc screen
+	call(t, ts, "GET", "/screen", "", &sc)
+	if sc.Width != 64 || sc.Height != 32 || len(sc.Rows) != 32 || sc.Rows[3][5:9] != "####" || sc.Rows[4][5:9] != "#..#" {
+		t.Errorf("screen is %dx%d: %q", sc.Width, sc.Height, sc.Rows)
+	}
+	resp, err := http.Get(ts.URL + "/screen.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 32 || img.At(5, 3) == img.At(6, 4) {
+		t.Errorf("PNG is %v without the sprite", b)
+	}
+
+	// Save the state, change it and restore it
+	resp, err = http.Get(ts.URL + "/state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Poke(0x300, 0)
+	if status := call(t, ts, "POST", "/state", string(saved), nil); status != http.StatusOK || m.Peek(0x300, 1)[0] != 0xA2 {
+		t.Errorf("restoring the state answered %d", status)
+	}
+
+	if call(t, ts, "POST", "/reset", "", nil); m.State().I != 0 || m.State().PC != 0x200 {
+		t.Errorf("registers are %+v after reset", m.State())
+	}
+	if call(t, ts, "GET", "/keys", "", &k); k.Keys != 0 {
+		t.Errorf("keys %04X are held after reset", k.Keys)
+	}
+	if call(t, ts, "POST", "/rom", `{"file": "c8games/BRIX"}`, nil); !reflect.DeepEqual(loaded, []string{"c8games/BRIX"}) {
+		t.Errorf("loaded %q", loaded)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var loaded []string
+	_, _, ts := newTestServer(t, &loaded)
+	defer ts.Close()
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		err                string
+	}{
+		{"GET", "/nothing", "", http.StatusNotFound, "no endpoint /nothing"},
+		{"DELETE", "/keys", "", http.StatusMethodNotAllowed, "/keys does not take DELETE"},
+		{"POST", "/keys", `{"press": [16]}`, http.StatusBadRequest, "there is no key 16"},
+		{"POST", "/keys", `{"press": [4`, http.StatusBadRequest, "invalid body: unexpected EOF"},
+		{"GET", "/memory?addr=0x1000", "", http.StatusBadRequest, "invalid range 4096+4096"},
+		{"GET", "/memory?length=x", "", http.StatusBadRequest, `invalid length "x"`},
+		{"POST", "/memory", `{"addr": 4095, "hex": "0102"}`, http.StatusBadRequest, "2 bytes at 4095 go past the end of memory"},
+		{"POST", "/rom", `{}`, http.StatusBadRequest, "no file"},
+		{"POST", "/state", `{`, http.StatusBadRequest, "invalid snapshot: unexpected EOF"},
+	}
+	for _, test := range tests {
+		var resp struct {
+			Error string `json:"error"`
+		}
+		status := call(t, ts, test.method, test.path, test.body, &resp)
+		if status != test.status || resp.Error != test.err {
+			t.Errorf("%s %s answered %d %q, want %d %q", test.method, test.path, status, resp.Error, test.status, test.err)
+		}
+	}
+
+	empty := httptest.NewUnstartedServer(nil)
+	empty.Config.Handler = NewServer(empty.Listener.Addr().String(), nil, c8.Palettes[0])
+	empty.Start()
+	defer empty.Close()
+	if status := call(t, empty, "GET", "/registers", "", nil); status != http.StatusConflict {
+		t.Errorf("registers answered %d without a machine", status)
+	}
+}
+
+// Browsers can send text/plain to other sites without asking them first
+func TestContentType(t *testing.T) {
+	var loaded []string
+	_, _, ts := newTestServer(t, &loaded)
+	defer ts.Close()
+	for _, typ := range []string{"", "text/plain", "application/x-www-form-urlencoded", "multipart/form-data"} {
+		resp, err := http.Post(ts.URL+"/rom", typ, strings.NewReader(`{"file": "evil"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("POST of %q answered %d", typ, resp.StatusCode)
+		}
+	}
+	resp, err := http.Post(ts.URL+"/pause", "application/json; charset=utf-8", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(loaded) != 0 {
+		t.Errorf("POST of JSON answered %d, after loading %q", resp.StatusCode, loaded)
+	}
+}
+
+func TestHost(t *testing.T) {
+	var loaded []string
+	_, _, ts := newTestServer(t, &loaded)
+	defer ts.Close()
+	port := ts.URL[strings.LastIndex(ts.URL, ":"):]
+	for host, want := range map[string]int{
+		"127.0.0.1" + port:       http.StatusOK,
+		"localhost" + port:       http.StatusOK,
+		"evil.example" + port:    http.StatusForbidden,
+		"evil.example":           http.StatusForbidden,
+		"127.0.0.2" + port:       http.StatusForbidden,
+		"localhost:1" + port[1:]: http.StatusForbidden,
+	} {
+		req, err := http.NewRequest("GET", ts.URL+"/keys", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Host %q answered %d, want %d", host, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestAllowedHost(t *testing.T) {
+	tests := []struct {
+		addr, host string
+		want       bool
+	}{
+		{"[::]:8080", "192.168.1.2:8080", true},
+		{"[::]:8080", "localhost:8080", true},
+		{"[::]:8080", "[::1]:8080", true},
+		{"[::]:8080", "rebind.example:8080", false},
+		{"[::]:8080", "localhost:8081", false},
+		{"192.168.1.2:8080", "192.168.1.2:8080", true},
+		{"192.168.1.2:8080", "localhost:8080", false},
+		{"192.168.1.2:8080", "127.0.0.1:8080", false},
+	}
+	for _, test := range tests {
+		s := NewServer(test.addr, nil, c8.Palettes[0])
+		if got := s.allowedHost(test.host); got != test.want {
+			t.Errorf("listening on %s, Host %s allowed is %v", test.addr, test.host, got)
+		}
+	}
+}
+
+func TestPause(t *testing.T) {
+	var loaded []string
+	m, _, ts := newTestServer(t, &loaded)
+	defer ts.Close()
+	call(t, ts, "POST", "/pause", "", nil)
+
+	ran := make(chan error)
+	go func() { ran <- m.RunFrame() }()
+	select {
+	case <-ran:
+		t.Fatal("a frame ran while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	call(t, ts, "POST", "/resume", "", nil)
+	select {
+	case err := <-ran:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the frame did not finish after resume")
+	}
+}
@@ -0,0 +1,173 @@
+package c8
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ROMInfo is what the database knows about a ROM
+type ROMInfo struct {
+	SHA1        string
+	Title       string
+	Authors     []string
+	Release     string // Usually the year
+	Description string
+	Platform    string // ID of one of the Platforms
+	Quirks      Quirks
+	TickRate    int
+
+	// Keys maps the names of the community database, such as "up", "a"
+	// or "player2Left", to hex keys
+	Keys map[string]byte
+
+	// Colors are the pixel colours to draw the ROM with, if it has its own
+	Colors []string
+}
+
+// Database maps the SHA-1 of ROMs to their metadata. It reads the
+// programs.json format of the community chip-8-database, for example
+//
+//	[{
+//		"title": "Pong",
+//		"authors": ["Paul Vervalin"],
+//		"release": "1990",
+//		"roms": {
+//			"b232ef880bd6060fb45fa6effed7edf0ae95670e": {
+//				"file": "PONG",
+//				"platforms": ["originalChip8"],
+//				"quirkyPlatforms": {"originalChip8": {"vblank": false}},
+//				"tickrate": 10,
+//				"keys": {"up": 1, "down": 4, "player2Up": 12, "player2Down": 13},
+//				"colors": {"pixels": ["#000000", "#FFFFFF"]}
+//			}
+//		}
+//	}]
+//
+// A ROM gets the quirks of the first of its platforms found in Platforms,
+// changed by the quirkyPlatforms entry of that platform if any. ROMs for
+// none of them, such as MegaChip ones, are skipped. The tick rate defaults
+// to the one of the platform.
+type Database struct {
+	mu   sync.Mutex
+	roms map[string]*ROMInfo
+}
+
+type dbProgram struct {
+	Title       string           `json:"title"`
+	Authors     []string         `json:"authors"`
+	Release     string           `json:"release"`
+	Description string           `json:"description"`
+	ROMs        map[string]dbROM `json:"roms"`
+}
+
+type dbROM struct {
+	File            string                     `json:"file"`
+	Description     string                     `json:"description"`
+	Platforms       []string                   `json:"platforms"`
+	QuirkyPlatforms map[string]json.RawMessage `json:"quirkyPlatforms"`
+	TickRate        int                        `json:"tickrate"`
+	Keys            map[string]byte            `json:"keys"`
+	Colors          struct {
+		Pixels []string `json:"pixels"`
+	} `json:"colors"`
+}
+
+// DefaultDatabase is applied by LoadROM. It knows the bundled games and
+// can be extended with Load.
+var DefaultDatabase = mustLoadDatabase(builtinDatabase)
+
+// NewDatabase generates a new empty Database
+func NewDatabase() *Database {
+	return &Database{roms: map[string]*ROMInfo{}}
+}
+
+func mustLoadDatabase(data string) *Database {
+	db := NewDatabase()
+	if err := db.Load(strings.NewReader(data)); err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// Load adds the programs of a JSON file to the database, replacing the
+// ROMs it already had with the same hash
+func (db *Database) Load(r io.Reader) error {
+	var programs []dbProgram
+	if err := json.NewDecoder(r).Decode(&programs); err != nil {
+		return err
+	}
+
+	roms := map[string]*ROMInfo{}
+	for _, program := range programs {
+		for hash, rom := range program.ROMs {
+			info, err := program.resolve(strings.ToLower(hash), rom)
+			if err != nil {
+				return err
+			}
+			if info != nil {
+				roms[info.SHA1] = info
+			}
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for hash, info := range roms {
+		db.roms[hash] = info
+	}
+	return nil
+}
+
+// resolve returns the metadata of a ROM of the program, or nil when it
+// runs on none of the Platforms
+func (program dbProgram) resolve(hash string, rom dbROM) (*ROMInfo, error) {
+	var platform Platform
+	for _, id := range rom.Platforms {
+		if p, ok := FindPlatform(id); ok {
+			platform = p
+			break
+		}
+	}
+	if platform.ID == "" {
+		return nil, nil
+	}
+
+	info := &ROMInfo{
+		SHA1:        hash,
+		Title:       program.Title,
+		Authors:     program.Authors,
+		Release:     program.Release,
+		Description: program.Description,
+		Platform:    platform.ID,
+		Quirks:      platform.Quirks,
+		TickRate:    platform.TickRate,
+		Keys:        rom.Keys,
+		Colors:      rom.Colors.Pixels,
+	}
+	if rom.Description != "" {
+		info.Description = rom.Description
+	}
+	if rom.TickRate > 0 {
+		info.TickRate = rom.TickRate
+	}
+	if quirks, ok := rom.QuirkyPlatforms[platform.ID]; ok {
+		// Only the quirks given are changed
+		if err := json.Unmarshal(quirks, &info.Quirks); err != nil {
+			return nil, fmt.Errorf("ROM %s of %q: %v", hash, program.Title, err)
+		}
+	}
+	return info, nil
+}
+
+// Lookup returns the metadata of a ROM, or nil when it is unknown
+func (db *Database) Lookup(rom []byte) *ROMInfo {
+	sum := sha1.Sum(rom)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.roms[hex.EncodeToString(sum[:])]
+}
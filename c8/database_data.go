@@ -0,0 +1,29 @@
+package c8
+
+// builtinDatabase describes the games of the c8games directory, in the
+// format documented on Database
+const builtinDatabase = `[
+	{"title": "15 Puzzle", "authors": ["Roger Ivie"], "description": "Slide the numbered tiles into order.", "roms": {"ea9af3c09b0d9e265fcd92bcc5d51a2939fdf27a": {"file": "15PUZZLE", "platforms": ["originalChip8"]}}},
+	{"title": "Blinky", "authors": ["Hans Christian Egeberg"], "release": "1991", "description": "A Pac-Man clone.", "roms": {"d40abc54374e4343639f993e897e00904ddf85d9": {"file": "BLINKY", "platforms": ["chip48"], "keys": {"up": 3, "down": 6, "left": 7, "right": 8}}}},
+	{"title": "Blitz", "authors": ["David Winter"], "description": "Bomb the buildings to land the plane.", "roms": {"6f6509f38220e057a7e32ebb22dd353c1078e3e7": {"file": "BLITZ", "platforms": ["originalChip8"], "keys": {"a": 5}}}},
+	{"title": "Brix", "authors": ["Andreas Gustafsson"], "release": "1990", "description": "A Breakout clone.", "roms": {"f13766c14aeb02ad8d4d103cb5eadd282d20cddc": {"file": "BRIX", "platforms": ["originalChip8"], "keys": {"left": 4, "right": 6}}}},
+	{"title": "Connect 4", "authors": ["David Winter"], "roms": {"2d10c07b532f4fa7c07a07324ba26ca39fe484fd": {"file": "CONNECT4", "platforms": ["originalChip8"], "keys": {"left": 4, "right": 6, "a": 5}}}},
+	{"title": "Guess", "authors": ["David Winter"], "description": "Think of a number and the computer guesses it.", "roms": {"5260f8931e0e9f41e555b382a14a88368e3ed886": {"file": "GUESS", "platforms": ["originalChip8"]}}},
+	{"title": "Hidden", "authors": ["David Winter"], "release": "1996", "description": "Find the pairs of hidden cards.", "roms": {"050f07a54371da79f924dd0227b89d07b4f2aed0": {"file": "HIDDEN", "platforms": ["originalChip8"], "keys": {"up": 2, "down": 8, "left": 4, "right": 6, "a": 5}}}},
+	{"title": "Space Invaders", "authors": ["David Winter"], "roms": {"f100197f0f2f05b4f3c8c31ab9c2c3930d3e9571": {"file": "INVADERS", "platforms": ["chip48"], "keys": {"left": 4, "right": 6, "a": 5}}}},
+	{"title": "Kaleidoscope", "authors": ["Joseph Weisbecker"], "release": "1978", "roms": {"d6fa9dc9005dc0496f39ba52fef56f9fd0a5a158": {"file": "KALEID", "platforms": ["originalChip8"], "keys": {"up": 2, "down": 8, "left": 4, "right": 6, "a": 0}}}},
+	{"title": "Maze", "authors": ["David Winter"], "description": "Draws a random maze.", "roms": {"b9272ae1acdaaa79ab649f6b48b72088ca2b1d74": {"file": "MAZE", "platforms": ["originalChip8"]}}},
+	{"title": "Merlin", "authors": ["David Winter"], "description": "Repeat the sequence of squares.", "roms": {"d979858bb9ffd07b48f52f92a8bcac0199f3623e": {"file": "MERLIN", "platforms": ["originalChip8"]}}},
+	{"title": "Missile Command", "authors": ["David Winter"], "roms": {"0d0cc129dad3c45ba672f85fec71a668232212cc": {"file": "MISSILE", "platforms": ["originalChip8"], "keys": {"a": 8}}}},
+	{"title": "Pong", "authors": ["Paul Vervalin"], "release": "1990", "roms": {"b232ef880bd6060fb45fa6effed7edf0ae95670e": {"file": "PONG", "platforms": ["originalChip8"], "keys": {"up": 1, "down": 4, "player2Up": 12, "player2Down": 13}}}},
+	{"title": "Pong 2", "authors": ["David Winter"], "roms": {"a60611339661e3ab2d8af024ad1da5880a6f8665": {"file": "PONG2", "platforms": ["originalChip8"], "keys": {"up": 1, "down": 4, "player2Up": 12, "player2Down": 13}}}},
+	{"title": "Puzzle", "description": "Slide the tiles into order.", "roms": {"1293db0ccccbe7dd3fc5a09a2abc5d7b175e18e0": {"file": "PUZZLE", "platforms": ["originalChip8"]}}},
+	{"title": "Syzygy", "authors": ["Roy Trevino"], "release": "1990", "description": "A snake game.", "roms": {"1bdb4ddaa7049266fa3226851f28855a365cfd12": {"file": "SYZYGY", "platforms": ["originalChip8"], "keys": {"up": 3, "down": 6, "left": 7, "right": 8}}}},
+	{"title": "Tank", "roms": {"18b9d15f4c159e1f0ed58c2d8ec1d89325d3a3b6": {"file": "TANK", "platforms": ["originalChip8"], "keys": {"up": 2, "down": 8, "left": 4, "right": 6, "a": 5}}}},
+	{"title": "Tetris", "authors": ["Fran Dachille"], "release": "1991", "roms": {"5f518084744bf3cb8733f6e5454dfd1634320563": {"file": "TETRIS", "platforms": ["originalChip8"], "keys": {"left": 5, "right": 6, "a": 4, "down": 7}}}},
+	{"title": "Tic-Tac-Toe", "authors": ["David Winter"], "roms": {"429d455a4bc53167942bf6fd934d72b0f648dce3": {"file": "TICTAC", "platforms": ["originalChip8"]}}},
+	{"title": "UFO", "authors": ["Lutz V"], "release": "1992", "roms": {"bdb92475acfe11bc7814a2f5eade13fcd09b756a": {"file": "UFO", "platforms": ["originalChip8"], "keys": {"left": 4, "up": 5, "right": 6}}}},
+	{"title": "Vertical Brix", "authors": ["Paul Robson"], "release": "1996", "roms": {"da710f631f8e35534d0b9170bcf892a60f49c43d": {"file": "VBRIX", "platforms": ["originalChip8"], "keys": {"up": 1, "down": 4, "a": 7}}}},
+	{"title": "Vers", "authors": ["JMN"], "release": "1991", "description": "A two-player light cycle game.", "roms": {"ade839585ddeb0e3633177df03c1d91589e629eb": {"file": "VERS", "platforms": ["originalChip8"], "keys": {"up": 7, "down": 10, "left": 1, "right": 2, "player2Up": 12, "player2Down": 13, "player2Left": 11, "player2Right": 15}}}},
+	{"title": "Wipe Off", "authors": ["Joseph Weisbecker"], "roms": {"d666688a8fce468a7d88b536bc1ef5f35ba12031": {"file": "WIPEOFF", "platforms": ["originalChip8"], "keys": {"left": 4, "right": 6}}}}
+]`
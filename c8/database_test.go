@@ -0,0 +1,68 @@
+package c8
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDatabaseLoad(t *testing.T) {
+	rom := []byte{0x12, 0x00}
+	sum := sha1.Sum(rom)
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	tests := []struct {
+		name     string
+		rom      string // JSON of the ROM entry
+		platform string // Empty when the ROM is skipped
+		quirks   Quirks
+		tickRate int
+	}{
+		{"platform", `{"platforms": ["chip48"]}`, "chip48",
+			Quirks{Shift: true, MemoryIncrementByX: true, Jump: true}, 30},
+		{"quirky platform", `{"platforms": ["originalChip8"], "quirkyPlatforms": {"originalChip8": {"vblank": false, "wrap": true}}}`, "originalChip8",
+			Quirks{Logic: true, Wrap: true}, 15},
+		{"quirks of another platform", `{"platforms": ["xochip", "chip48"], "quirkyPlatforms": {"chip48": {"wrap": false}}}`, "xochip",
+			Quirks{Wrap: true}, 1000},
+		{"tick rate", `{"platforms": ["modernChip8"], "tickrate": 20}`, "modernChip8",
+			Quirks{}, 20},
+		{"unsupported platform first", `{"platforms": ["megachip8", "superchip"]}`, "superchip",
+			Quirks{Shift: true, MemoryLeaveIUnchanged: true, Jump: true}, 30},
+		{"unsupported platforms", `{"platforms": ["hybridVIP", "chip8x"], "tickrate": 20}`, "", Quirks{}, 0},
+		{"no platform", `{"platforms": []}`, "", Quirks{}, 0},
+	}
+	for _, test := range tests {
+		db := NewDatabase()
+		data := fmt.Sprintf(`[{"title": "Test", "roms": {%q: %s}}]`, hash, test.rom)
+		if err := db.Load(strings.NewReader(data)); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		info := db.Lookup(rom)
+		if test.platform == "" {
+			if info != nil {
+				t.Errorf("%s: the ROM is known for %s", test.name, info.Platform)
+			}
+			continue
+		}
+		if info == nil {
+			t.Errorf("%s: the ROM is unknown", test.name)
+			continue
+		}
+		if info.Title != "Test" || info.Platform != test.platform || info.Quirks != test.quirks || info.TickRate != test.tickRate {
+			t.Errorf("%s: the ROM is %s on %s with %+v at %d, want Test on %s with %+v at %d", test.name,
+				info.Title, info.Platform, info.Quirks, info.TickRate, test.platform, test.quirks, test.tickRate)
+		}
+	}
+
+	for _, data := range []string{
+		`{"title": "Test"}`,
+		`[{"title": "Test", "roms": {"00": {"platforms": ["chip48"], "quirkyPlatforms": {"chip48": {"wrap": 1}}}}}]`,
+	} {
+		if err := NewDatabase().Load(strings.NewReader(data)); err == nil {
+			t.Errorf("%s loaded", data)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package c8
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Detection is the platform Detect guessed for a ROM, and why
+type Detection struct {
+	Platform   Platform
+	Confidence float64 // Between 0 and 1
+	Reasons    []string
+}
+
+// extension is an instruction only some platforms have
+type extension struct {
+	platform string
+	name     string
+}
+
+// Detect guesses the platform of a ROM that is not in the database. It
+// follows the code reachable from 0x200 and looks for the instructions
+// SUPER-CHIP and XO-CHIP added. The size of the program is no evidence, as
+// memory ends at 0xFFF and LoadROM refuses programs larger than 3.5 KB.
+func Detect(rom []byte) Detection {
+	found := map[extension]uint16{} // First address each was seen at
+	reached := reachable(rom, func(addr, op, size uint16) {
+		if ext, ok := decodeExtension(op, size); ok {
+			if _, seen := found[ext]; !seen {
+				found[ext] = addr
+			}
+		}
+	})
+
+	var xochip, superchip []string
+	for ext, addr := range found {
+		reason := fmt.Sprintf("%s at 0x%03X", ext.name, addr)
+		if ext.platform == "xochip" {
+			xochip = append(xochip, reason)
+		} else {
+			superchip = append(superchip, reason)
+		}
+	}
+	sort.Strings(xochip)
+	sort.Strings(superchip)
+
+	switch {
+	case len(xochip) > 0:
+		return newDetection("xochip", evidenceConfidence(len(xochip)), append(xochip, superchip...))
+	case len(superchip) > 0:
+		return newDetection("superchip", evidenceConfidence(len(superchip)), superchip)
+	}
+	// Code that is only reached through BNNN or self-modification was not
+	// looked at, so the less code was reached the less sure the guess is
+	coverage := 1.0
+	if len(rom) > 0 {
+		coverage = math.Min(float64(2*reached)/float64(len(rom)), 1)
+	}
+	return newDetection("modernChip8", 0.5+0.4*coverage, []string{
+		fmt.Sprintf("no SUPER-CHIP or XO-CHIP instruction in the %d reachable instructions, %.0f%% of the program",
+			reached, 100*coverage),
+	})
+}
+
+func newDetection(platformID string, confidence float64, reasons []string) Detection {
+	platform, _ := FindPlatform(platformID)
+	return Detection{Platform: platform, Confidence: confidence, Reasons: reasons}
+}
+
+// evidenceConfidence grows with the number of kinds of evidence found
+func evidenceConfidence(kinds int) float64 {
+	return math.Min(0.6+0.15*float64(kinds-1), 0.95)
+}
+
+// reachable calls visit for every instruction reachable from the start of
+// the program, with its size in bytes, and returns how many there are
+func reachable(rom []byte, visit func(addr, op, size uint16)) int {
+	memory := make([]byte, memorySize+4)
+	copy(memory[programCounterStart:memorySize], rom)
+	word := func(addr uint16) uint16 {
+		return uint16(memory[addr])<<8 | uint16(memory[addr+1])
+	}
+	end := programCounterStart + len(rom)
+	// F000 stops the program, unless it is the XO-CHIP F000 NNNN followed
+	// by an address within the program
+	isLongLoad := func(addr uint16) bool {
+		return word(addr) == 0xF000 && int(addr)+4 <= end && int(word(addr+2)) < end
+	}
+
+	seen := map[uint16]bool{}
+	todo := []uint16{programCounterStart}
+	for len(todo) > 0 {
+		addr := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		if seen[addr] || addr >= memorySize-1 {
+			continue
+		}
+		seen[addr] = true
+
+		op := word(addr)
+		size := uint16(2)
+		if isLongLoad(addr) {
+			size = 4
+		}
+		visit(addr, op, size)
+		nnn := op & 0xFFF
+
+		switch {
+		case op == 0x00EE, op == 0x00FD, op&0xF0FF == 0xF000 && size == 2:
+			// Return, exit and stop end the path
+		case op>>12 == 0x1:
+			todo = append(todo, nnn)
+		case op>>12 == 0x2:
+			todo = append(todo, nnn, addr+size)
+		case op>>12 == 0xB:
+			// The target depends on a register
+		case op>>12 == 0x3, op>>12 == 0x4, op>>12 == 0x5, op>>12 == 0x9,
+			op&0xF0FF == 0xE09E, op&0xF0FF == 0xE0A1:
+			// A skip may jump over an XO-CHIP long instruction
+			skip := uint16(2)
+			if isLongLoad(addr + size) {
+				skip = 4
+			}
+			todo = append(todo, addr+size, addr+size+skip)
+		default:
+			todo = append(todo, addr+size)
+		}
+	}
+	return len(seen)
+}
+
+// decodeExtension returns the platform that added an instruction, if it is
+// not plain CHIP-8
+func decodeExtension(op, size uint16) (extension, bool) {
+	switch {
+	case op == 0x00FE || op == 0x00FF:
+		return extension{"superchip", fmt.Sprintf("%04X switches resolution", op)}, true
+	case op&0xFFF0 == 0x00C0:
+		return extension{"superchip", "00CN scrolls the display down"}, true
+	case op == 0x00FB || op == 0x00FC:
+		return extension{"superchip", fmt.Sprintf("%04X scrolls the display sideways", op)}, true
+	case op == 0x00FD:
+		return extension{"superchip", "00FD exits the interpreter"}, true
+	case op&0xF00F == 0xD000:
+		return extension{"superchip", "DXY0 draws a 16x16 sprite"}, true
+	case op&0xF0FF == 0xF030:
+		return extension{"superchip", "FX30 points I at a big font digit"}, true
+	case op&0xF0FF == 0xF075 || op&0xF0FF == 0xF085:
+		return extension{"superchip", fmt.Sprintf("FX%02X uses the RPL flags", op&0xFF)}, true
+	case op&0xFFF0 == 0x00D0:
+		return extension{"xochip", "00DN scrolls the display up"}, true
+	case op == 0xF000 && size == 4:
+		return extension{"xochip", "F000 NNNN loads a 16 bit address into I"}, true
+	case op&0xF0FF == 0xF001:
+		return extension{"xochip", "FN01 selects bit planes"}, true
+	case op == 0xF002:
+		return extension{"xochip", "F002 loads an audio pattern"}, true
+	case op&0xF0FF == 0xF03A:
+		return extension{"xochip", "FX3A sets the audio pitch"}, true
+	case op&0xF00F == 0x5002 || op&0xF00F == 0x5003:
+		return extension{"xochip", fmt.Sprintf("5XY%X saves or loads a range of registers", op&0xF)}, true
+	}
+	return extension{}, false
+}
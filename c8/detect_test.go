@@ -0,0 +1,75 @@
+package c8
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		rom      []byte
+		platform string
+		reasons  []string
+	}{
+		{"hires", []byte{0x00, 0xFF, 0x12, 0x02}, "superchip",
+			[]string{"00FF switches resolution at 0x200"}},
+		{"big sprite", []byte{0x60, 0x00, 0xD0, 0x00, 0x12, 0x04}, "superchip",
+			[]string{"DXY0 draws a 16x16 sprite at 0x202"}},
+		{"long load", []byte{0xF0, 0x00, 0x02, 0x00, 0x12, 0x04}, "xochip",
+			[]string{"F000 NNNN loads a 16 bit address into I at 0x200"}},
+		{"bit planes", []byte{0xF2, 0x01, 0x12, 0x02}, "xochip",
+			[]string{"FN01 selects bit planes at 0x200"}},
+		{"both", []byte{0x00, 0xFF, 0xF1, 0x01, 0x12, 0x04}, "xochip",
+			[]string{"FN01 selects bit planes at 0x202", "00FF switches resolution at 0x200"}},
+		// F000 without an address in the program is a stop
+		{"stop", []byte{0x60, 0x01, 0xF0, 0x00}, "modernChip8",
+			[]string{"no SUPER-CHIP or XO-CHIP instruction in the 2 reachable instructions, 100% of the program"}},
+		// 00FF is data jumped over
+		{"unreachable", []byte{0x12, 0x04, 0x00, 0xFF, 0x12, 0x04}, "modernChip8",
+			[]string{"no SUPER-CHIP or XO-CHIP instruction in the 2 reachable instructions, 67% of the program"}},
+		// A skip over F000 NNNN skips all four bytes
+		{"skip long load", []byte{0x30, 0x00, 0xF0, 0x00, 0x02, 0x00, 0x00, 0xFE, 0x12, 0x08}, "xochip",
+			[]string{"F000 NNNN loads a 16 bit address into I at 0x202", "00FE switches resolution at 0x206"}},
+	}
+	for _, test := range tests {
+		d := Detect(test.rom)
+		if d.Platform.ID != test.platform {
+			t.Errorf("%s: detected %s, want %s", test.name, d.Platform.ID, test.platform)
+		}
+		if got, want := strings.Join(d.Reasons, "; "), strings.Join(test.reasons, "; "); got != want {
+			t.Errorf("%s: reasons are %q, want %q", test.name, got, want)
+		}
+		if d.Confidence <= 0.5 || d.Confidence > 0.95 {
+			t.Errorf("%s: confidence is %v", test.name, d.Confidence)
+		}
+	}
+}
+
+func TestLoadROMDetection(t *testing.T) {
+	m := NewMachine()
+	if err := m.LoadROM(bytes.NewReader([]byte{0x00, 0xFF, 0x12, 0x02})); err != nil {
+		t.Fatal(err)
+	}
+	if d := m.Detection(); d == nil || d.Platform.ID != "superchip" {
+		t.Fatalf("detection is %+v, want superchip", d)
+	}
+	if m.Info() != nil || m.Quirks != m.Detection().Platform.Quirks {
+		t.Errorf("a detected ROM has info %+v and quirks %+v", m.Info(), m.Quirks)
+	}
+
+	// A ROM in the database is not detected
+	rom, err := ioutil.ReadFile("../c8games/MAZE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = NewMachine()
+	if err := m.LoadROM(bytes.NewReader(rom)); err != nil {
+		t.Fatal(err)
+	}
+	if m.Info() == nil || m.Detection() != nil {
+		t.Errorf("MAZE has info %+v and detection %+v", m.Info(), m.Detection())
+	}
+}
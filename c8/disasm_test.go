@@ -0,0 +1,63 @@
+package c8
+
+import "testing"
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		op   uint16
+		want string
+	}{
+		{0x0000, "NOP"},
+		{0x00E0, "CLS"},
+		{0x00EE, "RET"},
+		{0x0123, "SYS 0x123"},
+		{0x1ABC, "JP 0xABC"},
+		{0x2204, "CALL 0x204"},
+		{0x3A0F, "SE VA, 0x0F"},
+		{0x4B10, "SNE VB, 0x10"},
+		{0x5120, "SE V1, V2"},
+		{0x6EFF, "LD VE, 0xFF"},
+		{0x7301, "ADD V3, 0x01"},
+		{0x8120, "LD V1, V2"},
+		{0x8121, "OR V1, V2"},
+		{0x8122, "AND V1, V2"},
+		{0x8123, "XOR V1, V2"},
+		{0x8124, "ADD V1, V2"},
+		{0x8125, "SUB V1, V2"},
+		{0x8126, "SHR V1, V2"},
+		{0x8127, "SUBN V1, V2"},
+		{0x812E, "SHL V1, V2"},
+		{0x9450, "SNE V4, V5"},
+		{0xA300, "LD I, 0x300"},
+		{0xB200, "JP V0, 0x200"},
+		{0xC70F, "RND V7, 0x0F"},
+		{0xD12F, "DRW V1, V2, 15"},
+		{0xE59E, "SKP V5"},
+		{0xE5A1, "SKNP V5"},
+		{0xF000, "STOP"},
+		{0xF607, "LD V6, DT"},
+		{0xF60A, "LD V6, K"},
+		{0xF615, "LD DT, V6"},
+		{0xF618, "LD ST, V6"},
+		{0xF61E, "ADD I, V6"},
+		{0xF629, "LD F, V6"},
+		{0xF633, "LD B, V6"},
+		{0xF655, "LD [I], V6"},
+		{0xF665, "LD V6, [I]"},
+		// SUPER-CHIP
+		{0x00FE, "LOW"},
+		{0x00FF, "HIGH"},
+		{0xD120, "DRW V1, V2, 0"},
+		// Unknown opcodes are data
+		{0x5121, "DW 0x5121"},
+		{0x8128, "DW 0x8128"},
+		{0x945F, "DW 0x945F"},
+		{0xE500, "DW 0xE500"},
+		{0xF6FF, "DW 0xF6FF"},
+	}
+	for _, test := range tests {
+		if got := Disassemble(test.op); got != test.want {
+			t.Errorf("%04X disassembled to %q, want %q", test.op, got, test.want)
+		}
+	}
+}
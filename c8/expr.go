@@ -0,0 +1,363 @@
+package c8
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// View is what expressions see of a machine at the end of a frame
+type View struct {
+	Memory []byte
+	State  State
+}
+
+// View returns a copy of the memory and registers of the machine
+func (m *Machine) View() *View {
+	return &View{Memory: m.Peek(0, memorySize), State: m.State()}
+}
+
+// Expr is an integer expression on the memory and registers of a machine,
+// such as
+//
+//	byte 0x3F0 >= 10 and delta V5 > 0
+//
+// The operands are numbers, in decimal or 0x hex, the registers V0 to VF,
+// I, PC, DT, ST, the keys held and the frame number. byte and word read
+// memory at an address, big endian for word. delta is how much an operand
+// changed since the previous frame, and prev is its value at the previous
+// frame. The operators are, by increasing precedence:
+//
+//	or
+//	and
+//	not
+//	== != < <= > >=
+//	|
+//	&
+//	+ -
+//	* / %
+//	byte word delta prev and - as a prefix
+//
+// Comparisons and logic operators give 1 when true and 0 when false, and
+// any other value than 0 is true. and and or only evaluate their right
+// side when it decides the result. Dividing by 0 gives 0.
+type Expr struct {
+	src  string
+	eval evalFunc
+}
+
+// ExprNames gives the value of the names a language embedding expressions
+// adds to them, such as the variables of scripts. It returns nil and no
+// error for the names it does not know.
+type ExprNames func(name string) (func(now, prev *View) int, error)
+
+// ParseExpr parses an expression
+func ParseExpr(src string) (*Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	e, n, err := ParseExprTokens(tokens, nil)
+	if err != nil {
+		return nil, err
+	}
+	if n < len(tokens) {
+		return nil, fmt.Errorf("unexpected %q in %q", tokens[n], src)
+	}
+	e.src = src
+	return e, nil
+}
+
+// ParseExprTokens parses the expression at the start of tokens, which are
+// split and in lower case as ParseExpr has them. It stops before the first
+// token that does not continue the expression, and returns how many tokens
+// it used. names, when not nil, gives the value of the names that are
+// neither registers nor operators.
+func ParseExprTokens(tokens []string, names ExprNames) (*Expr, int, error) {
+	p := &exprParser{tokens: tokens, names: names}
+	eval, err := p.or()
+	if err != nil {
+		return nil, 0, err
+	}
+	return &Expr{src: strings.Join(tokens[:p.pos], " "), eval: eval}, p.pos, nil
+}
+
+// Eval evaluates the expression at the frame now, prev being the frame
+// before it. prev can be now for the first frame.
+func (e *Expr) Eval(now, prev *View) int {
+	return e.eval(now, prev)
+}
+
+// True reports whether the expression is not 0
+func (e *Expr) True(now, prev *View) bool {
+	return e.eval(now, prev) != 0
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+func tokenize(src string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			tokens = append(tokens, strings.ToLower(src[i:j]))
+			i = j
+		case strings.ContainsRune("=!<>", c) && i+1 < len(src) && src[i+1] == '=':
+			tokens = append(tokens, src[i:i+2])
+			i += 2
+		case strings.ContainsRune("<>|&+-*/%()", c):
+			tokens = append(tokens, src[i:i+1])
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", c, src)
+		}
+	}
+	return tokens, nil
+}
+
+type evalFunc func(now, prev *View) int
+
+type exprParser struct {
+	tokens []string
+	pos    int
+	names  ExprNames
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *exprParser) or() (evalFunc, error) {
+	left, err := p.and()
+	for err == nil && p.peek() == "or" {
+		p.next()
+		var right evalFunc
+		if right, err = p.and(); err == nil {
+			left = logic(left, right, false)
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) and() (evalFunc, error) {
+	left, err := p.not()
+	for err == nil && p.peek() == "and" {
+		p.next()
+		var right evalFunc
+		if right, err = p.not(); err == nil {
+			left = logic(left, right, true)
+		}
+	}
+	return left, err
+}
+
+func logic(left, right evalFunc, and bool) evalFunc {
+	return func(now, prev *View) int {
+		if (left(now, prev) != 0) == and {
+			return truth(right(now, prev) != 0)
+		}
+		return truth(!and)
+	}
+}
+
+func (p *exprParser) not() (evalFunc, error) {
+	if p.peek() != "not" {
+		return p.comparison()
+	}
+	p.next()
+	operand, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	return func(now, prev *View) int { return truth(operand(now, prev) == 0) }, nil
+}
+
+var comparisons = map[string]func(a, b int) bool{
+	"==": func(a, b int) bool { return a == b },
+	"!=": func(a, b int) bool { return a != b },
+	"<":  func(a, b int) bool { return a < b },
+	"<=": func(a, b int) bool { return a <= b },
+	">":  func(a, b int) bool { return a > b },
+	">=": func(a, b int) bool { return a >= b },
+}
+
+func (p *exprParser) comparison() (evalFunc, error) {
+	left, err := p.bitOr()
+	if err != nil {
+		return nil, err
+	}
+	compare, ok := comparisons[p.peek()]
+	if !ok {
+		return left, nil
+	}
+	p.next()
+	right, err := p.bitOr()
+	if err != nil {
+		return nil, err
+	}
+	return func(now, prev *View) int { return truth(compare(left(now, prev), right(now, prev))) }, nil
+}
+
+func (p *exprParser) bitOr() (evalFunc, error) {
+	left, err := p.bitAnd()
+	for err == nil && p.peek() == "|" {
+		p.next()
+		var right evalFunc
+		if right, err = p.bitAnd(); err == nil {
+			l := left
+			left = func(now, prev *View) int { return l(now, prev) | right(now, prev) }
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) bitAnd() (evalFunc, error) {
+	left, err := p.sum()
+	for err == nil && p.peek() == "&" {
+		p.next()
+		var right evalFunc
+		if right, err = p.sum(); err == nil {
+			l := left
+			left = func(now, prev *View) int { return l(now, prev) & right(now, prev) }
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) sum() (evalFunc, error) {
+	left, err := p.product()
+	for err == nil && (p.peek() == "+" || p.peek() == "-") {
+		sign := 1
+		if p.next() == "-" {
+			sign = -1
+		}
+		var right evalFunc
+		if right, err = p.product(); err == nil {
+			l := left
+			left = func(now, prev *View) int { return l(now, prev) + sign*right(now, prev) }
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) product() (evalFunc, error) {
+	left, err := p.unary()
+	for err == nil && (p.peek() == "*" || p.peek() == "/" || p.peek() == "%") {
+		op := p.next()
+		var right evalFunc
+		if right, err = p.unary(); err == nil {
+			l := left
+			left = func(now, prev *View) int {
+				a, b := l(now, prev), right(now, prev)
+				switch {
+				case op == "*":
+					return a * b
+				case b == 0:
+					return 0
+				case op == "/":
+					return a / b
+				}
+				return a % b
+			}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) unary() (evalFunc, error) {
+	op := p.peek()
+	switch op {
+	case "byte", "word", "delta", "prev", "-":
+		p.next()
+	default:
+		return p.primary()
+	}
+	operand, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "byte":
+		return func(now, prev *View) int { return int(now.Memory[operand(now, prev)&0xFFF]) }, nil
+	case "word":
+		return func(now, prev *View) int {
+			addr := operand(now, prev)
+			return int(now.Memory[addr&0xFFF])<<8 | int(now.Memory[(addr+1)&0xFFF])
+		}, nil
+	case "delta":
+		return func(now, prev *View) int { return operand(now, prev) - operand(prev, prev) }, nil
+	case "prev":
+		return func(now, prev *View) int { return operand(prev, prev) }, nil
+	}
+	return func(now, prev *View) int { return -operand(now, prev) }, nil
+}
+
+func (p *exprParser) primary() (evalFunc, error) {
+	token := p.next()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "(":
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return inner, nil
+	case "i":
+		return func(now, prev *View) int { return int(now.State.I) }, nil
+	case "pc":
+		return func(now, prev *View) int { return int(now.State.PC) }, nil
+	case "dt":
+		return func(now, prev *View) int { return int(now.State.DelayTimer) }, nil
+	case "st":
+		return func(now, prev *View) int { return int(now.State.SoundTimer) }, nil
+	case "keys":
+		return func(now, prev *View) int { return int(now.State.Keys) }, nil
+	case "frame":
+		return func(now, prev *View) int { return int(now.State.Frames) }, nil
+	}
+	if len(token) == 2 && token[0] == 'v' {
+		if x, err := strconv.ParseUint(token[1:], 16, 4); err == nil {
+			return func(now, prev *View) int { return int(now.State.V[x]) }, nil
+		}
+	}
+	if val, err := strconv.ParseInt(token, 0, 32); err == nil {
+		return func(now, prev *View) int { return int(val) }, nil
+	}
+	if p.names != nil {
+		eval, err := p.names(token)
+		if eval != nil || err != nil {
+			return eval, err
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q", token)
+}
+
+func truth(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
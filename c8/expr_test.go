@@ -0,0 +1,166 @@
+package c8
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testViews returns two frames in a row of a machine
+func testViews() (now, prev *View) {
+	prev = &View{Memory: make([]byte, memorySize)}
+	prev.State.V[5] = 3
+	prev.State.Frames = 9
+	prev.Memory[0x300] = 0x12
+
+	now = &View{Memory: make([]byte, memorySize)}
+	now.State.V[5] = 7
+	now.State.V[0xE] = 5
+	now.State.I = 0x300
+	now.State.PC = 0x248
+	now.State.DelayTimer = 60
+	now.State.SoundTimer = 2
+	now.State.Keys = 1<<4 | 1<<6
+	now.State.Frames = 10
+	now.Memory[0x300] = 0x34
+	now.Memory[0x301] = 0x56
+	now.Memory[0xFFF] = 0x78
+	now.Memory[0] = 0x9A
+	return now, prev
+}
+
+func TestExpr(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+	}{
+		// Operands
+		{"42", 42},
+		{"0x2A", 42},
+		{"V5", 7},
+		{"ve", 5},
+		{"I", 0x300},
+		{"PC", 0x248},
+		{"DT", 60},
+		{"st", 2},
+		{"keys", 0x50},
+		{"frame", 10},
+		{"byte 0x300", 0x34},
+		{"byte I", 0x34},
+		{"word 0x300", 0x3456},
+		{"word 0xFFF", 0x789A},
+		{"byte 0x1300", 0x34},
+		{"delta V5", 4},
+		{"delta frame", 1},
+		{"delta byte 0x300", 0x22},
+		{"prev V5", 3},
+		{"prev byte 0x300", 0x12},
+
+		// Precedence, from the lowest
+		{"1 or 0 and 0", 1},
+		{"(1 or 0) and 0", 0},
+		{"not 0 and 0", 0},
+		{"not 1 == 2", 1},
+		{"not not 5", 1},
+		{"1 + 1 == 2", 1},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 2 - 3", 5},
+		{"7 / 2 * 2", 6},
+		{"-V5 + 10", 3},
+		{"- -2", 2},
+		{"byte 0x2FF + 1", 1},
+		{"byte (0x2FF + 1)", 0x34},
+		{"6 | 3 & 5", 7},
+		{"(6 | 3) & 5", 5},
+		{"1 | 2 == 3", 1},
+		{"V5 & 1 + 1", 2},
+
+		// Arithmetic and comparisons
+		{"7 / 0", 0},
+		{"7 % 0", 0},
+		{"-7 / 2", -3},
+		{"-7 % 2", -1},
+		{"3 != 4", 1},
+		{"3 < 4", 1},
+		{"4 <= 4", 1},
+		{"3 > 4", 0},
+		{"3 >= 4", 0},
+		{"5 and 6", 1},
+		{"0 or 0", 0},
+		{"V5 >= 5 and delta V5 > 0", 1},
+		{"VE == 5 and delta VE > 0", 1},
+	}
+	now, prev := testViews()
+	for _, test := range tests {
+		e, err := ParseExpr(test.src)
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		if got := e.Eval(now, prev); got != test.want {
+			t.Errorf("%q is %d, want %d", test.src, got, test.want)
+		}
+		if e.True(now, prev) != (test.want != 0) {
+			t.Errorf("%q is not %v", test.src, test.want != 0)
+		}
+		if e.String() != test.src {
+			t.Errorf("%q prints as %q", test.src, e.String())
+		}
+	}
+
+	// Without a previous frame nothing changed
+	if e, _ := ParseExpr("delta V5"); e.Eval(now, now) != 0 {
+		t.Errorf("delta V5 is %d on the first frame", e.Eval(now, now))
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"1 + 2)",
+		"V5 = 3",
+		"VG",
+		"V10",
+		"1 $ 2",
+		"byte",
+		"not",
+		"1 2",
+		"0x1FFFFFFFF",
+		"1 |",
+		"& 1",
+		"x",
+	} {
+		if _, err := ParseExpr(src); err == nil {
+			t.Errorf("%q parsed", src)
+		}
+	}
+}
+
+func TestParseExprTokens(t *testing.T) {
+	names := func(name string) (func(now, prev *View) int, error) {
+		switch name {
+		case "x":
+			return func(now, prev *View) int { return 40 }, nil
+		case "y":
+			return nil, fmt.Errorf("y is unknown here")
+		}
+		return nil, nil
+	}
+	tokens := []string{"x", "+", "v5", "-", "5", "v0", "=", "1"}
+	e, n, err := ParseExprTokens(tokens, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now, prev := testViews()
+	if n != 5 || e.Eval(now, prev) != 42 || e.String() != "x + v5 - 5" {
+		t.Errorf("parsed %q of %d tokens as %d", e, n, e.Eval(now, prev))
+	}
+
+	for _, tokens := range [][]string{{"y"}, {"z"}, {"x", "+"}, {"="}} {
+		if _, _, err := ParseExprTokens(tokens, names); err == nil {
+			t.Errorf("%q parsed", tokens)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+//go:build go1.18
+// +build go1.18
+
+package c8
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// fuzzFrames is how long each ROM runs under each profile
+const fuzzFrames = 60
+
+// fuzzProfiles are the quirks every ROM runs with: those of a new machine,
+// then those of every platform
+func fuzzProfiles() []Platform {
+	return append([]Platform{{ID: "default", Quirks: DefaultQuirks, TickRate: defaultTickRate}}, Platforms...)
+}
+
+// FuzzROM loads random bytes as a ROM and runs them. Neither may panic,
+// and every frame must either go on or end with ErrStopped or a
+// *MemoryError.
+//
+//	go test -fuzz FuzzROM ./c8
+func FuzzROM(f *testing.F) {
+	games, err := filepath.Glob("../c8games/*")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, game := range games {
+		rom, err := ioutil.ReadFile(game)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(rom)
+	}
+	f.Add([]byte{0xAF, 0xFF, 0xFF, 0x55})                         // I = FFF, store V0-VF
+	f.Add([]byte{0xAF, 0xFF, 0xFF, 0x65})                         // I = FFF, load V0-VF
+	f.Add([]byte{0xAF, 0xFE, 0xF0, 0x33})                         // I = FFE, BCD of V0
+	f.Add([]byte{0xAF, 0xFC, 0xD0, 0x1F})                         // I = FFC, draw 15 rows
+	f.Add([]byte{0x60, 0xFF, 0xAF, 0xFF, 0xF0, 0x1E, 0x12, 0x04}) // Add to I forever
+	f.Add([]byte{0x1F, 0xFE})                                     // Jump to FFE, then run off the end
+	f.Add([]byte{0x6F, 0xFF, 0xBF, 0xFF})                         // Jump past the end
+	f.Add([]byte{0x22, 0x00})                                     // Call itself forever
+	f.Add([]byte{0x00, 0xEE})                                     // Return without a call
+
+	f.Fuzz(func(t *testing.T, rom []byte) {
+		if len(rom) > memorySize-programCounterStart {
+			rom = rom[:memorySize-programCounterStart]
+		}
+		for _, p := range fuzzProfiles() {
+			m := NewMachine()
+			if err := m.LoadROM(bytes.NewReader(rom)); err != nil {
+				t.Fatal(err)
+			}
+			m.Quirks, m.TickRate = p.Quirks, p.TickRate
+			m.SetSeed(1)
+			// Keys change every frame, to get past FX0A and EX9E
+			m.Input = func(frame uint64, held uint16) uint16 { return uint16(frame * 0x9E37) }
+
+			for frame := 0; frame < fuzzFrames; frame++ {
+				err := m.RunFrame()
+				if err == nil {
+					continue
+				}
+				if _, ok := err.(*MemoryError); !ok && err != ErrStopped {
+					t.Fatalf("%s: frame %d returned %v, of type %T", p.ID, frame, err, err)
+				}
+				break
+			}
+		}
+	})
+}
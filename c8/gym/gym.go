@@ -0,0 +1,258 @@
+// Package gym trains agents on CHIP-8 games through environments in the
+// style of OpenAI Gym. An environment is a headless machine which runs a
+// few frames with the keys of an action at every step, and rewards the
+// agent as told by an expression on its memory and registers.
+package gym
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"sync"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// Config describes the environments of a game
+type Config struct {
+	ROM string // File name
+
+	// Reward and Done are c8.Expr expressions, evaluated after every step
+	// with delta and prev referring to the state before the step. For
+	// BRIX, where V5 is the score and VE the balls left, they can be
+	// "delta V5" and "VE == 0".
+	Reward string
+	Done   string
+
+	// Actions are the keys held for each action, as bit masks. The
+	// default is no key then each of the 16 keys alone.
+	Actions []uint16
+
+	FrameSkip int    // Frames run per step, 4 by default
+	MaxFrames uint64 // An episode is done after that many frames, unless 0
+}
+
+// Observation is the board after a step, one byte per pixel, row after
+// row. 0 is off, other values are lit pixels of the XO-CHIP planes.
+type Observation struct {
+	Width, Height int
+	Pixels        []byte
+}
+
+// Bit reports whether a pixel is lit
+func (o *Observation) Bit(row, col int) bool {
+	return o.Pixels[row*o.Width+col] != 0
+}
+
+// RGB draws the observation with the colours of a palette
+func (o *Observation) RGB(p c8.Palette) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, o.Width, o.Height))
+	for row := 0; row < o.Height; row++ {
+		for col := 0; col < o.Width; col++ {
+			img.SetRGBA(col, row, p.Color(o.Pixels[row*o.Width+col]))
+		}
+	}
+	return img
+}
+
+// Env is an environment: a machine running a game for an agent
+type Env struct {
+	m         *c8.Machine
+	start     *c8.Snapshot // Right after the ROM was read
+	reward    *c8.Expr
+	done      *c8.Expr
+	actions   []uint16
+	frameSkip int
+	maxFrames uint64
+
+	keys    uint16 // Of the current action
+	display display
+	over    bool
+}
+
+// display keeps the board of the machine of an environment
+type display struct {
+	obs Observation
+}
+
+func (d *display) Refresh(b *c8.Board) {
+	d.obs.Width, d.obs.Height = b.Width(), b.Height()
+	d.obs.Pixels = d.obs.Pixels[:0]
+	for row := 0; row < b.Height(); row++ {
+		for col := 0; col < b.Width(); col++ {
+			d.obs.Pixels = append(d.obs.Pixels, b.Pixel(row, col))
+		}
+	}
+}
+
+// New generates a new environment, which must be reset before its first
+// step
+func New(cfg Config) (*Env, error) {
+	reward, err := c8.ParseExpr(cfg.Reward)
+	if err != nil {
+		return nil, fmt.Errorf("reward: %v", err)
+	}
+	done, err := c8.ParseExpr(cfg.Done)
+	if err != nil {
+		return nil, fmt.Errorf("done: %v", err)
+	}
+
+	e := &Env{
+		m:         c8.NewMachine(),
+		reward:    reward,
+		done:      done,
+		actions:   cfg.Actions,
+		frameSkip: cfg.FrameSkip,
+		maxFrames: cfg.MaxFrames,
+		over:      true,
+	}
+	if len(e.actions) == 0 {
+		e.actions = []uint16{0}
+		for key := uint(0); key < 16; key++ {
+			e.actions = append(e.actions, 1<<key)
+		}
+	}
+	if e.frameSkip <= 0 {
+		e.frameSkip = 4
+	}
+	file, err := os.Open(cfg.ROM)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := e.m.LoadROM(file); err != nil {
+		return nil, err
+	}
+	e.m.Display = &e.display
+	e.m.Input = func(frame uint64, held uint16) uint16 { return e.keys }
+	e.start = e.m.Snapshot()
+	return e, nil
+}
+
+// Actions returns the number of actions
+func (e *Env) Actions() int {
+	return len(e.actions)
+}
+
+// Reset starts a new episode, with the random numbers drawn from seed, and
+// returns the first observation
+func (e *Env) Reset(seed uint64) (Observation, error) {
+	if err := e.m.Restore(e.start); err != nil {
+		return Observation{}, err
+	}
+	e.m.SetSeed(seed)
+	e.keys = 0
+	e.over = false
+	e.display.obs = Observation{
+		Width:  c8.MaxBoardWidth / 2,
+		Height: c8.MaxBoardHeight / 2,
+		Pixels: make([]byte, c8.MaxBoardWidth/2*c8.MaxBoardHeight/2),
+	}
+	return e.observation(), nil
+}
+
+// Step holds the keys of an action for a few frames and returns what the
+// agent sees, its reward and whether the episode is done. Once it is done,
+// Step does nothing until Reset. It panics when the action is not between
+// 0 and Actions()-1.
+func (e *Env) Step(action int) (Observation, float64, bool) {
+	if action < 0 || action >= len(e.actions) {
+		panic(fmt.Sprintf("gym: action %d is not between 0 and %d", action, len(e.actions)-1))
+	}
+	if e.over {
+		return e.observation(), 0, true
+	}
+	e.keys = e.actions[action]
+
+	before := e.m.View()
+	for i := 0; i < e.frameSkip && !e.over; i++ {
+		if err := e.m.RunFrame(); err != nil {
+			// The game stopped by itself
+			e.over = true
+		}
+	}
+	after := e.m.View()
+	reward := float64(e.reward.Eval(after, before))
+	if e.done.True(after, before) || e.maxFrames > 0 && after.State.Frames >= e.maxFrames {
+		e.over = true
+	}
+	return e.observation(), reward, e.over
+}
+
+// observation returns a copy of the board
+func (e *Env) observation() Observation {
+	obs := e.display.obs
+	obs.Pixels = append([]byte(nil), obs.Pixels...)
+	return obs
+}
+
+// Vec runs many environments of the same game, stepping them in parallel
+type Vec struct {
+	Envs []*Env
+}
+
+// Result is the outcome of the step of an environment of a Vec
+type Result struct {
+	Observation Observation
+	Reward      float64
+	Done        bool
+}
+
+// NewVec generates n environments
+func NewVec(n int, cfg Config) (*Vec, error) {
+	v := &Vec{}
+	for i := 0; i < n; i++ {
+		env, err := New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		v.Envs = append(v.Envs, env)
+	}
+	return v, nil
+}
+
+// Reset resets every environment with its seed
+func (v *Vec) Reset(seeds []uint64) ([]Observation, error) {
+	if len(seeds) != len(v.Envs) {
+		return nil, fmt.Errorf("%d seeds for %d environments", len(seeds), len(v.Envs))
+	}
+	obs := make([]Observation, len(v.Envs))
+	errs := make([]error, len(v.Envs))
+	v.parallel(func(i int) { obs[i], errs[i] = v.Envs[i].Reset(seeds[i]) })
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("environment %d: %v", i, err)
+		}
+	}
+	return obs, nil
+}
+
+// Step steps every environment with its action, each in its own goroutine
+func (v *Vec) Step(actions []int) ([]Result, error) {
+	if len(actions) != len(v.Envs) {
+		return nil, fmt.Errorf("%d actions for %d environments", len(actions), len(v.Envs))
+	}
+	for _, action := range actions {
+		if action < 0 || action >= len(v.Envs[0].actions) {
+			return nil, fmt.Errorf("action %d is not between 0 and %d", action, len(v.Envs[0].actions)-1)
+		}
+	}
+	results := make([]Result, len(v.Envs))
+	v.parallel(func(i int) {
+		r := &results[i]
+		r.Observation, r.Reward, r.Done = v.Envs[i].Step(actions[i])
+	})
+	return results, nil
+}
+
+func (v *Vec) parallel(f func(i int)) {
+	var wg sync.WaitGroup
+	wg.Add(len(v.Envs))
+	for i := range v.Envs {
+		go func(i int) {
+			defer wg.Done()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
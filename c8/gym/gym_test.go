@@ -0,0 +1,173 @@
+package gym
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const brix = "../../c8games/BRIX"
+
+// episode resets an environment and steps it with actions, returning the
+// last observation and the rewards
+func episode(t *testing.T, e *Env, seed uint64, actions []int) (Observation, []float64) {
+	obs, err := e.Reset(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rewards []float64
+	for _, action := range actions {
+		var reward float64
+		obs, reward, _ = e.Step(action)
+		rewards = append(rewards, reward)
+	}
+	return obs, rewards
+}
+
+func TestResetSeed(t *testing.T) {
+	cfg := Config{ROM: brix, Reward: "delta V5", Done: "VE == 0"}
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Actions() != 17 {
+		t.Errorf("%d actions by default, want no key then each key", a.Actions())
+	}
+	var actions []int
+	for i := 0; i < 150; i++ {
+		actions = append(actions, []int{0, 5, 7}[i/10%3])
+	}
+
+	first, rewards := episode(t, a, 3, actions)
+	if first.Width != 64 || first.Height != 32 || len(first.Pixels) != 64*32 {
+		t.Fatalf("observation is %dx%d with %d pixels", first.Width, first.Height, len(first.Pixels))
+	}
+	for name, e := range map[string]*Env{"another environment": b, "the same environment": a} {
+		obs, again := episode(t, e, 3, actions)
+		if !reflect.DeepEqual(obs, first) || !reflect.DeepEqual(again, rewards) {
+			t.Errorf("%s played differently with the same seed", name)
+		}
+	}
+}
+
+func TestRewardDone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gym")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// V0 counts the frames: add 1, then jump back, every frame
+	rom := filepath.Join(dir, "rom")
+	if err := ioutil.WriteFile(rom, []byte{0x70, 0x01, 0x12, 0x00}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cfg     Config
+		rewards []float64
+		dones   []bool
+	}{
+		{
+			Config{ROM: rom, Reward: "delta frame", Done: "frame >= 8"},
+			[]float64{4, 4, 0},
+			[]bool{false, true, true},
+		},
+		{
+			Config{ROM: rom, Reward: "prev frame", Done: "0", FrameSkip: 5, MaxFrames: 12},
+			[]float64{0, 5, 10, 0},
+			[]bool{false, false, true, true},
+		},
+	}
+	for _, test := range tests {
+		e, err := New(test.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, done := e.Step(0); !done {
+			t.Errorf("an environment steps before its first reset")
+		}
+		if _, err := e.Reset(1); err != nil {
+			t.Fatal(err)
+		}
+		var rewards []float64
+		var dones []bool
+		for range test.rewards {
+			_, reward, done := e.Step(0)
+			rewards, dones = append(rewards, reward), append(dones, done)
+		}
+		if !reflect.DeepEqual(rewards, test.rewards) || !reflect.DeepEqual(dones, test.dones) {
+			t.Errorf("%+v rewarded %v and ended %v, want %v and %v", test.cfg, rewards, dones, test.rewards, test.dones)
+		}
+	}
+
+	for _, cfg := range []Config{
+		{ROM: rom, Reward: "delta", Done: "0"},
+		{ROM: rom, Reward: "0", Done: "V0 =="},
+		{ROM: rom + ".missing", Reward: "0", Done: "0"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%+v made an environment", cfg)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	v, err := NewVec(2, Config{ROM: brix, Reward: "delta V5", Done: "VE == 0", Actions: []uint16{0, 1 << 4, 1 << 6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := strings.Join([]string{
+		`{"cmd": "info"}`,
+		`{"cmd": "reset", "seeds": [1, 2]}`,
+		`{"cmd": "step", "actions": [1, 2]}`,
+		`{"cmd": "step", "actions": [3, 0]}`,
+		`{"cmd": "step", "actions": [0]}`,
+		`{"cmd": "quit"}`,
+		`not json`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := Serve(v, nil, strings.NewReader(requests), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []response
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var resp response
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, resp)
+	}
+	if len(responses) != 7 {
+		t.Fatalf("%d responses to 7 requests", len(responses))
+	}
+	if info := responses[0]; info.Envs != 2 || info.Actions != 3 {
+		t.Errorf("info answered %+v", info)
+	}
+	if reset := responses[1]; len(reset.Observations) != 2 || len(reset.Observations[0].Pixels) != 64*32 {
+		t.Errorf("reset answered %d observations", len(reset.Observations))
+	}
+	step := responses[2]
+	if len(step.Observations) != 2 || len(step.Rewards) != 2 || len(step.Dones) != 2 || step.Error != "" {
+		t.Errorf("step answered %+v", step)
+	}
+	for i, want := range []string{
+		"action 3 is not between 0 and 2",
+		"1 actions for 2 environments",
+		`unknown command "quit", want info, reset or step`,
+		"invalid character 'o' in literal null (expecting 'u')",
+	} {
+		if got := responses[3+i].Error; got != want {
+			t.Errorf("response %d is the error %q, want %q", 3+i, got, want)
+		}
+	}
+}
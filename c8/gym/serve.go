@@ -0,0 +1,116 @@
+package gym
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// request is a line read by Serve
+type request struct {
+	Cmd     string   `json:"cmd"`
+	Seeds   []uint64 `json:"seeds"`
+	Actions []int    `json:"actions"`
+}
+
+// response is a line written by Serve
+type response struct {
+	Envs         int           `json:"envs,omitempty"`
+	Actions      int           `json:"actions,omitempty"`
+	Observations []observation `json:"observations,omitempty"`
+	Rewards      []float64     `json:"rewards,omitempty"`
+	Dones        []bool        `json:"dones,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// observation is an Observation as sent by Serve
+type observation struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Pixels []byte `json:"pixels"` // Base64 in JSON
+}
+
+// Serve drives the environments of a Vec with one JSON request per line
+// read from r, answering each with one JSON line written to w, until r
+// ends. This lets programs in other languages, such as Python, train on
+// the games without cgo. The requests are
+//
+//	{"cmd": "info"}
+//	{"cmd": "reset", "seeds": [1, 2]}
+//	{"cmd": "step", "actions": [0, 5]}
+//
+// with a seed or an action per environment. info answers with the number
+// of environments and actions, reset with the observations, and step
+// with the observations, rewards and dones:
+//
+//	{"envs": 2, "actions": 17}
+//	{"observations": [{"width": 64, "height": 32, "pixels": "AAAB..."}, ...]}
+//	{"observations": [...], "rewards": [0, 1], "dones": [false, false]}
+//
+// The pixels are encoded in base64, one byte per pixel as in Observation,
+// or three bytes per pixel in the colours of palette when it is not nil.
+// Bad requests are answered with {"error": "..."}.
+func Serve(v *Vec, palette *c8.Palette, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		var req request
+		var resp response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp = v.handle(req, palette)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (v *Vec) handle(req request, palette *c8.Palette) response {
+	var resp response
+	switch req.Cmd {
+	case "info":
+		resp.Envs, resp.Actions = len(v.Envs), v.Envs[0].Actions()
+	case "reset":
+		obs, err := v.Reset(req.Seeds)
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		for i := range obs {
+			resp.Observations = append(resp.Observations, encode(&obs[i], palette))
+		}
+	case "step":
+		results, err := v.Step(req.Actions)
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		for i := range results {
+			resp.Observations = append(resp.Observations, encode(&results[i].Observation, palette))
+			resp.Rewards = append(resp.Rewards, results[i].Reward)
+			resp.Dones = append(resp.Dones, results[i].Done)
+		}
+	default:
+		resp.Error = fmt.Sprintf("unknown command %q, want info, reset or step", req.Cmd)
+	}
+	return resp
+}
+
+func encode(obs *Observation, palette *c8.Palette) observation {
+	o := observation{Width: obs.Width, Height: obs.Height, Pixels: obs.Pixels}
+	if palette != nil {
+		o.Pixels = obs.RGB(*palette).Pix
+		// Drop the alpha
+		rgb := make([]byte, 0, obs.Width*obs.Height*3)
+		for i := 0; i < len(o.Pixels); i += 4 {
+			rgb = append(rgb, o.Pixels[i:i+3]...)
+		}
+		o.Pixels = rgb
+	}
+	return o
+}
@@ -0,0 +1,325 @@
+package c8
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	movieMagic   = "C8MV"
+	movieVersion = 1
+)
+
+// Movie is a recording of the keys held during a run of a ROM, from the
+// moment it was read. Replaying it on the same ROM, with the same seed and
+// quirks, runs every frame exactly as recorded.
+type Movie struct {
+	ROMHash  string // SHA-1 in hex
+	Seed     uint64
+	Quirks   Quirks
+	TickRate int
+	Inputs   []MovieInput // Keypad changes, by frame
+	Frames   uint64       // Length of the recording
+	Checksum uint32       // Of the snapshot taken after the last frame, 0 when unknown
+}
+
+// MovieInput is a change of the keys held
+type MovieInput struct {
+	Frame uint64 // From which on the keys are held
+	Keys  uint16
+}
+
+// DesyncError is returned when a replay ends in another state than the
+// recording did
+type DesyncError struct {
+	Frame     uint64
+	Want, Got uint32 // Checksums
+}
+
+func (e *DesyncError) Error() string {
+	return fmt.Sprintf("replay desynchronised at frame %d: checksum %08X, want %08X", e.Frame, e.Got, e.Want)
+}
+
+// ErrNotMovie is returned by ReadMovie for files that are not movies
+var ErrNotMovie = errors.New("not a CHIP-8 movie")
+
+// KeysAt returns the keys held during a frame
+func (mv *Movie) KeysAt(frame uint64) uint16 {
+	i := sort.Search(len(mv.Inputs), func(i int) bool { return mv.Inputs[i].Frame > frame })
+	if i == 0 {
+		return 0
+	}
+	return mv.Inputs[i-1].Keys
+}
+
+// Recorder records the keys of a machine into a movie
+type Recorder struct {
+	mu    sync.Mutex
+	movie Movie
+}
+
+// NewRecorder starts recording a machine which has just read its ROM. It
+// must be called before the machine runs.
+func NewRecorder(m *Machine) *Recorder {
+	r := &Recorder{movie: Movie{
+		ROMHash:  m.ROMHash(),
+		Seed:     m.Seed(),
+		Quirks:   m.Quirks,
+		TickRate: m.TickRate,
+	}}
+	next := m.Input
+	m.Input = func(frame uint64, keys uint16) uint16 {
+		if next != nil {
+			keys = next(frame, keys)
+		}
+		r.record(frame, keys)
+		return keys
+	}
+	return r
+}
+
+func (r *Recorder) record(frame uint64, keys uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inputs := r.movie.Inputs
+	// Frames run again after a restore replace what was recorded for them
+	for len(inputs) > 0 && inputs[len(inputs)-1].Frame >= frame {
+		inputs = inputs[:len(inputs)-1]
+	}
+	if len(inputs) == 0 && keys == 0 || len(inputs) > 0 && inputs[len(inputs)-1].Keys == keys {
+		r.movie.Inputs = inputs
+		return
+	}
+	r.movie.Inputs = append(inputs, MovieInput{Frame: frame, Keys: keys})
+}
+
+// Movie returns the recording up to the last frame the machine ran. The
+// machine must not be running a frame.
+func (r *Recorder) Movie(m *Machine) *Movie {
+	snapshot := m.Snapshot()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	mv := r.movie
+	mv.Frames = snapshot.Frames
+	mv.Checksum = snapshot.Checksum()
+	mv.Inputs = nil
+	for _, in := range r.movie.Inputs {
+		if in.Frame <= mv.Frames {
+			mv.Inputs = append(mv.Inputs, in)
+		}
+	}
+	return &mv
+}
+
+// Player replays a movie on a machine
+type Player struct {
+	movie *Movie
+	mu    sync.Mutex
+	done  bool
+}
+
+// Prepare gives a machine which has just read the ROM of the movie the
+// seed, quirks and tick rate the movie was recorded with. NewPlayer does it
+// too, calling Prepare first lets whatever is attached to the machine
+// before the player see it as it will be when the movie starts.
+func (mv *Movie) Prepare(m *Machine) error {
+	if m.ROMHash() != mv.ROMHash {
+		return fmt.Errorf("movie is for ROM %s, not %s", mv.ROMHash, m.ROMHash())
+	}
+	m.SetSeed(mv.Seed)
+	m.Quirks = mv.Quirks
+	m.TickRate = mv.TickRate
+	return nil
+}
+
+// NewPlayer makes a machine which has just read the ROM of the movie play
+// it back. The machine takes the seed and quirks of the movie. Once the
+// movie ends the keys held on the keypad are used again, and the state of
+// the machine is checked against the checksum of the movie, if it has one:
+// the machine stops with a DesyncError when they differ.
+func NewPlayer(m *Machine, mv *Movie) (*Player, error) {
+	if err := mv.Prepare(m); err != nil {
+		return nil, err
+	}
+
+	p := &Player{movie: mv}
+	next := m.Input
+	m.Input = func(frame uint64, keys uint16) uint16 {
+		if frame <= mv.Frames {
+			return mv.KeysAt(frame)
+		}
+		if next != nil {
+			keys = next(frame, keys)
+		}
+		return keys
+	}
+	m.AddFrameHook(func() error {
+		if p.Done() || m.State().Frames < mv.Frames {
+			return nil
+		}
+		p.mu.Lock()
+		p.done = true
+		p.mu.Unlock()
+		if mv.Checksum == 0 {
+			return nil
+		}
+		snapshot := m.Snapshot()
+		if sum := snapshot.Checksum(); sum != mv.Checksum {
+			return &DesyncError{Frame: snapshot.Frames, Want: mv.Checksum, Got: sum}
+		}
+		return nil
+	})
+	return p, nil
+}
+
+// Done reports whether the whole movie was played and matched
+func (p *Player) Done() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.done
+}
+
+// Write saves the movie in its compact binary format: a header with the
+// ROM hash, seed, tick rate and quirks, then every keypad change as the
+// number of frames since the previous one and the keys, then the length
+// and the checksum.
+func (mv *Movie) Write(w io.Writer) error {
+	hash, err := hex.DecodeString(mv.ROMHash)
+	if err != nil || len(hash) != 20 {
+		return fmt.Errorf("invalid ROM hash %q", mv.ROMHash)
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(movieMagic)
+	bw.WriteByte(movieVersion)
+	bw.Write(hash)
+	writeUint(bw, mv.Seed, 8)
+	writeUint(bw, uint64(mv.TickRate), 2)
+	bw.WriteByte(mv.Quirks.bits())
+	writeUvarint(bw, uint64(len(mv.Inputs)))
+	var frame uint64
+	for _, in := range mv.Inputs {
+		writeUvarint(bw, in.Frame-frame)
+		writeUint(bw, uint64(in.Keys), 2)
+		frame = in.Frame
+	}
+	writeUvarint(bw, mv.Frames)
+	writeUint(bw, uint64(mv.Checksum), 4)
+	return bw.Flush()
+}
+
+// ReadMovie reads a movie saved by Write
+func ReadMovie(r io.Reader) (*Movie, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(movieMagic)+1+20)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrNotMovie
+	}
+	if string(header[:len(movieMagic)]) != movieMagic {
+		return nil, ErrNotMovie
+	}
+	if version := header[len(movieMagic)]; version != movieVersion {
+		return nil, fmt.Errorf("movie version %d is not supported", version)
+	}
+
+	mv := &Movie{ROMHash: hex.EncodeToString(header[len(movieMagic)+1:])}
+	var tickRate uint64
+	var quirks byte
+	var count uint64
+	err := readAll(
+		func() (err error) { mv.Seed, err = readUint(br, 8); return },
+		func() (err error) { tickRate, err = readUint(br, 2); return },
+		func() (err error) { quirks, err = br.ReadByte(); return },
+		func() (err error) { count, err = binary.ReadUvarint(br); return },
+	)
+	if err != nil {
+		return nil, err
+	}
+	mv.TickRate = int(tickRate)
+	mv.Quirks = quirksFromBits(quirks)
+
+	var frame uint64
+	for i := uint64(0); i < count; i++ {
+		delta, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := readUint(br, 2)
+		if err != nil {
+			return nil, err
+		}
+		frame += delta
+		mv.Inputs = append(mv.Inputs, MovieInput{Frame: frame, Keys: uint16(keys)})
+	}
+
+	var checksum uint64
+	err = readAll(
+		func() (err error) { mv.Frames, err = binary.ReadUvarint(br); return },
+		func() (err error) { checksum, err = readUint(br, 4); return },
+	)
+	if err != nil {
+		return nil, err
+	}
+	mv.Checksum = uint32(checksum)
+	return mv, nil
+}
+
+func readAll(reads ...func() error) error {
+	for _, read := range reads {
+		if err := read(); err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func writeUint(w *bufio.Writer, val uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		w.WriteByte(byte(val >> (8 * uint(i))))
+	}
+}
+
+func readUint(r *bufio.Reader, size int) (uint64, error) {
+	var val uint64
+	for i := 0; i < size; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		val = val<<8 | uint64(b)
+	}
+	return val, nil
+}
+
+func writeUvarint(w *bufio.Writer, val uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	w.Write(buf[:binary.PutUvarint(buf, val)])
+}
+
+// bits packs the quirks into a byte, in the order of quirkNames
+func (q Quirks) bits() byte {
+	var b byte
+	for i, set := range q.flags() {
+		if *set {
+			b |= 1 << uint(i)
+		}
+	}
+	return b
+}
+
+func quirksFromBits(b byte) Quirks {
+	var q Quirks
+	for i, set := range q.flags() {
+		*set = b&(1<<uint(i)) != 0
+	}
+	return q
+}
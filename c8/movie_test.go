@@ -0,0 +1,117 @@
+package c8
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// loadGame reads one of the bundled games into a new machine
+func loadGame(t *testing.T, name string) *Machine {
+	rom, err := ioutil.ReadFile("../c8games/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMachine()
+	if err := m.LoadROM(bytes.NewReader(rom)); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// recordBrix plays BRIX moving the paddle left, then right, and returns
+// the recording. The paddle only moves once the bricks are drawn.
+func recordBrix(t *testing.T) *Movie {
+	m := loadGame(t, "BRIX")
+	m.SetSeed(7)
+	m.Input = func(frame uint64, held uint16) uint16 {
+		switch {
+		case frame > 200 && frame <= 230:
+			return 1 << 4
+		case frame > 260 && frame <= 280:
+			return 1 << 6
+		}
+		return 0
+	}
+	r := NewRecorder(m)
+	for i := 0; i < 300; i++ {
+		if err := m.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r.Movie(m)
+}
+
+// replay plays a movie on a new machine, returning the error it ended with
+func replay(t *testing.T, mv *Movie) (*Machine, *Player, error) {
+	m := loadGame(t, "BRIX")
+	p, err := NewPlayer(m, mv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < mv.Frames; i++ {
+		if err := m.RunFrame(); err != nil {
+			return m, p, err
+		}
+	}
+	return m, p, nil
+}
+
+func TestMovieReplay(t *testing.T) {
+	mv := recordBrix(t)
+	want := []MovieInput{{Frame: 201, Keys: 1 << 4}, {Frame: 231, Keys: 0}, {Frame: 261, Keys: 1 << 6}, {Frame: 281, Keys: 0}}
+	if !reflect.DeepEqual(mv.Inputs, want) {
+		t.Errorf("recorded %+v, want %+v", mv.Inputs, want)
+	}
+	if mv.Seed != 7 || mv.Frames != 300 || mv.Checksum == 0 {
+		t.Errorf("recorded seed %d, %d frames and checksum %08X", mv.Seed, mv.Frames, mv.Checksum)
+	}
+
+	var buf bytes.Buffer
+	if err := mv.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadMovie(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, mv) {
+		t.Fatalf("read back %+v, want %+v", read, mv)
+	}
+
+	m, p, err := replay(t, read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Done() {
+		t.Errorf("the player is not done after the whole movie")
+	}
+	if sum := m.Snapshot().Checksum(); sum != mv.Checksum {
+		t.Errorf("replay ended with checksum %08X, want %08X", sum, mv.Checksum)
+	}
+}
+
+func TestMovieDesync(t *testing.T) {
+	mv := recordBrix(t)
+	// Never move right
+	mv.Inputs[2].Keys = 0
+	_, p, err := replay(t, mv)
+	desync, ok := err.(*DesyncError)
+	if !ok {
+		t.Fatalf("replaying another key returned %v", err)
+	}
+	if desync.Frame != mv.Frames || desync.Want != mv.Checksum {
+		t.Errorf("desync is %+v, want frame %d and checksum %08X", desync, mv.Frames, mv.Checksum)
+	}
+	if !p.Done() {
+		t.Errorf("the player is not done after the whole movie")
+	}
+}
+
+func TestMovieOtherROM(t *testing.T) {
+	mv := recordBrix(t)
+	if _, err := NewPlayer(loadGame(t, "PONG"), mv); err == nil {
+		t.Errorf("a movie of BRIX played on PONG")
+	}
+}
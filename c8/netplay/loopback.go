@@ -0,0 +1,78 @@
+package netplay
+
+import (
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// Link is the network simulated between the peers of Loopback
+type Link struct {
+	Latency time.Duration // Of every packet, one way
+	Loss    float64       // Fraction of the packets dropped, between 0 and 1
+}
+
+// Loopback links two machines which have just read the same ROM over UDP
+// on 127.0.0.1, through a link with the given latency and loss, to try out
+// netplay and its rollbacks in one process. a is player 1 and b player 2,
+// both must run for either to go further than a few frames.
+func Loopback(a, b *c8.Machine, cfg Config, link Link) (*Session, *Session, error) {
+	connA, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+	connB, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		connA.Close()
+		return nil, nil, err
+	}
+
+	type result struct {
+		s   *Session
+		err error
+	}
+	done := make(chan result)
+	cfgA, cfgB := cfg, cfg
+	cfgA.Player, cfgB.Player = 1, 2
+	go func() {
+		s, err := Connect(a, &linkConn{connA, link}, connB.LocalAddr(), cfgA)
+		done <- result{s, err}
+	}()
+	sb, errB := Connect(b, &linkConn{connB, link}, connA.LocalAddr(), cfgB)
+	if errB != nil {
+		// Player 1 is still waiting
+		connA.Close()
+	}
+	ra := <-done
+	if ra.err != nil || errB != nil {
+		connA.Close()
+		connB.Close()
+		if errB != nil {
+			return nil, nil, errB
+		}
+		return nil, nil, ra.err
+	}
+	return ra.s, sb, nil
+}
+
+// linkConn sends its packets through a Link
+type linkConn struct {
+	net.PacketConn
+	link Link
+}
+
+func (c *linkConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if c.link.Loss > 0 && rand.Float64() < c.link.Loss {
+		return len(b), nil
+	}
+	if c.link.Latency <= 0 {
+		return c.PacketConn.WriteTo(b, addr)
+	}
+	b = append([]byte(nil), b...)
+	time.AfterFunc(c.link.Latency, func() {
+		c.PacketConn.WriteTo(b, addr)
+	})
+	return len(b), nil
+}
@@ -0,0 +1,452 @@
+// Package netplay lets two players on two machines play a game for two,
+// such as PONG2 or TANK, over UDP. Each machine runs the game with the keys
+// of both players, the keys of a player being the OR of what both hold.
+//
+// The peers send each other their keys of every frame. While the keys of
+// the other player for a frame have not arrived, they are predicted to be
+// the last ones received. When a prediction turns out wrong, the machine is
+// rolled back to its snapshot before that frame and the frames since are
+// run again with the right keys. The peers also exchange checksums of
+// their snapshots every so often, and stop when these differ.
+//
+// Both machines must be deterministic: they run the same ROM, with the
+// CXNN numbers drawn from the seed of player 1, and with no cheats or
+// other input besides the keypad: no scripts, control API or players
+// from the web.
+package netplay
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// Config are the settings of a session, which must be the same on both
+// peers except for Player
+type Config struct {
+	Player       int           // 1 or 2, player 1 waits for player 2 to connect
+	Delay        int           // Frames between reading the keys and using them, 2 by default
+	MaxRollback  int           // Frames the peer may be behind before waiting for it, 8 by default
+	HashInterval int           // Frames between checksums, 60 by default
+	Timeout      time.Duration // Of the peer once connected, 5 seconds by default
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.Delay <= 0 {
+		cfg.Delay = 2
+	}
+	if cfg.MaxRollback <= 0 {
+		cfg.MaxRollback = 8
+	}
+	if cfg.HashInterval <= 0 {
+		cfg.HashInterval = 60
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+}
+
+// resendInterval is how often the handshake and the keys are sent again
+// while waiting for the peer
+const resendInterval = 50 * time.Millisecond
+
+// maxPacket is the size of the largest packet read
+const maxPacket = 1500
+
+// ErrTimeout stops the machine when the peer stops answering
+var ErrTimeout = errors.New("netplay: peer stopped answering")
+
+// DesyncError stops the machine when the peers are in different states
+type DesyncError struct {
+	Frame     uint64
+	Want, Got uint32 // Checksums of the peer and of this machine
+}
+
+func (e *DesyncError) Error() string {
+	return fmt.Sprintf("netplay: desynchronised at frame %d: checksum %08X, peer has %08X", e.Frame, e.Got, e.Want)
+}
+
+// Stats count the rollbacks of a session
+type Stats struct {
+	Rollbacks   int // Wrong predictions
+	Resimulated int // Frames run again because of them
+	Stalls      int // Frames which waited for the peer
+}
+
+// Session is the link of a machine with its peer
+type Session struct {
+	m       *c8.Machine
+	conn    net.PacketConn
+	peer    net.Addr
+	cfg     Config
+	packets chan *packet
+
+	// The fields below are used by the goroutine running the machine only,
+	// as the session is driven by its input function and frame hook
+	frame        uint64            // Last frame run
+	local        map[uint64]uint16 // Keys of this player by frame
+	remote       map[uint64]uint16 // Keys of the peer, up to remoteLast
+	remoteLast   uint64
+	used         map[uint64]uint16 // Keys of the peer the frames ran with
+	acked        uint64            // Last frame of local keys the peer has
+	checked      uint64            // Frames up to this one ran with the right keys
+	snapshots    map[uint64]*c8.Snapshot
+	hashes       map[uint64]uint32 // Checksums after frames, of this machine
+	remoteHashes map[uint64]uint32 // and of the peer
+	lastHash     uint64            // Last frame with a checksum
+	resimulating bool
+	lastPacket   time.Time // Received
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Connect links a machine which has just read its ROM with its peer, then
+// makes it play through the session. It must be called before the machine
+// runs. Player 1 waits for the hello of player 2, from any address when
+// peer is nil; player 2 sends it to peer until player 1 answers or the
+// timeout passes.
+func Connect(m *c8.Machine, conn net.PacketConn, peer net.Addr, cfg Config) (*Session, error) {
+	cfg.setDefaults()
+	s := &Session{
+		m:            m,
+		conn:         conn,
+		peer:         peer,
+		cfg:          cfg,
+		packets:      make(chan *packet, 64),
+		local:        map[uint64]uint16{},
+		remote:       map[uint64]uint16{},
+		used:         map[uint64]uint16{},
+		snapshots:    map[uint64]*c8.Snapshot{},
+		hashes:       map[uint64]uint32{},
+		remoteHashes: map[uint64]uint32{},
+	}
+	var err error
+	switch cfg.Player {
+	case 1:
+		err = s.welcome()
+	case 2:
+		if peer == nil {
+			return nil, fmt.Errorf("netplay: player 2 needs the address of player 1")
+		}
+		err = s.hello()
+	default:
+		return nil, fmt.Errorf("netplay: player %d, want 1 or 2", cfg.Player)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The keys of the first frames, before the delay, are none
+	delay := uint64(cfg.Delay)
+	for f := uint64(1); f <= delay; f++ {
+		s.local[f], s.remote[f] = 0, 0
+	}
+	s.remoteLast, s.acked = delay, delay
+	s.snapshots[0] = m.Snapshot()
+	s.lastPacket = time.Now()
+
+	next := m.Input
+	m.Input = func(frame uint64, held uint16) uint16 {
+		if s.resimulating {
+			return s.local[frame] | s.used[frame]
+		}
+		if next != nil {
+			held = next(frame, held)
+		}
+		s.local[frame+delay] = held
+		s.used[frame] = s.predict(frame)
+		return s.local[frame] | s.used[frame]
+	}
+	m.AddFrameHook(s.afterFrame)
+	go s.read()
+	return s, nil
+}
+
+// welcome waits for the hello of player 2 and answers it
+func (s *Session) welcome() error {
+	buf := make([]byte, maxPacket)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		p, err := decodePacket(buf[:n])
+		if err != nil || p.kind != packetHello || s.peer != nil && addr.String() != s.peer.String() {
+			continue
+		}
+		s.peer = addr
+		if _, err := s.conn.WriteTo(s.welcomePacket(), addr); err != nil {
+			return err
+		}
+		return s.checkROM(p.romHash)
+	}
+}
+
+func (s *Session) welcomePacket() []byte {
+	p := packet{kind: packetWelcome, romHash: s.m.ROMHash(), seed: s.m.Seed()}
+	return p.encode()
+}
+
+// hello sends hellos to player 1 until it answers with the seed
+func (s *Session) hello() error {
+	hello := (&packet{kind: packetHello, romHash: s.m.ROMHash()}).encode()
+	buf := make([]byte, maxPacket)
+	deadline := time.Now().Add(s.cfg.Timeout)
+	defer s.conn.SetReadDeadline(time.Time{})
+	for time.Now().Before(deadline) {
+		if _, err := s.conn.WriteTo(hello, s.peer); err != nil {
+			return err
+		}
+		s.conn.SetReadDeadline(time.Now().Add(resendInterval))
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		p, err := decodePacket(buf[:n])
+		if err != nil || p.kind != packetWelcome || addr.String() != s.peer.String() {
+			continue
+		}
+		s.m.SetSeed(p.seed)
+		return s.checkROM(p.romHash)
+	}
+	return fmt.Errorf("netplay: no answer from %s", s.peer)
+}
+
+func (s *Session) checkROM(peerHash string) error {
+	if peerHash != s.m.ROMHash() {
+		return fmt.Errorf("netplay: the peer runs another ROM, SHA-1 %s", peerHash)
+	}
+	return nil
+}
+
+// read passes the packets of the peer on to the machine until the
+// connection is closed. It answers the hellos player 2 sends again while
+// the welcome is on its way.
+func (s *Session) read() {
+	defer close(s.packets)
+	buf := make([]byte, maxPacket)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if err, ok := err.(net.Error); ok && err.Temporary() {
+				continue
+			}
+			return
+		}
+		if addr.String() != s.peer.String() {
+			continue
+		}
+		p, err := decodePacket(buf[:n])
+		switch {
+		case err != nil:
+		case p.kind == packetHello && s.cfg.Player == 1:
+			s.conn.WriteTo(s.welcomePacket(), s.peer)
+		case p.kind == packetInputs:
+			// Dropping it when the machine lags is fine, as the next
+			// one repeats its keys
+			select {
+			case s.packets <- p:
+			default:
+			}
+		}
+	}
+}
+
+// Close ends the session, closing its connection
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// Stats returns the rollbacks so far
+func (s *Session) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// predict returns the keys of the peer during a frame, the last ones
+// received if they have not arrived yet
+func (s *Session) predict(frame uint64) uint16 {
+	if frame <= s.remoteLast {
+		return s.remote[frame]
+	}
+	return s.remote[s.remoteLast]
+}
+
+// afterFrame is the frame hook of the machine. It sends the keys of this
+// player, rolls back if the keys of the peer were mispredicted, and waits
+// for the peer when it is too far behind.
+func (s *Session) afterFrame() error {
+	if s.resimulating {
+		s.snapshots[s.m.State().Frames] = s.m.Snapshot()
+		return nil
+	}
+	s.frame = s.m.State().Frames
+	s.snapshots[s.frame] = s.m.Snapshot()
+	err := s.sync(false)
+	for err == nil && s.frame >= s.remoteLast+uint64(s.cfg.MaxRollback) {
+		s.mu.Lock()
+		s.stats.Stalls++
+		s.mu.Unlock()
+		err = s.sync(true)
+	}
+	if err != nil {
+		s.conn.Close()
+	}
+	return err
+}
+
+// sync sends the keys and handles the packets received, waiting for one
+// when wait is set
+func (s *Session) sync(wait bool) error {
+	if err := s.send(); err != nil {
+		return err
+	}
+	if wait {
+		select {
+		case p, ok := <-s.packets:
+			if !ok {
+				return ErrTimeout
+			}
+			s.receive(p)
+		case <-time.After(resendInterval):
+		}
+	}
+	for more := true; more; {
+		select {
+		case p, ok := <-s.packets:
+			if !ok {
+				return ErrTimeout
+			}
+			s.receive(p)
+		default:
+			more = false
+		}
+	}
+	if time.Since(s.lastPacket) > s.cfg.Timeout {
+		return ErrTimeout
+	}
+	if err := s.rollback(); err != nil {
+		return err
+	}
+	return s.checkHashes()
+}
+
+func (s *Session) send() error {
+	p := packet{
+		kind:      packetInputs,
+		ack:       uint32(s.remoteLast),
+		first:     uint32(s.acked + 1),
+		hashFrame: uint32(s.lastHash),
+		hash:      s.hashes[s.lastHash],
+	}
+	for f := s.acked + 1; f <= s.frame+uint64(s.cfg.Delay); f++ {
+		p.keys = append(p.keys, s.local[f])
+	}
+	_, err := s.conn.WriteTo(p.encode(), s.peer)
+	return err
+}
+
+func (s *Session) receive(p *packet) {
+	s.lastPacket = time.Now()
+	if ack := uint64(p.ack); ack > s.acked {
+		s.acked = ack
+	}
+	for i, keys := range p.keys {
+		if f := uint64(p.first) + uint64(i); f == s.remoteLast+1 {
+			s.remote[f] = keys
+			s.remoteLast = f
+		}
+	}
+	if p.hashFrame != 0 {
+		s.remoteHashes[uint64(p.hashFrame)] = p.hash
+	}
+}
+
+// rollback runs the frames again from the first one which ran with the
+// wrong keys of the peer
+func (s *Session) rollback() error {
+	known := s.remoteLast
+	if known > s.frame {
+		known = s.frame
+	}
+	for f := s.checked + 1; f <= known; f++ {
+		if s.remote[f] == s.used[f] {
+			continue
+		}
+		s.mu.Lock()
+		s.stats.Rollbacks++
+		s.stats.Resimulated += int(s.frame - f + 1)
+		s.mu.Unlock()
+		if err := s.m.Restore(s.snapshots[f-1]); err != nil {
+			return err
+		}
+		s.resimulating = true
+		for g := f; g <= s.frame; g++ {
+			s.used[g] = s.predict(g)
+			if err := s.m.RunFrame(); err != nil {
+				s.resimulating = false
+				return err
+			}
+		}
+		s.resimulating = false
+		break
+	}
+	if known > s.checked {
+		s.checked = known
+	}
+	return nil
+}
+
+// checkHashes takes the checksums of the frames now checked, compares them
+// with those of the peer, and forgets what no rollback needs anymore
+func (s *Session) checkHashes() error {
+	interval := uint64(s.cfg.HashInterval)
+	for f := s.lastHash + interval - s.lastHash%interval; f <= s.checked; f += interval {
+		s.hashes[f] = s.snapshots[f].Checksum()
+		s.lastHash = f
+	}
+	for f, hash := range s.hashes {
+		if remote, ok := s.remoteHashes[f]; ok && remote != hash {
+			return &DesyncError{Frame: f, Want: remote, Got: hash}
+		}
+	}
+	// The checksums of one peer may come a few intervals after the other's
+	for _, hashes := range []map[uint64]uint32{s.hashes, s.remoteHashes} {
+		for f := range hashes {
+			if f+10*interval < s.checked {
+				delete(hashes, f)
+			}
+		}
+	}
+
+	oldest := s.checked
+	if s.acked < oldest {
+		oldest = s.acked
+	}
+	for f := range s.snapshots {
+		if f < s.checked {
+			delete(s.snapshots, f)
+		}
+	}
+	for f := range s.local {
+		if f < oldest {
+			delete(s.local, f)
+			delete(s.used, f)
+		}
+	}
+	for f := range s.remote {
+		if f < s.checked {
+			delete(s.remote, f)
+		}
+	}
+	return nil
+}
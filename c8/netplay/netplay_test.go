@@ -0,0 +1,128 @@
+package netplay
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+func loadPong(t *testing.T) *c8.Machine {
+	rom, err := ioutil.ReadFile("../../c8games/PONG2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := c8.NewMachine()
+	if err := m.LoadROM(bytes.NewReader(rom)); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// play runs the machines of both sessions in their own goroutine until
+// both ran frames frames, or one stopped, then closes the sessions. before
+// is called before every frame of a machine. It returns the errors the
+// machines stopped with before that.
+func play(sessions []*Session, frames uint64, before func(m *c8.Machine)) []error {
+	var mu sync.Mutex
+	behind := len(sessions) // Machines yet to run the frames
+	over := false
+	end := func() {
+		over = true
+		for _, s := range sessions {
+			s.Close()
+		}
+	}
+	errs := make([]error, len(sessions))
+	var wg sync.WaitGroup
+	wg.Add(len(sessions))
+	for i, s := range sessions {
+		go func(i int, m *c8.Machine) {
+			defer wg.Done()
+			// Keep running for the peer until it caught up
+			for counted := false; ; {
+				if before != nil {
+					before(m)
+				}
+				err := m.RunFrame()
+				mu.Lock()
+				if !over && err != nil {
+					errs[i] = err
+					end()
+				}
+				if !counted && m.State().Frames >= frames {
+					counted = true
+					if behind--; behind == 0 && !over {
+						end()
+					}
+				}
+				stop := over
+				mu.Unlock()
+				if stop {
+					return
+				}
+			}
+		}(i, s.m)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestLoopback(t *testing.T) {
+	a, b := loadPong(t), loadPong(t)
+	a.SetSeed(1)
+	b.SetSeed(2)
+	// The players move their paddles up and down, at different paces
+	a.Input = func(frame uint64, held uint16) uint16 { return []uint16{1 << 1, 1 << 4}[frame/7%2] }
+	b.Input = func(frame uint64, held uint16) uint16 { return []uint16{1 << 0xC, 1 << 0xD}[frame/11%2] }
+	cfg := Config{HashInterval: 10, Timeout: 2 * time.Second}
+	sa, sb, err := Loopback(a, b, cfg, Link{Latency: 20 * time.Millisecond, Loss: 0.2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Seed() != b.Seed() {
+		t.Errorf("player 2 has the seed %d, player 1 %d", b.Seed(), a.Seed())
+	}
+
+	for i, err := range play([]*Session{sa, sb}, 200, nil) {
+		if err != nil {
+			t.Errorf("player %d stopped: %v", i+1, err)
+		}
+	}
+	for i, s := range []*Session{sa, sb} {
+		stats := s.Stats()
+		if stats.Rollbacks == 0 || stats.Resimulated < stats.Rollbacks {
+			t.Errorf("player %d has the stats %+v, want rollbacks", i+1, stats)
+		}
+	}
+}
+
+func TestDesync(t *testing.T) {
+	a, b := loadPong(t), loadPong(t)
+	sa, sb, err := Loopback(a, b, Config{HashInterval: 10, Timeout: time.Second}, Link{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := play([]*Session{sa, sb}, 100, func(m *c8.Machine) {
+		// Nobody holds a key, so no rollback takes the change back
+		if m == a && m.State().Frames == 25 {
+			m.Poke(0xF00, 0x55)
+		}
+	})
+	var desync *DesyncError
+	for _, err := range errs {
+		if d, ok := err.(*DesyncError); ok {
+			desync = d
+		}
+	}
+	if desync == nil {
+		t.Fatalf("the players stopped with %v, want a desync", errs)
+	}
+	if desync.Frame != 30 || desync.Want == desync.Got {
+		t.Errorf("desync is %+v, want frame 30", desync)
+	}
+}
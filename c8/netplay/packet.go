@@ -0,0 +1,92 @@
+package netplay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Packet types
+const (
+	packetHello   = 1 // From player 2, with its ROM hash
+	packetWelcome = 2 // From player 1, with its ROM hash and the seed
+	packetInputs  = 3
+)
+
+var magic = []byte("C8NP")
+
+// errBadPacket is returned for packets which are not from another session
+var errBadPacket = errors.New("not a netplay packet")
+
+// packet is one datagram between the peers. Every inputs packet repeats
+// the keys the peer has not acknowledged yet, so that lost packets need no
+// retransmission of their own.
+type packet struct {
+	kind byte
+
+	// hello and welcome
+	romHash string
+	seed    uint64
+
+	// inputs
+	ack       uint32   // Last frame of the receiver's keys the sender has
+	first     uint32   // Frame of keys[0]
+	keys      []uint16 // Of the sender, by frame
+	hashFrame uint32   // Frame of hash, 0 when none was taken yet
+	hash      uint32   // Checksum of the snapshot after hashFrame
+}
+
+func (p *packet) encode() []byte {
+	var buf bytes.Buffer
+	buf.Write(magic)
+	buf.WriteByte(p.kind)
+	switch p.kind {
+	case packetHello, packetWelcome:
+		binary.Write(&buf, binary.BigEndian, p.seed)
+		buf.WriteByte(byte(len(p.romHash)))
+		buf.WriteString(p.romHash)
+	case packetInputs:
+		binary.Write(&buf, binary.BigEndian, []uint32{p.ack, p.first, p.hashFrame, p.hash})
+		binary.Write(&buf, binary.BigEndian, uint16(len(p.keys)))
+		binary.Write(&buf, binary.BigEndian, p.keys)
+	}
+	return buf.Bytes()
+}
+
+func decodePacket(data []byte) (*packet, error) {
+	if !bytes.HasPrefix(data, magic) || len(data) < len(magic)+1 {
+		return nil, errBadPacket
+	}
+	r := bytes.NewReader(data[len(magic)+1:])
+	p := &packet{kind: data[len(magic)]}
+	switch p.kind {
+	case packetHello, packetWelcome:
+		if err := binary.Read(r, binary.BigEndian, &p.seed); err != nil {
+			return nil, errBadPacket
+		}
+		n, err := r.ReadByte()
+		if err != nil {
+			return nil, errBadPacket
+		}
+		hash := make([]byte, n)
+		if _, err := io.ReadFull(r, hash); err != nil {
+			return nil, errBadPacket
+		}
+		p.romHash = string(hash)
+	case packetInputs:
+		var header [4]uint32
+		var n uint16
+		if binary.Read(r, binary.BigEndian, &header) != nil || binary.Read(r, binary.BigEndian, &n) != nil {
+			return nil, errBadPacket
+		}
+		p.ack, p.first, p.hashFrame, p.hash = header[0], header[1], header[2], header[3]
+		p.keys = make([]uint16, n)
+		if err := binary.Read(r, binary.BigEndian, p.keys); err != nil {
+			return nil, errBadPacket
+		}
+	default:
+		return nil, errBadPacket
+	}
+	return p, nil
+}
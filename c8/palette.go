@@ -0,0 +1,102 @@
+package c8
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// Palette is the set of colours used to show the board. Colors[0] is the
+// background and Colors[n] is used for a pixel whose plane bits are n, so a
+// palette for a display with p planes needs 1<<p colours.
+type Palette struct {
+	Name   string
+	Colors []color.RGBA
+}
+
+// Color returns the colour of a pixel with the given plane bits
+func (p Palette) Color(pixel byte) color.RGBA {
+	return p.Colors[int(pixel)%len(p.Colors)]
+}
+
+// Palettes are the built-in palettes, each with an entry for every
+// combination of two planes
+var Palettes = []Palette{
+	{Name: "contrast", Colors: mustParseColors("#000000", "#FFFFFF", "#FFFF00", "#00FFFF")},
+	{Name: "classic", Colors: mustParseColors("#0A1A0C", "#33FF66", "#1C8C3A", "#B8FFCB")},
+	{Name: "amber", Colors: mustParseColors("#1A1000", "#FFB000", "#A05F00", "#FFE0A0")},
+	{Name: "lcd", Colors: mustParseColors("#B4BCA4", "#2C322C", "#707A66", "#0E120E")},
+	{Name: "colorblind", Colors: mustParseColors("#000000", "#E69F00", "#56B4E9", "#F0E442")},
+}
+
+// FindPalette returns the built-in palette with the given name
+func FindPalette(name string) (Palette, bool) {
+	for _, p := range Palettes {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Palette{}, false
+}
+
+// ParsePalette reads either the name of a built-in palette or a comma
+// separated list of hex colours such as "#000000,#FFFFFF"
+func ParsePalette(s string) (Palette, error) {
+	if p, ok := FindPalette(s); ok {
+		return p, nil
+	}
+	if !strings.Contains(s, "#") {
+		return Palette{}, fmt.Errorf("unknown palette %q", s)
+	}
+	return NewPalette("custom", strings.Split(s, ",")...)
+}
+
+// NewPalette generates a palette from hex colours
+func NewPalette(name string, hexColors ...string) (Palette, error) {
+	n := len(hexColors)
+	if n < 2 || n&(n-1) != 0 {
+		return Palette{}, fmt.Errorf("palette %q has %d colours, want 2, 4, 8 or 16", name, n)
+	}
+	if n > 16 {
+		return Palette{}, fmt.Errorf("palette %q has %d colours, want at most 16", name, n)
+	}
+
+	p := Palette{Name: name}
+	for _, hex := range hexColors {
+		c, err := ParseColor(hex)
+		if err != nil {
+			return Palette{}, err
+		}
+		p.Colors = append(p.Colors, c)
+	}
+	return p, nil
+}
+
+// ParseColor reads a colour written as #RRGGBB or #RRGGBBAA
+func ParseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 6 {
+		hex += "FF"
+	}
+	if len(hex) != 8 {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q", s)
+	}
+	val, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q", s)
+	}
+	return color.RGBA{R: byte(val >> 24), G: byte(val >> 16), B: byte(val >> 8), A: byte(val)}, nil
+}
+
+func mustParseColors(hexColors ...string) []color.RGBA {
+	var colors []color.RGBA
+	for _, hex := range hexColors {
+		c, err := ParseColor(hex)
+		if err != nil {
+			panic(err)
+		}
+		colors = append(colors, c)
+	}
+	return colors
+}
@@ -0,0 +1,51 @@
+package c8
+
+import (
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePalette(t *testing.T) {
+	sixteen := strings.TrimSuffix(strings.Repeat("#FFFFFF,", 16), ",")
+	white := make([]color.RGBA, 16)
+	for i := range white {
+		white[i] = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	}
+	tests := []struct {
+		s      string
+		name   string
+		colors []color.RGBA
+		err    string
+	}{
+		{"amber", "amber", Palettes[2].Colors, ""},
+		{"#000000, #FFFFFF", "custom", []color.RGBA{{0, 0, 0, 0xFF}, {0xFF, 0xFF, 0xFF, 0xFF}}, ""},
+		{"#102030,#40506080,#708090,#a0b0c0", "custom",
+			[]color.RGBA{{0x10, 0x20, 0x30, 0xFF}, {0x40, 0x50, 0x60, 0x80}, {0x70, 0x80, 0x90, 0xFF}, {0xA0, 0xB0, 0xC0, 0xFF}}, ""},
+		{sixteen, "custom", white, ""},
+		{"sepia", "", nil, `unknown palette "sepia"`},
+		{"#000000", "", nil, `palette "custom" has 1 colours, want 2, 4, 8 or 16`},
+		{"#000000,#111111,#222222", "", nil, `palette "custom" has 3 colours, want 2, 4, 8 or 16`},
+		{sixteen + "," + sixteen, "", nil, `palette "custom" has 32 colours, want at most 16`},
+		{"#000000,#FFFFF", "", nil, `invalid colour "#FFFFF"`},
+		{"#000000,#GG0000", "", nil, `invalid colour "#GG0000"`},
+		{"#000000,#00000000FF", "", nil, `invalid colour "#00000000FF"`},
+	}
+	for _, test := range tests {
+		p, err := ParsePalette(test.s)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q returned %v, want %s", test.s, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+			continue
+		}
+		if p.Name != test.name || !reflect.DeepEqual(p.Colors, test.colors) {
+			t.Errorf("%q is %s %v, want %s %v", test.s, p.Name, p.Colors, test.name, test.colors)
+		}
+	}
+}
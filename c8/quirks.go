@@ -0,0 +1,99 @@
+package c8
+
+// Quirks select between the behaviours of the interpreters CHIP-8 ran on
+// over the years. The JSON names are those of the community chip-8-database.
+type Quirks struct {
+	// Shift makes 8XY6 and 8XYE shift VX in place instead of VY into VX
+	Shift bool `json:"shift"`
+
+	// MemoryIncrementByX makes FX55 and FX65 add X to I, instead of X+1
+	MemoryIncrementByX bool `json:"memoryIncrementByX"`
+
+	// MemoryLeaveIUnchanged makes FX55 and FX65 leave I as it was
+	MemoryLeaveIUnchanged bool `json:"memoryLeaveIUnchanged"`
+
+	// Wrap makes sprites wrap around the edges of the board instead of
+	// being clipped
+	Wrap bool `json:"wrap"`
+
+	// Jump makes BNNN jump to NNN plus VX, X being the top digit of NNN,
+	// instead of plus V0
+	Jump bool `json:"jump"`
+
+	// VBlank makes DXYN wait for the next frame, so at most one sprite is
+	// drawn per frame
+	VBlank bool `json:"vblank"`
+
+	// Logic makes 8XY1, 8XY2 and 8XY3 reset VF
+	Logic bool `json:"logic"`
+}
+
+// quirkNames are the JSON names of the quirks, in the order of flags
+var quirkNames = []string{"shift", "memoryIncrementByX", "memoryLeaveIUnchanged", "wrap", "jump", "vblank", "logic"}
+
+// flags returns the quirks in the order of quirkNames
+func (q *Quirks) flags() []*bool {
+	return []*bool{&q.Shift, &q.MemoryIncrementByX, &q.MemoryLeaveIUnchanged, &q.Wrap, &q.Jump, &q.VBlank, &q.Logic}
+}
+
+// DefaultQuirks are the quirks of a new machine, which is how every ROM
+// ran before quirks could be chosen. LoadROM replaces them with those of
+// the ROM, from the database or from Detect.
+var DefaultQuirks = Quirks{Shift: true, MemoryLeaveIUnchanged: true}
+
+// Platform is an interpreter CHIP-8 programs were written for
+type Platform struct {
+	ID       string // As used by the community chip-8-database
+	Name     string
+	Quirks   Quirks
+	TickRate int // Instructions per frame
+}
+
+// Platforms are the platforms ROMs can target, oldest first
+var Platforms = []Platform{
+	{
+		ID:       "originalChip8",
+		Name:     "CHIP-8 on the COSMAC VIP",
+		Quirks:   Quirks{VBlank: true, Logic: true},
+		TickRate: 15,
+	},
+	{
+		ID:       "modernChip8",
+		Name:     "Modern CHIP-8",
+		TickRate: 12,
+	},
+	{
+		ID:       "chip48",
+		Name:     "CHIP-48",
+		Quirks:   Quirks{Shift: true, MemoryIncrementByX: true, Jump: true},
+		TickRate: 30,
+	},
+	{
+		ID:       "superchip1",
+		Name:     "SUPER-CHIP 1.0",
+		Quirks:   Quirks{Shift: true, MemoryIncrementByX: true, Jump: true},
+		TickRate: 30,
+	},
+	{
+		ID:       "superchip",
+		Name:     "SUPER-CHIP 1.1",
+		Quirks:   Quirks{Shift: true, MemoryLeaveIUnchanged: true, Jump: true},
+		TickRate: 30,
+	},
+	{
+		ID:       "xochip",
+		Name:     "XO-CHIP",
+		Quirks:   Quirks{Wrap: true},
+		TickRate: 1000,
+	},
+}
+
+// FindPlatform returns the platform with the given ID
+func FindPlatform(id string) (Platform, bool) {
+	for _, p := range Platforms {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Platform{}, false
+}
@@ -0,0 +1,26 @@
+package c8
+
+import "time"
+
+// random is the SplitMix64 generator behind CXNN. Its whole state is one
+// number, so snapshots restore it and replays draw the same numbers.
+type random struct {
+	state uint64
+}
+
+// newSeed returns a seed for machines that were not given one
+func newSeed() uint64 {
+	return uint64(time.Now().UnixNano())
+}
+
+func (r *random) next() uint64 {
+	r.state += 0x9E3779B97F4A7C15
+	z := r.state
+	z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+	z = (z ^ z>>27) * 0x94D049BB133111EB
+	return z ^ z>>31
+}
+
+func (r *random) byte() byte {
+	return byte(r.next() >> 56)
+}
@@ -1,23 +1,38 @@
 package c8
 
 import (
-	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
 	"math"
-	"math/rand"
-	"os"
-	"strconv"
-	"unicode"
+	"sync"
 )
 
 const (
 	memorySize          = 0x1000
 	programCounterStart = 0x200
 	screenMemoryStart   = 0x100
-	clearScreen         = "\033[H\033[2J"
+	defaultTickRate     = 10 // Instructions per frame
 )
 
-var memory = make([]byte, memorySize)
+// ErrStopped is returned by Step when the program has stopped
+var ErrStopped = errors.New("program stopped")
+
+// MemoryError is returned by Step when an instruction reaches past the end
+// of memory through I
+type MemoryError struct {
+	PC     uint16 // Of the instruction
+	Opcode uint16
+	Addr   int // First address the instruction needed past memory
+}
+
+func (e *MemoryError) Error() string {
+	return fmt.Sprintf("instruction 0x%04X at 0x%03X reaches 0x%X, past the end of memory", e.Opcode, e.PC, e.Addr)
+}
 
 type registerStruct struct {
 	v           []byte
@@ -27,433 +42,777 @@ type registerStruct struct {
 	soundTimer  byte
 }
 
-// Regs are registers
-var regs = registerStruct{
-	v:           make([]byte, 16),
-	progCounter: programCounterStart,
-}
-
 type stackPtr struct {
-	v           []byte
-	index       uint16
 	progCounter uint16
 }
 
-var stack []stackPtr
-var keyPressed byte
+// Machine is a CHIP-8 interpreter with its memory, registers and backends
+type Machine struct {
+	Display Display
+	Keypad  Keypad
+	Audio   Audio
+	Clock   Clock
+
+	// Trace receives a line for every executed instruction when not nil
+	Trace io.Writer
+
+	// Input, when not nil, chooses the keys of every frame from those held
+	// on the keypad. It is called with the machine locked.
+	Input InputFunc
+
+	// Cheats, when not nil, are written into memory after every frame
+	Cheats *Cheats
+
+	// TickRate is the number of instructions executed per frame
+	TickRate int
+
+	// Quirks select the behaviour of the instructions that differ between
+	// interpreters
+	Quirks Quirks
+
+	// mu guards the state below, which frontends read while the machine
+	// runs in its own goroutine
+	mu           sync.Mutex
+	memory       []byte
+	accesses     []Access // Since the last call to TakeAccesses
+	regs         registerStruct
+	stack        []stackPtr
+	board        Board
+	keys         uint16 // Keypad state latched at the start of the frame
+	dirty        bool   // Board changed since the last refresh
+	beep         bool
+	instructions uint64 // Executed since the ROM was read
+	frames       uint64 // Run since the ROM was read
+	stopped      bool   // By Stop
+	vblank       bool   // A sprite was drawn with the VBlank quirk
+	info         *ROMInfo
+	detection    *Detection // When the ROM is not in the database
+	seed         uint64
+	rand         random
+	romHash      string
+	hooks        []FrameHook
+	execHooks    map[uint16][]AddrHook
+	writeHooks   map[uint16][]AddrHook
+	writes       []uint16 // Addresses with write hooks the current instruction wrote
+}
+
+// InputFunc returns the keys the program sees during a frame, given those
+// held on the keypad. Frames are numbered from 1.
+type InputFunc func(frame uint64, held uint16) uint16
+
+// FrameHook is called after every frame, from the goroutine running the
+// machine and with the machine unlocked. An error stops the machine.
+type FrameHook func() error
+
+// AddrHook is called when execution reaches an address, before the
+// instruction there runs, or after an instruction wrote to an address.
+// It is called from the goroutine running the machine and with the
+// machine unlocked. An error stops the machine.
+type AddrHook func(addr uint16) error
+
+// NewMachine generates a new Machine with headless backends and a random
+// seed
+func NewMachine() *Machine {
+	m := &Machine{
+		Display:  HeadlessDisplay{},
+		Keypad:   HeadlessKeypad{},
+		Audio:    HeadlessAudio{},
+		Clock:    HeadlessClock{},
+		TickRate: defaultTickRate,
+		Quirks:   DefaultQuirks,
+		memory:   make([]byte, memorySize),
+		accesses: make([]Access, memorySize),
+		regs: registerStruct{
+			v:           make([]byte, 16),
+			progCounter: programCounterStart,
+		},
+	}
+	m.SetSeed(newSeed())
+	return m
+}
 
-// ReadROM will read the ROM
-func ReadROM(filename string) error {
-	file, err := os.Open(filename)
+// SetSeed restarts the random numbers of CXNN from the given seed
+func (m *Machine) SetSeed(seed uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seed = seed
+	m.rand = random{state: seed}
+}
+
+// Seed returns the seed given to SetSeed, or the random one of NewMachine
+func (m *Machine) Seed() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.seed
+}
+
+// LoadROM reads a ROM into memory, and picks the quirks and tick rate of
+// its platform from the database or by detection. Opening the file is left
+// to the caller, so that the machine runs where there are no files.
+func (m *Machine) LoadROM(r io.Reader) error {
+	rom, err := ioutil.ReadAll(r)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if len(rom) > memorySize-programCounterStart {
+		return fmt.Errorf("ROM is %d bytes, more than the %d there is room for", len(rom), memorySize-programCounterStart)
+	}
+
+	sum := sha1.Sum(rom)
+	m.romHash = hex.EncodeToString(sum[:])
+	copy(m.memory[programCounterStart:], rom)
+	m.initSprites()
+	if info := DefaultDatabase.Lookup(rom); info != nil {
+		m.info = info
+		m.Quirks = info.Quirks
+		m.TickRate = info.TickRate
+		return nil
 	}
-	defer file.Close()
 
-	fileInfo, err := file.Stat()
+	d := Detect(rom)
+	m.detection = &d
+	m.Quirks = d.Platform.Quirks
+	m.TickRate = d.Platform.TickRate
+	return nil
+}
+
+// ROMHash returns the SHA-1 of the ROM in hex
+func (m *Machine) ROMHash() string {
+	return m.romHash
+}
+
+// AddFrameHook adds a function to call after every frame. Hooks must be
+// added before the machine runs.
+func (m *Machine) AddFrameHook(hook FrameHook) {
+	m.hooks = append(m.hooks, hook)
+}
+
+// AddExecHook adds a function to call whenever execution reaches an
+// address. Hooks must be added before the machine runs.
+func (m *Machine) AddExecHook(addr uint16, hook AddrHook) {
+	if m.execHooks == nil {
+		m.execHooks = map[uint16][]AddrHook{}
+	}
+	m.execHooks[addr] = append(m.execHooks[addr], hook)
+}
+
+// AddWriteHook adds a function to call whenever an instruction writes to
+// an address. Writes by Poke, Restore and cheats are not seen. Hooks must
+// be added before the machine runs.
+func (m *Machine) AddWriteHook(addr uint16, hook AddrHook) {
+	if m.writeHooks == nil {
+		m.writeHooks = map[uint16][]AddrHook{}
+	}
+	m.writeHooks[addr] = append(m.writeHooks[addr], hook)
+}
+
+// Info returns what the database knows about the ROM, or nil
+func (m *Machine) Info() *ROMInfo {
+	return m.info
+}
+
+// Detection returns how the platform of a ROM missing from the database
+// was guessed, or nil
+func (m *Machine) Detection() *Detection {
+	return m.detection
+}
+
+// Run will run the ROM, one frame per clock tick, until it stops
+func (m *Machine) Run() error {
+	for {
+		m.Clock.Tick()
+		err := m.RunFrame()
+		if err == ErrStopped {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// RunFrame executes one frame worth of instructions, then updates the
+// timers and the backends and calls the frame hooks
+func (m *Machine) RunFrame() error {
+	if err := m.runFrame(); err != nil {
+		return err
+	}
+	for _, hook := range m.hooks {
+		if err := hook(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Machine) runFrame() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		return ErrStopped
+	}
+	m.frames++
+	m.keys = m.Keypad.Keys()
+	if m.Input != nil {
+		m.keys = m.Input(m.frames, m.keys)
+	}
+	m.vblank = false
+	var err error
+	for i := 0; i < m.TickRate && err == nil && !m.vblank; i++ {
+		err = m.stepWithHooks()
+	}
+
+	if m.dirty {
+		m.dirty = false
+		m.Display.Refresh(&m.board)
+	}
 	if err != nil {
 		return err
 	}
-	fmt.Printf("File is %d bytes\n", fileInfo.Size())
-
-	reader := bufio.NewReader(file)
-	_, err = reader.Read(memory[programCounterStart:])
-	initSprites()
-	return err
-}
-
-// RunROM will run the ROM
-func RunROM() error {
-	for regs.progCounter < memorySize {
-		b1 := uint16(memory[regs.progCounter])
-		b2 := uint16(memory[regs.progCounter+1])
-		val := b1<<8 + b2
-		fmt.Printf("At instruction 0x%X: 0x%x ", regs.progCounter, val)
-		switch {
-		case val == 0x0000:
-			// 0000 NOP No Operation
-			fmt.Printf("No operation\n")
-
-		case val == 0x00E0:
-			// 00E0	Display	disp_clear()	Clears the screen.
-			pixels = [pixelsVertically][pixelsHorizontally]byte{}
-			fmt.Printf("Clear the screen\n")
-
-		case val == 0x00EE:
-			// 00EE	Flow	return;	Returns from a subroutine.
-			if len(stack) == 0 {
-				fmt.Printf("Return from a subroutine => Cannot return as stack is empty\n")
-			} else {
-				regs.v = stack[len(stack)-1].v
-				regs.index = stack[len(stack)-1].index
-				regs.progCounter = stack[len(stack)-1].progCounter
-				stack = stack[:len(stack)-1]
-				fmt.Printf("Return from a subroutine\n")
-			}
 
-		case val <= 0x0FFF:
-			// 0NNN	Call		Calls RCA 1802 program at address NNN. Not necessary for most ROMs.
-			regs.progCounter = val & 0xFFF
-			for i := range regs.v {
-				regs.v[i] = 0
-			}
-			fmt.Printf("Call RCA 1802 program at address 0x%X\n", val&0xFFF)
-
-		case val >= 0x1000 && val <= 0x1FFF:
-			// 1NNN	Flow	goto NNN;	Jumps to address NNN.
-			jumpAddress := val & 0xFFF
-			fmt.Printf("Jump to address at 0x%X\n", jumpAddress)
-			if val&0xFFF == regs.progCounter {
-				fmt.Printf("Jumping to the same address. Stopping\n")
-				return nil
-			}
-			regs.progCounter = jumpAddress - 2
+	if m.Cheats != nil {
+		m.Cheats.apply(m.memory)
+	}
+	if m.regs.delayTimer > 0 {
+		m.regs.delayTimer--
+	}
+	if m.regs.soundTimer > 0 {
+		m.regs.soundTimer--
+	}
+	if beep := m.regs.soundTimer > 0; beep != m.beep {
+		m.beep = beep
+		m.Audio.Beep(beep)
+	}
+	return nil
+}
+
+// Step executes a single instruction
+func (m *Machine) Step() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stepWithHooks()
+}
 
-		case val >= 0x2000 && val <= 0x2FFF:
-			// 2NNN	Flow	*(0xNNN)()	Calls subroutine at NNN.
-			stack = append(stack, stackPtr{v: regs.v, index: regs.index, progCounter: regs.progCounter})
-			regs.progCounter = val&0xFFF - 2
-			fmt.Printf("Call subroutine at 0x%X\n", val&0xFFF)
+// stepWithHooks executes an instruction, calling the exec hooks of its
+// address before and the write hooks of the addresses it wrote after
+func (m *Machine) stepWithHooks() error {
+	if hooks := m.execHooks[m.regs.progCounter]; len(hooks) > 0 {
+		if err := m.callHooks(hooks, m.regs.progCounter); err != nil {
+			return err
+		}
+	}
+	if err := m.step(); err != nil {
+		return err
+	}
+	writes := m.writes
+	m.writes = nil
+	for _, addr := range writes {
+		if err := m.callHooks(m.writeHooks[addr], addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		case val >= 0x3000 && val <= 0x3FFF:
-			// 3XNN	Cond	if(Vx==NN)	Skips the next instruction if VX equals NN.
+// callHooks calls address hooks with the machine unlocked
+func (m *Machine) callHooks(hooks []AddrHook, addr uint16) error {
+	m.mu.Unlock()
+	defer m.mu.Lock()
+	for _, hook := range hooks {
+		if err := hook(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop makes the machine return ErrStopped from its next frame or step, so
+// that Run returns at its next clock tick
+func (m *Machine) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopped = true
+}
+
+func (m *Machine) step() error {
+	// Running off the end of memory stops, as an instruction takes two bytes
+	if m.stopped || m.regs.progCounter > memorySize-2 {
+		return ErrStopped
+	}
+	m.instructions++
+	b1 := uint16(m.memory[m.regs.progCounter])
+	b2 := uint16(m.memory[m.regs.progCounter+1])
+	m.touch(m.regs.progCounter, AccessExecute, 2)
+	val := b1<<8 + b2
+	m.tracef("At instruction 0x%X: 0x%x ", m.regs.progCounter, val)
+	switch {
+	case val == 0x0000:
+		// 0000 NOP No Operation
+		m.tracef("No operation\n")
+
+	case val == 0x00E0:
+		// 00E0	Display	disp_clear()	Clears the screen.
+		m.board.clear()
+		m.dirty = true
+		m.tracef("Clear the screen\n")
+
+	case val == 0x00FE:
+		// 00FE	Display	lores()	Switches to the 64x32 resolution. (SUPER-CHIP)
+		m.board.setHires(false)
+		m.dirty = true
+		m.tracef("Switch to lores\n")
+
+	case val == 0x00FF:
+		// 00FF	Display	hires()	Switches to the 128x64 resolution. (SUPER-CHIP)
+		m.board.setHires(true)
+		m.dirty = true
+		m.tracef("Switch to hires\n")
+
+	case val == 0x00EE:
+		// 00EE	Flow	return;	Returns from a subroutine.
+		if len(m.stack) == 0 {
+			m.tracef("Return from a subroutine => Cannot return as m.stack is empty\n")
+		} else {
+			m.regs.progCounter = m.stack[len(m.stack)-1].progCounter
+			m.stack = m.stack[:len(m.stack)-1]
+			m.tracef("Return from a subroutine\n")
+		}
+
+	case val <= 0x0FFF:
+		// 0NNN	Call		Calls RCA 1802 program at address NNN. Not necessary for most ROMs.
+		m.regs.progCounter = val & 0xFFF
+		for i := range m.regs.v {
+			m.regs.v[i] = 0
+		}
+		m.tracef("Call RCA 1802 program at address 0x%X\n", val&0xFFF)
+
+	case val >= 0x1000 && val <= 0x1FFF:
+		// 1NNN	Flow	goto NNN;	Jumps to address NNN.
+		jumpAddress := val & 0xFFF
+		m.tracef("Jump to address at 0x%X\n", jumpAddress)
+		if val&0xFFF == m.regs.progCounter {
+			m.tracef("Jumping to the same address. Stopping\n")
+			return ErrStopped
+		}
+		m.regs.progCounter = jumpAddress - 2
+
+	case val >= 0x2000 && val <= 0x2FFF:
+		// 2NNN	Flow	*(0xNNN)()	Calls subroutine at NNN.
+		m.stack = append(m.stack, stackPtr{progCounter: m.regs.progCounter})
+		m.regs.progCounter = val&0xFFF - 2
+		m.tracef("Call subroutine at 0x%X\n", val&0xFFF)
+
+	case val >= 0x3000 && val <= 0x3FFF:
+		// 3XNN	Cond	if(Vx==NN)	Skips the next instruction if VX equals NN.
+		// (Usually the next instruction is a jump to skip a code block)
+		m.tracef("Skip next instr if V%X (val:%d) equals 0x%X", b1&0x0F, m.regs.v[b1&0x0F], b2)
+		if m.regs.v[b1&0x0F] == byte(b2) {
+			m.regs.progCounter += 2
+			m.tracef(" ==> SKIP NEXT INTRUCTION\n")
+		} else {
+			m.tracef(" ==> DO NOT SKIP NEXT INTRUCTION\n")
+		}
+
+	case val >= 0x4000 && val <= 0x4FFF:
+		// 4XNN	Cond	if(Vx!=NN)	Skips the next instruction if VX doesn't equal NN.
+		// (Usually the next instruction is a jump to skip a code block)
+		m.tracef("Skip next instr if V%X (val:%d) doesn't equal 0x%X", b1&0x0F, m.regs.v[b1&0x0F], b2)
+		if m.regs.v[b1&0x0F] != byte(b2) {
+			m.regs.progCounter += 2
+			m.tracef(" ==> SKIP NEXT INTRUCTION\n")
+		} else {
+			m.tracef(" ==> DO NOT SKIP NEXT INTRUCTION\n")
+		}
+
+	case val >= 0x5000 && val <= 0x5FFF:
+		switch b2 & 0xF {
+		case 0x0:
+			// 5XY0	Cond	if(Vx==Vy)	Skips the next instruction if VX equals VY.
 			// (Usually the next instruction is a jump to skip a code block)
-			fmt.Printf("Skip next instr if V%X (val:%d) equals 0x%X", b1&0x0F, regs.v[b1&0x0F], b2)
-			if regs.v[b1&0x0F] == byte(b2) {
-				regs.progCounter += 2
-				fmt.Printf(" ==> SKIP NEXT INTRUCTION\n")
+			m.tracef("Skip next instr if V%X (val:%d) equals V%X (val:%d)",
+				b1&0x0F, m.regs.v[b1&0x0F], b2&0xF0>>4, m.regs.v[b2&0xF0>>4])
+			if m.regs.v[b1&0x0F] == m.regs.v[b2&0xF0>>4] {
+				m.regs.progCounter += 2
+				m.tracef(" ==> SKIP NEXT INTRUCTION\n")
 			} else {
-				fmt.Printf(" ==> DO NOT SKIP NEXT INTRUCTION\n")
+				m.tracef(" ==> DO NOT SKIP NEXT INTRUCTION\n")
 			}
+		default:
+			m.tracef("-------------> Unknown statement !!! Data:0x%X\n", val)
+			return ErrStopped
+		}
 
-		case val >= 0x4000 && val <= 0x4FFF:
-			// 4XNN	Cond	if(Vx!=NN)	Skips the next instruction if VX doesn't equal NN.
-			// (Usually the next instruction is a jump to skip a code block)
-			fmt.Printf("Skip next instr if V%X (val:%d) doesn't equal 0x%X", b1&0x0F, regs.v[b1&0x0F], b2)
-			if regs.v[b1&0x0F] != byte(b2) {
-				regs.progCounter += 2
-				fmt.Printf(" ==> SKIP NEXT INTRUCTION\n")
+	case val >= 0x6000 && val <= 0x6FFF:
+		// 6XNN	Const	Vx = NN	Sets VX to NN.
+		m.regs.v[b1&0x0F] = byte(b2)
+		m.tracef("Set V%X to 0x%X (%d)\n", b1&0x0F, b2, b2)
+
+	case val >= 0x7000 && val <= 0x7FFF:
+		// 7XNN	Const	Vx += NN	Adds NN to VX. (Carry flag is not changed)
+		m.regs.v[b1&0x0F] = m.regs.v[b1&0x0F] + byte(b2)
+		m.tracef("Add %d to V%X (final val:%d)\n", b2, b1&0x0F, m.regs.v[b1&0x0F])
+
+	case val >= 0x8000 && val <= 0x8FFF:
+		switch b2 & 0xF {
+		case 0x0:
+			// 8XY0	Assign	Vx=Vy	Sets VX to the value of VY.
+			m.regs.v[b1&0x0F] = m.regs.v[b2&0xF0>>4]
+			m.tracef("Set V%X to value of V%X (val:%d)\n",
+				b1&0x0F, b2&0xF0>>4, m.regs.v[b1&0x0F])
+		case 0x1:
+			// 8XY1	BitOp	Vx=Vx|Vy	Sets VX to VX or VY. (Bitwise OR operation)
+			m.regs.v[b1&0x0F] = m.regs.v[b1&0x0F] | m.regs.v[b2&0xF0>>4]
+			m.resetFlagForLogic()
+			m.tracef("Set V%X to bitwise V%X or V%X (Final val:%d)\n",
+				b1&0x0F, b1&0x0F, b2&0xF0>>4, m.regs.v[b1&0x0F])
+		case 0x2:
+			// 8XY2	BitOp	Vx=Vx&Vy	Sets VX to VX and VY. (Bitwise AND operation)
+			m.regs.v[b1&0x0F] = m.regs.v[b1&0x0F] & m.regs.v[b2&0xF0>>4]
+			m.resetFlagForLogic()
+			m.tracef("Set V%X to bitwise V%X and V%X (Final val:%d)\n",
+				b1&0x0F, b1&0x0F, b2&0xF0>>4, m.regs.v[b1&0x0F])
+		case 0x3:
+			// 8XY3	BitOp	Vx=Vx^Vy	Sets VX to VX xor VY.
+			m.regs.v[b1&0x0F] = m.regs.v[b1&0x0F] ^ m.regs.v[b2&0xF0>>4]
+			m.resetFlagForLogic()
+			m.tracef("Set V%X to bitwise V%X xor V%X (Final val:%d)\n",
+				b1&0x0F, b1&0x0F, b2&0xF0>>4, m.regs.v[b1&0x0F])
+		case 0x4:
+			// 8XY4	Math	Vx += Vy	Adds VY to VX. VF is set to 1 when
+			// there's a carry, and to 0 when there isn't.
+			// VF is set last, so it holds the flag when it is VX.
+			total := int(m.regs.v[b1&0x0F]) + int(m.regs.v[b2&0xF0>>4])
+			m.tracef("Set V%X to V%X (val:%d) + V%X (val:%d) (Final val:%d)",
+				b1&0x0F, b1&0x0F, m.regs.v[b1&0x0F], b2&0xF0>>4, m.regs.v[b2&0xF0>>4], byte(total))
+			m.regs.v[b1&0x0F] = byte(total)
+			if total >= 256 {
+				m.regs.v[0xF] = 1
+				m.tracef(" => CARRY OVER\n")
 			} else {
-				fmt.Printf(" ==> DO NOT SKIP NEXT INTRUCTION\n")
+				m.regs.v[0xF] = 0
+				m.tracef(" => NOT CARRY OVER\n")
 			}
+		case 0x5:
+			// 8XY5	Math	Vx -= Vy	VY is subtracted from VX.
+			// VF is set to 0 when there's a borrow, and 1 when there isn't.
+			sub := int(m.regs.v[b1&0x0F]) - int(m.regs.v[b2&0xF0>>4])
+			m.tracef("Set V%X to V%X (val:%d) - V%X (val:%d) (Final val:%d)",
+				b1&0x0F, b1&0x0F, m.regs.v[b1&0x0F], b2&0xF0>>4, m.regs.v[b2&0xF0>>4], byte(sub))
+			m.subtract(b1&0x0F, sub)
+		case 0x6:
+			// 8XY6	BitOp	Vx>>=1	Stores the least significant bit of VX in VF and then shifts VX to the right by 1
+			// Without the Shift quirk VY is shifted into VX
+			src := m.shiftSource(b1, b2)
+			oldVal := m.regs.v[src]
+			m.regs.v[b1&0x0F] = oldVal >> 1
+			m.regs.v[0xF] = oldVal & 1
+			m.tracef("Store the least significant bit of V%X (val:%d) in VF then shift it into V%X to the right by 1 (final val:%d)\n",
+				src, oldVal, b1&0x0F, m.regs.v[b1&0x0F])
+		case 0x7:
+			// 8XY7	Math	Vx=Vy-Vx	Sets VX to VY minus VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
+			sub := int(m.regs.v[b2&0xF0>>4]) - int(m.regs.v[b1&0x0F])
+			m.tracef("Set V%X to V%X (val:%d) - V%X (val:%d) (Final val:%d)",
+				b1&0x0F, b2&0xF0>>4, m.regs.v[b2&0xF0>>4], b1&0x0F, m.regs.v[b1&0x0F], byte(sub))
+			m.subtract(b1&0x0F, sub)
+		case 0xE:
+			// 8XYE	BitOp	Vx<<=1	Stores the most significant bit of VX in VF and then shifts VX to the left by 1.
+			// Without the Shift quirk VY is shifted into VX
+			src := m.shiftSource(b1, b2)
+			oldVal := m.regs.v[src]
+			m.regs.v[b1&0x0F] = oldVal << 1
+			m.regs.v[0xF] = oldVal >> 7
+			m.tracef("Store the most significant bit of V%X (val:%d) in VF then shift it into V%X to the left by 1 (final val:%d)\n",
+				src, oldVal, b1&0x0F, m.regs.v[b1&0x0F])
+		default:
+			m.tracef("-------------> Unknown statement !!! Data:0x%X\n", val)
+			return ErrStopped
+		}
 
-		case val >= 0x5000 && val <= 0x5FFF:
-			switch b2 & 0xF {
-			case 0x0:
-				// 5XY0	Cond	if(Vx==Vy)	Skips the next instruction if VX equals VY.
-				// (Usually the next instruction is a jump to skip a code block)
-				fmt.Printf("Skip next instr if V%X (val:%d) equals V%X (val:%d)",
-					b1&0x0F, regs.v[b1&0x0F], b2&0xF0>>4, regs.v[b2&0xF0>>4])
-				if regs.v[b1&0x0F] == regs.v[b2&0xF0>>4] {
-					regs.progCounter += 2
-					fmt.Printf(" ==> SKIP NEXT INTRUCTION\n")
-				} else {
-					fmt.Printf(" ==> DO NOT SKIP NEXT INTRUCTION\n")
-				}
-			default:
-				fmt.Printf("-------------> Unknown statement !!! Data:0x%X\n", val)
-				return nil
-			}
+	case val >= 0x9000 && val <= 0x9FFF:
+		// 9XY0	Cond	if(Vx!=Vy)	Skips the next instruction if VX doesn't equal VY.
+		// (Usually the next instruction is a jump to skip a code block)
+		m.tracef("Skip next instr if V%X (val:%d) doesn't equal to V%X (val:%d)",
+			b1&0xF, m.regs.v[b1&0xF], b2&0xF0>>4, m.regs.v[b2&0xF0>>4])
+		if m.regs.v[b1&0x0F] != m.regs.v[b2&0xF0>>4] {
+			m.regs.progCounter += 2
+			m.tracef(" ==> SKIP NEXT INTRUCTION\n")
+		} else {
+			m.tracef(" ==> DO NOT SKIP NEXT INTRUCTION\n")
+		}
 
-		case val >= 0x6000 && val <= 0x6FFF:
-			// 6XNN	Const	Vx = NN	Sets VX to NN.
-			regs.v[b1&0x0F] = byte(b2)
-			fmt.Printf("Set V%X to 0x%X (%d)\n", b1&0x0F, b2, b2)
-
-		case val >= 0x7000 && val <= 0x7FFF:
-			// 7XNN	Const	Vx += NN	Adds NN to VX. (Carry flag is not changed)
-			regs.v[b1&0x0F] = regs.v[b1&0x0F] + byte(b2)
-			fmt.Printf("Add %d to V%X (final val:%d)\n", b2, b1&0x0F, regs.v[b1&0x0F])
-
-		case val >= 0x8000 && val <= 0x8FFF:
-			switch b2 & 0xF {
-			case 0x0:
-				// 8XY0	Assign	Vx=Vy	Sets VX to the value of VY.
-				regs.v[b1&0x0F] = regs.v[b2&0xF0>>4]
-				fmt.Printf("Set V%X to value of V%X (val:%d)\n",
-					b1&0x0F, b2&0xF0>>4, regs.v[b1&0x0F])
-			case 0x1:
-				// 8XY1	BitOp	Vx=Vx|Vy	Sets VX to VX or VY. (Bitwise OR operation)
-				regs.v[b1&0x0F] = regs.v[b1&0x0F] ^ regs.v[b2&0xF0>>4]
-				fmt.Printf("Set V%X to bitwise V%X or V%X (Final val:%d)\n",
-					b1&0x0F, b1&0x0F, b2&0xF0>>4, regs.v[b1&0x0F])
-			case 0x2:
-				// 8XY2	BitOp	Vx=Vx&Vy	Sets VX to VX and VY. (Bitwise AND operation)
-				regs.v[b1&0x0F] = regs.v[b1&0x0F] & regs.v[b2&0xF0>>4]
-				fmt.Printf("Set V%X to bitwise V%X and V%X (Final val:%d)\n",
-					b1&0x0F, b1&0x0F, b2&0xF0>>4, regs.v[b1&0x0F])
-			case 0x3:
-				// 8XY3	BitOp	Vx=Vx^Vy	Sets VX to VX xor VY.
-				regs.v[b1&0x0F] = regs.v[b1&0x0F] ^ regs.v[b2&0xF0>>4]
-				fmt.Printf("Set V%X to bitwise V%X xor V%X (Final val:%d)\n",
-					b1&0x0F, b1&0x0F, b2&0xF0>>4, regs.v[b1&0x0F])
-			case 0x4:
-				// 8XY4	Math	Vx += Vy	Adds VY to VX. VF is set to 1 when
-				// there's a carry, and to 0 when there isn't.
-				total := int(regs.v[b1&0x0F]) + int(regs.v[b2&0xF0>>4])
-				if total >= 256 {
-					total -= 256
-					regs.v[0xF] = 1
-				} else {
-					regs.v[0xF] = 0
-				}
-				fmt.Printf("Set V%X to V%X (val:%d) + V%X (val:%d) (Final val:%d)",
-					b1&0x0F, b1&0x0F, regs.v[b1&0x0F], b2&0xF0>>4, regs.v[b2&0xF0>>4], total)
-				if regs.v[0xF] == 1 {
-					fmt.Printf(" => CARRY OVER\n")
-				} else {
-					fmt.Printf(" => NOT CARRY OVER\n")
-				}
-				regs.v[b1&0x0F] = byte(total)
-			case 0x5:
-				// 8XY5	Math	Vx -= Vy	VY is subtracted from VX.
-				// VF is set to 0 when there's a borrow, and 1 when there isn't.
-				sub := int(regs.v[b1&0x0F]) - int(regs.v[b2&0xF0>>4])
-				if sub < 0 {
-					sub += 256
-					regs.v[0xF] = 1
-				} else {
-					regs.v[0xF] = 0
-				}
-				fmt.Printf("Set V%X to V%X (val:%d) - V%X (val:%d) (Final val:%d)",
-					b1&0x0F, b1&0x0F, regs.v[b1&0x0F], b2&0xF0>>4, regs.v[b2&0xF0>>4], sub)
-				if regs.v[0xF] == 1 {
-					fmt.Printf(" => BORROWED\n")
-				} else {
-					fmt.Printf(" => NOT BORROWED\n")
-				}
-				regs.v[b1&0x0F] = byte(sub)
-			case 0x6:
-				// 8XY6	BitOp	Vx>>=1	Stores the least significant bit of VX in VY and then shifts VX to the right by 1
-				oldVal := regs.v[b1&0x0F]
-				regs.v[b2&0xF0>>4] = regs.v[b1&0x0F] & 1
-				regs.v[b1&0x0F] = regs.v[b1&0x0F] >> 1
-				fmt.Printf("Store the least significant bit of V%X (val:%d) in V%X then shift V%X to the right by 1 (final val:%d)\n",
-					b1&0x0F, oldVal, b2&0xF0>>4, regs.v[b2&0xF0>>4], regs.v[b1&0x0F])
-			case 0x7:
-				// 8XY7	Math	Vx=Vy-Vx	Sets VX to VY minus VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
-				sub := int(regs.v[b2&0xF0>>4]) - int(regs.v[b1&0x0F])
-				if sub < 0 {
-					sub += 256
-					regs.v[0xF] = 1
-				} else {
-					regs.v[0xF] = 0
+	case val >= 0xA000 && val <= 0xAFFF:
+		// ANNN	MEM	I = NNN	Sets I to the address NNN.
+		m.regs.index = val & 0xFFF
+		m.tracef("Set I (memory pointer) to 0x%X (%d)\n", val&0xFFF, val&0xFFF)
+
+	case val >= 0xB000 && val <= 0xBFFF:
+		// BNNN	Flow	PC=V0+NNN	Jumps to the address NNN plus V0.
+		// With the Jump quirk it is BXNN, jumping to XNN plus VX
+		reg := uint16(0)
+		if m.Quirks.Jump {
+			reg = b1 & 0xF
+		}
+		jumpAddress := val&0xFFF + uint16(m.regs.v[reg])
+		m.tracef("Jump to address 0x%X plus V%X (val:0x%X) (Final add:0x%X)\n",
+			val&0xFFF, reg, m.regs.v[reg], jumpAddress)
+		m.regs.progCounter = jumpAddress - 2
+
+	case val >= 0xC000 && val <= 0xCFFF:
+		// CXNN	Rand	Vx=rand()&NN	Sets VX to the result of a bitwise and operation
+		// on a random number (Typically: 0 to 255) and NN.
+		m.regs.v[b1&0xF] = byte(b2) & m.rand.byte()
+		m.tracef("Set V%X random value 0x%X (%d)\n", b1&0xF, m.regs.v[b1&0xF], m.regs.v[b1&0xF])
+
+	case val >= 0xD000 && val <= 0xDFFF:
+		// DXYN	Disp	draw(Vx,Vy,N)	Draws a sprite at coordinate (VX, VY) that
+		// has a width of 8 pixels and a height of N pixels. Each row of 8 pixels is
+		// read as bit-coded starting from memory location I; I value doesn’t change
+		// after the execution of this instruction. As described above, VF is set to
+		// 1 if any screen pixels are flipped from set to unset when the sprite is drawn,
+		// and to 0 if that doesn’t happen
+		//  Display resolution is 64×32 pixels, or 128x64 in hires
+		// The sprite starts at (VX, VY) modulo the board size. Its pixels past
+		// the edges are clipped, or wrap around with the Wrap quirk.
+		var valSlice []byte
+		X := b1 & 0xF
+		Y := (b2 & 0xF0) >> 4
+		height := int(b2 & 0xF)
+		width, rows := m.board.Width(), m.board.Height()
+		x, y := int(m.regs.v[X])%width, int(m.regs.v[Y])%rows
+		visibleWidth, visibleHeight := 8, height
+		if !m.Quirks.Wrap {
+			visibleWidth = int(math.Min(float64(width-x), 8))
+			visibleHeight = int(math.Min(float64(rows-y), float64(height)))
+		}
+		m.tracef("Draw a sprite at coor (V%X:%d, V%X:%d) width 8 (visible: %d) pixels height %d (visible: %d) pixels ",
+			X, m.regs.v[X], Y, m.regs.v[Y], visibleWidth, height, visibleHeight)
+		if err := m.checkMemory(val, visibleHeight); err != nil {
+			return err
+		}
+		sprite := Sprite{X: x, Y: y, Width: visibleWidth, Height: visibleHeight}
+		m.regs.v[0xF] = 0
+		for i := 0; i < visibleHeight; i++ {
+			value := byte(m.memory[m.regs.index+uint16(i)])
+			m.touch(m.regs.index+uint16(i), AccessSprite, 1)
+			digits := getDigits(value)
+			for j := 0; j < visibleWidth; j++ {
+				if !digits[j] {
+					continue
 				}
-				fmt.Printf("Set V%X to V%X (val:%d) - V%X (val:%d) (Final val:%d)",
-					b1&0x0F, b2&0xF0>>4, regs.v[b2&0xF0>>4], b1&0x0F, regs.v[b1&0x0F], sub)
-				if regs.v[0xF] == 1 {
-					fmt.Printf(" => BORROWED\n")
+				px, py := (x+j)%width, (y+i)%rows
+				tile := &m.board.tiles[py][px]
+				if *tile > 0 {
+					*tile = 0
+					m.regs.v[0xF] = 1
+					sprite.Collisions = append(sprite.Collisions, image.Pt(px, py))
 				} else {
-					fmt.Printf(" => NOT BORROWED\n")
+					*tile = 1
 				}
-				regs.v[b1&0x0F] = byte(sub)
-			case 0xE:
-				// 8XYE	BitOp	Vx<<=1	Stores the most significant bit of VX in VF and then shifts VX to the left by 1.
-				oldVal := regs.v[b1&0x0F]
-				regs.v[b2&0xF0>>4] = regs.v[b1&0x0F] & 0x80
-				regs.v[b1&0x0F] = regs.v[b1&0x0F] << 1
-				fmt.Printf("Store the most significant bit of V%X (val:%d) in V%X then shift V%X to the left by 1 (final val:%d)\n",
-					b1&0x0F, oldVal, b2&0xF0>>4, regs.v[b2&0xF0>>4], regs.v[b1&0x0F])
-			default:
-				fmt.Printf("-------------> Unknown statement !!! Data:0x%X\n", val)
-				return nil
 			}
-
-		case val >= 0x9000 && val <= 0x9FFF:
-			// 9XY0	Cond	if(Vx!=Vy)	Skips the next instruction if VX doesn't equal VY.
+			valSlice = append(valSlice, value)
+		}
+		m.board.sprite = sprite
+		m.tracef("(valSlice:%d)\n", valSlice)
+		m.dirty = true
+		m.vblank = m.Quirks.VBlank
+
+	case val >= 0xE000 && val <= 0xEFFF:
+		switch b2 {
+		case 0x9E:
+			// EX9E	KeyOp	if(key()==Vx)	Skips the next instruction if the key stored in VX is pressed.
 			// (Usually the next instruction is a jump to skip a code block)
-			fmt.Printf("Skip next instr if V%X (val:%d) doesn't equal to V%X (val:%d)",
-				b1&0xF, regs.v[b1&0xF], b2&0xF0>>4, regs.v[b2&0xF0>>4])
-			if regs.v[b1&0x0F] != regs.v[b2&0xF0>>4] {
-				regs.progCounter += 2
-				fmt.Printf(" ==> SKIP NEXT INTRUCTION\n")
+			m.tracef("Skip instruction if key %d is pressed", b1&0xF)
+			if m.isKeyPressed(m.regs.v[b1&0x0F]) {
+				m.regs.progCounter += 2
+				m.tracef(" ==> SKIP NEXT INTRUCTION\n")
 			} else {
-				fmt.Printf(" ==> DO NOT SKIP NEXT INTRUCTION\n")
+				m.tracef(" ==> DO NOT SKIP NEXT INTRUCTION\n")
 			}
+		case 0xA1:
+			//EXA1	KeyOp	if(key()!=Vx)	Skips the next instruction if the key stored in VX
+			// isn't pressed. (Usually the next instruction is a jump to skip a code block)
+			m.tracef("Skip instruction if key %d is not pressed", b1&0xF)
+			if !m.isKeyPressed(m.regs.v[b1&0x0F]) {
+				m.regs.progCounter += 2
+				m.tracef(" ==> SKIP NEXT INTRUCTION\n")
+			} else {
+				m.tracef(" ==> DO NOT SKIP NEXT INTRUCTION\n")
+			}
+		default:
+			m.tracef("-------------> Unknown statement !!! Data:0x%X\n", val)
+			return ErrStopped
+		}
 
-		case val >= 0xA000 && val <= 0xAFFF:
-			// ANNN	MEM	I = NNN	Sets I to the address NNN.
-			regs.index = val & 0xFFF
-			fmt.Printf("Set I (memory pointer) to 0x%X (%d)\n", val&0xFFF, val&0xFFF)
-
-		case val >= 0xB000 && val <= 0xBFFF:
-			// BNNN	Flow	PC=V0+NNN	Jumps to the address NNN plus V0.
-			regs.progCounter = val&0xFFF + uint16(regs.v[0])
-			fmt.Printf("Jump to address 0x%X plus V0 (val:0x%X) (Final add:0x%X)\n",
-				val&0xFFF, regs.v[0], regs.progCounter)
-
-		case val >= 0xC000 && val <= 0xCFFF:
-			// CXNN	Rand	Vx=rand()&NN	Sets VX to the result of a bitwise and operation
-			// on a random number (Typically: 0 to 255) and NN.
-			regs.v[b1&0xF] = byte(b2 & uint16(rand.Int31n(256)))
-			fmt.Printf("Set V%X random value 0x%X (%d)\n", b1&0xF, regs.v[b1&0xF], regs.v[b1&0xF])
-
-		case val >= 0xD000 && val <= 0xDFFF:
-			// DXYN	Disp	draw(Vx,Vy,N)	Draws a sprite at coordinate (VX, VY) that
-			// has a width of 8 pixels and a height of N pixels. Each row of 8 pixels is
-			// read as bit-coded starting from memory location I; I value doesn’t change
-			// after the execution of this instruction. As described above, VF is set to
-			// 1 if any screen pixels are flipped from set to unset when the sprite is drawn,
-			// and to 0 if that doesn’t happen
-			//  Display resolution is 64×32 pixels
-			var valSlice []byte
-			X := b1 & 0xF
-			Y := (b2 & 0xF0) >> 4
-			height := byte(b2 & 0xF)
-			visiblePixelsHorizontally := byte(math.Min(float64(pixelsHorizontally-regs.v[X]), 8))
-			visiblePixelsVertically := byte(math.Min(float64(pixelsVertically-regs.v[Y]), float64(height)))
-			fmt.Printf("Draw a sprite at coor (V%X:%d, V%X:%d) width 8 (visible: %d) pixels height %d (visible: %d) pixels ",
-				X, regs.v[X], Y, regs.v[Y], visiblePixelsHorizontally, height, visiblePixelsVertically)
-			if regs.v[X] > pixelsHorizontally {
-				fmt.Printf("\nerror: Out of horizontal pixels\n")
+	case val >= 0xF000:
+		switch b2 {
+		case 0x0:
+			// Stop
+			m.tracef("Stop\n")
+			return ErrStopped
+		case 0x7:
+			//FX07	Timer	Vx = get_delay()	Sets VX to the value of the delay timer.
+			m.regs.v[b1&0xF] = m.getDelay()
+			m.tracef("Set V%X to the value of the delay timer\n", b1&0xF)
+		case 0xA:
+			//FX0A	KeyOp	Vx = get_key()	A key press is awaited, and then stored in VX.
+			// (Blocking Operation. All instruction halted until next key event)
+			m.tracef("A key press is awaited, and then stored in V%X Blocking operation\n", b1&0xF)
+			key, ok := m.anyKeyPressed()
+			if !ok {
+				// Run this instruction again until a key is pressed
 				return nil
 			}
-			if regs.v[Y] > pixelsVertically {
-				fmt.Printf("\nerror: Out of vertical pixels\n")
-				return nil
+			m.regs.v[b1&0xF] = key
+			m.tracef("Set V%X as %d\n", b1&0xF, m.regs.v[b1&0xF])
+		case 0x15:
+			// FX15	Timer	delay_timer(Vx)	Sets the delay timer to VX.
+			m.setDelayTimer(byte(b1) & 0xF)
+			m.tracef("Set the delay timer to V%X (val:%d)\n", b1&0xF, m.regs.v[b1&0xF])
+		case 0x18:
+			// FX18	Sound	sound_timer(Vx)	Sets the sound timer to VX.
+			m.setSoundTimer(byte(b1) & 0xF)
+			m.tracef("Set the sound timer to V%X (val:%d)\n", b1&0xF, m.regs.v[b1&0xF])
+		case 0x1E:
+			// FX1E	MEM	I +=Vx	Adds VX to I
+			m.regs.index = m.regs.index + uint16(m.regs.v[b1&0xF])
+			m.tracef("Add V%X (val:%d) to I (final val:%d)\n", b1&0xF, m.regs.v[b1&0xF], m.regs.index)
+		case 0x29:
+			// FX29	MEM	I=sprite_addr[Vx]	Sets I to the location of the sprite for the character in VX.
+			// Characters 0-F (in hexadecimal) are represented by a 4x5 font.
+			// All sprites are 5 bytes long, so the location of the specified sprite
+			// is its index multiplied by 5.
+			m.regs.index = screenMemoryStart + uint16(m.regs.v[b1&0xF])*5
+			m.tracef("Set I to the location (0x%X) of the sprite for the character in V%X (val:%d)\n",
+				m.regs.index, b1&0xF, m.regs.v[b1&0xF])
+		case 0x33:
+			// FX33	BCD	set_BCD(Vx);
+			// *(I+0)=BCD(3);  *(I+1)=BCD(2);  *(I+2)=BCD(1);
+			// Stores the binary-coded decimal representation of VX, with the most significant of
+			// three digits at the address in I, the middle digit at I plus 1, and the least significant
+			// digit at I plus 2. (In other words, take the decimal representation of VX, place the
+			// hundreds digit in memory at location in I, the tens digit at location I+1, and the ones
+			// digit at location I+2.)
+			if err := m.checkMemory(val, 3); err != nil {
+				return err
 			}
-			for i := byte(0); i < visiblePixelsVertically; i++ {
-				value := byte(memory[regs.index+uint16(i)])
-				digits := getDigits(value)
-				for j := byte(0); j < visiblePixelsHorizontally; j++ {
-					if digits[j] {
-						pixels[regs.v[Y]+i][regs.v[X]+j] = 1
-					} else {
-						pixels[regs.v[Y]+i][regs.v[X]+j] = 0
-					}
-				}
-				valSlice = append(valSlice, value)
+			m.memory[m.regs.index] = byte(m.regs.v[b1&0xF] / 100)
+			m.memory[m.regs.index+1] = byte(m.regs.v[b1&0xF]%100) / 10
+			m.memory[m.regs.index+2] = m.regs.v[b1&0xF] % 10
+			m.touch(m.regs.index, AccessWrite, 3)
+			m.tracef("Store BCD of V%X (val:%d) at memory index:0x%X)\n", b1&0xF, m.regs.v[b1&0xF], m.regs.index)
+		case 0x55:
+			// FX55	MEM	reg_dump(Vx,&I)	Stores V0 to VX (including VX) in memory starting at address I.
+			// The offset from I is increased by 1 for each value written, but I itself is left unmodified.
+			if err := m.checkMemory(val, int(b1&0xF)+1); err != nil {
+				return err
 			}
-			fmt.Printf("(valSlice:%d)\n", valSlice)
-			drawScreen()
-
-		case val >= 0xE000 && val <= 0xEFFF:
-			switch b2 {
-			case 0x9E:
-				// EX9E	KeyOp	if(key()==Vx)	Skips the next instruction if the key stored in VX is pressed.
-				// (Usually the next instruction is a jump to skip a code block)
-				fmt.Printf("Skip instruction if key %d is pressed", b1&0xF)
-				if keyPressed == regs.v[b1&0x0F] {
-					regs.progCounter += 2
-					fmt.Printf(" ==> SKIP NEXT INTRUCTION\n")
-				} else {
-					fmt.Printf(" ==> DO NOT SKIP NEXT INTRUCTION\n")
-				}
-			case 0xA1:
-				//EXA1	KeyOp	if(key()!=Vx)	Skips the next instruction if the key stored in VX
-				// isn't pressed. (Usually the next instruction is a jump to skip a code block)
-				fmt.Printf("Skip instruction if key %d is not pressed", b1&0xF)
-				if keyPressed != regs.v[b1&0x0F] {
-					regs.progCounter += 2
-					fmt.Printf(" ==> SKIP NEXT INTRUCTION\n")
-				} else {
-					fmt.Printf(" ==> DO NOT SKIP NEXT INTRUCTION\n")
-				}
-			default:
-				fmt.Printf("-------------> Unknown statement !!! Data:0x%X\n", val)
-				return nil
+			var valSlice []byte
+			for i := uint16(0); i <= b1&0xF; i++ {
+				m.memory[m.regs.index+i] = m.regs.v[i]
+				m.touch(m.regs.index+i, AccessWrite, 1)
+				valSlice = append(valSlice, m.regs.v[i])
 			}
-
-		case val >= 0xF000:
-			switch b2 {
-			case 0x0:
-				// Stop
-				fmt.Printf("Stop\n")
-				return nil
-			case 0x7:
-				//FX07	Timer	Vx = get_delay()	Sets VX to the value of the delay timer.
-				regs.v[b1&0xF] = getDelay()
-				fmt.Printf("Set V%X to the value of the delay timer\n", b1&0xF)
-			case 0xA:
-				//FX0A	KeyOp	Vx = get_key()	A key press is awaited, and then stored in VX.
-				// (Blocking Operation. All instruction halted until next key event)
-				fmt.Printf("A key press is awaited, and then stored in V%X Blocking operation\n", b1&0xF)
-				keyPressed, _ = readKeyboard()
-				regs.v[b1&0xF] = keyPressed
-				fmt.Printf("Set V%X as %d\n", b1&0xF, regs.v[b1&0xF])
-			case 0x15:
-				// FX15	Timer	delay_timer(Vx)	Sets the delay timer to VX.
-				setDelayTimer(byte(b1) & 0xF)
-				fmt.Printf("Set the delay timer to V%X (val:%d)\n", b1&0xF, regs.v[b1&0xF])
-			case 0x18:
-				// FX18	Sound	sound_timer(Vx)	Sets the sound timer to VX.
-				setSoundTimer(byte(b1) & 0xF)
-				fmt.Printf("Set the sound timer to V%X (val:%d)\n", b1&0xF, regs.v[b1&0xF])
-			case 0x1E:
-				// FX1E	MEM	I +=Vx	Adds VX to I
-				regs.index = regs.index + uint16(regs.v[b1&0xF])
-				fmt.Printf("Add V%X (val:%d) to I (final val:%d)\n", b1&0xF, regs.v[b1&0xF], regs.index)
-			case 0x29:
-				// FX29	MEM	I=sprite_addr[Vx]	Sets I to the location of the sprite for the character in VX.
-				// Characters 0-F (in hexadecimal) are represented by a 4x5 font.
-				// All sprites are 5 bytes long, so the location of the specified sprite
-				// is its index multiplied by 5.
-				regs.index = screenMemoryStart + uint16(regs.v[b1&0xF])*5
-				fmt.Printf("Set I to the location (0x%X) of the sprite for the character in V%X (val:%d)\n",
-					regs.index, b1&0xF, regs.v[b1&0xF])
-			case 0x33:
-				// FX33	BCD	set_BCD(Vx);
-				// *(I+0)=BCD(3);  *(I+1)=BCD(2);  *(I+2)=BCD(1);
-				// Stores the binary-coded decimal representation of VX, with the most significant of
-				// three digits at the address in I, the middle digit at I plus 1, and the least significant
-				// digit at I plus 2. (In other words, take the decimal representation of VX, place the
-				// hundreds digit in memory at location in I, the tens digit at location I+1, and the ones
-				// digit at location I+2.)
-				memory[regs.index] = byte(regs.v[b1&0xF] / 100)
-				memory[regs.index+1] = byte(regs.v[b1&0xF]%100) / 10
-				memory[regs.index+2] = regs.v[b1&0xF] % 10
-				fmt.Printf("Store BCD of V%X (val:%d) at memory index:0x%X)\n", b1&0xF, regs.v[b1&0xF], regs.index)
-			case 0x55:
-				// FX55	MEM	reg_dump(Vx,&I)	Stores V0 to VX (including VX) in memory starting at address I.
-				// The offset from I is increased by 1 for each value written, but I itself is left unmodified.
-				var valSlice []byte
-				for i := uint16(0); i <= b1&0xF; i++ {
-					memory[regs.index+i] = regs.v[i]
-					valSlice = append(valSlice, regs.v[i])
-				}
-				fmt.Printf("Store V0 to V%X (valSlice:%d) in memory starting 0x%X\n", b1&0xF, valSlice, regs.index)
-			case 0x65:
-				// FX65	MEM	reg_load(Vx,&I)	Fills V0 to VX (including VX) with values from memory starting
-				// at address I. The offset from I is increased by 1 for each value written, but I
-				// itself is left unmodified.
-				var valSlice []byte
-				for i := uint16(0); i <= b1&0xF; i++ {
-					regs.v[i] = memory[regs.index+i]
-					valSlice = append(valSlice, regs.v[i])
-				}
-				fmt.Printf("Fill V0 to V%X with values (valSlice:%d) at memory\n", b1&0xF, valSlice)
-			default:
-				fmt.Printf("-------------> Unknown statement !!! Data:0x%X\n", val)
-				return nil
+			m.tracef("Store V0 to V%X (valSlice:%d) in memory starting 0x%X\n", b1&0xF, valSlice, m.regs.index)
+			m.incrementIndexForMemory(b1 & 0xF)
+		case 0x65:
+			// FX65	MEM	reg_load(Vx,&I)	Fills V0 to VX (including VX) with values from memory starting
+			// at address I. The offset from I is increased by 1 for each value written, but I
+			// itself is left unmodified.
+			if err := m.checkMemory(val, int(b1&0xF)+1); err != nil {
+				return err
 			}
-
+			var valSlice []byte
+			for i := uint16(0); i <= b1&0xF; i++ {
+				m.regs.v[i] = m.memory[m.regs.index+i]
+				m.touch(m.regs.index+i, AccessRead, 1)
+				valSlice = append(valSlice, m.regs.v[i])
+			}
+			m.tracef("Fill V0 to V%X with values (valSlice:%d) at memory\n", b1&0xF, valSlice)
+			m.incrementIndexForMemory(b1 & 0xF)
 		default:
-			fmt.Printf("-------------> Unknown statement !!! Data:0x%X\n", val)
-			return nil
+			m.tracef("-------------> Unknown statement !!! Data:0x%X\n", val)
+			return ErrStopped
 		}
-		regs.progCounter += 2
+
+	default:
+		m.tracef("-------------> Unknown statement !!! Data:0x%X\n", val)
+		return ErrStopped
 	}
+	m.regs.progCounter += 2
 	return nil
 }
 
-func readKeyboard() (byte, error) {
-	reader := bufio.NewReader(os.Stdin)
-	for true {
-		char, _, err := reader.ReadRune()
-		if err != nil {
-			fmt.Println(err)
-			return 0, err
+// checkMemory returns a MemoryError if the n bytes from I an instruction
+// uses are not all in memory
+func (m *Machine) checkMemory(op uint16, n int) error {
+	if end := int(m.regs.index) + n; end > memorySize {
+		m.tracef("-------------> Past the end of memory !!! Data:0x%X\n", op)
+		addr := int(m.regs.index)
+		if addr < memorySize {
+			addr = memorySize
 		}
+		return &MemoryError{PC: m.regs.progCounter, Opcode: op, Addr: addr}
+	}
+	return nil
+}
+
+// shiftSource returns the register shifted by 8XY6 and 8XYE
+func (m *Machine) shiftSource(b1, b2 uint16) uint16 {
+	if m.Quirks.Shift {
+		return b1 & 0x0F
+	}
+	return b2 & 0xF0 >> 4
+}
+
+// subtract sets VX to the result of 8XY5 or 8XY7, then VF to 0 if it
+// borrowed and to 1 if it did not
+func (m *Machine) subtract(x uint16, sub int) {
+	m.regs.v[x] = byte(sub)
+	if sub < 0 {
+		m.regs.v[0xF] = 0
+		m.tracef(" => BORROWED\n")
+	} else {
+		m.regs.v[0xF] = 1
+		m.tracef(" => NOT BORROWED\n")
+	}
+}
 
-		chStr := unicode.ToUpper(char)
-		switch chStr {
-		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 'A', 'B', 'C', 'D', 'E', 'F':
-			result, _ := strconv.ParseUint(string(chStr), 16, 64)
-			return byte(result), nil
+func (m *Machine) resetFlagForLogic() {
+	if m.Quirks.Logic {
+		m.regs.v[0xF] = 0
+	}
+}
+
+// incrementIndexForMemory moves I past the registers stored or loaded by
+// FX55 and FX65
+func (m *Machine) incrementIndexForMemory(x uint16) {
+	switch {
+	case m.Quirks.MemoryLeaveIUnchanged:
+	case m.Quirks.MemoryIncrementByX:
+		m.regs.index += x
+	default:
+		m.regs.index += x + 1
+	}
+}
+
+func (m *Machine) isKeyPressed(key byte) bool {
+	return m.keys&(1<<(key&0xF)) != 0
+}
+
+func (m *Machine) anyKeyPressed() (byte, bool) {
+	for key := byte(0); key < 16; key++ {
+		if m.isKeyPressed(key) {
+			return key, true
 		}
 	}
+	return 0, false
+}
 
-	return 0, nil
+func (m *Machine) tracef(format string, a ...interface{}) {
+	if m.Trace != nil {
+		fmt.Fprintf(m.Trace, format, a...)
+	}
 }
 
 func getDigits(x byte) [8]bool {
@@ -469,19 +828,19 @@ func getDigits(x byte) [8]bool {
 	return val
 }
 
-func setDelayTimer(variableIndex byte) {
-	regs.delayTimer = regs.v[variableIndex]
+func (m *Machine) setDelayTimer(variableIndex byte) {
+	m.regs.delayTimer = m.regs.v[variableIndex]
 }
 
-func getDelay() byte {
-	return regs.delayTimer
+func (m *Machine) getDelay() byte {
+	return m.regs.delayTimer
 }
 
-func setSoundTimer(variableIndex byte) {
-	regs.soundTimer = regs.v[variableIndex]
+func (m *Machine) setSoundTimer(variableIndex byte) {
+	m.regs.soundTimer = m.regs.v[variableIndex]
 }
 
-func initSprites() {
+func (m *Machine) initSprites() {
 	sprites := []byte{
 		0xF0, 0x90, 0x90, 0x90, 0xF0, //0
 		0x20, 0x60, 0x20, 0x20, 0x70, //1
@@ -500,5 +859,5 @@ func initSprites() {
 		0xF0, 0x80, 0xF0, 0x80, 0xF0, //E
 		0xF0, 0x80, 0xF0, 0x80, 0x80, //F
 	}
-	copy(memory[screenMemoryStart:], sprites)
+	copy(m.memory[screenMemoryStart:], sprites)
 }
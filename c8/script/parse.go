@@ -0,0 +1,376 @@
+package script
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+type token struct {
+	text string // Lower case for names, unquoted for strings, "\n" at the end of lines
+	str  bool   // Quoted string
+	line int
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case c == '\n':
+			tokens = append(tokens, token{text: "\n", line: line})
+			line++
+			i++
+		case unicode.IsSpace(c):
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != '"' {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			text, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid string %s", line, src[i:j+1])
+			}
+			tokens = append(tokens, token{text: text, str: true, line: line})
+			i = j + 1
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{text: strings.ToLower(src[i:j]), line: line})
+			i = j
+		case strings.ContainsRune("=!<>", c) && i+1 < len(src) && src[i+1] == '=':
+			tokens = append(tokens, token{text: src[i : i+2], line: line})
+			i += 2
+		case strings.ContainsRune("=<>+-*/%&|()", c):
+			tokens = append(tokens, token{text: src[i : i+1], line: line})
+			i++
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", line, c)
+		}
+	}
+	return append(tokens, token{text: "\n", line: line}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	script *Script
+
+	line     int             // Of the expression being read
+	inEvent  bool            // Reading an exec or write handler, where addr is known
+	used     []use           // Variables read
+	assigned map[string]bool // Variables set
+}
+
+// use is a variable read by an expression
+type use struct {
+	name string
+	line int
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{line: p.tokens[len(p.tokens)-1].line}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.peek().line, fmt.Sprintf(format, a...))
+}
+
+func (p *parser) expect(text string) error {
+	if t := p.peek(); t.text != text || t.str {
+		if text == "\n" {
+			return p.errorf("unexpected %q at the end of the statement", t.text)
+		}
+		return p.errorf("expected %q, not %q", text, t.text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) skipLines() {
+	for p.pos < len(p.tokens) && p.peek().text == "\n" {
+		p.next()
+	}
+}
+
+// parse reads the statements of the top level and the handlers
+func (p *parser) parse(s *Script) error {
+	p.script, p.assigned = s, map[string]bool{}
+	for p.skipLines(); p.pos < len(p.tokens); p.skipLines() {
+		if p.peek().text != "on" {
+			st, err := p.statement()
+			if err != nil {
+				return err
+			}
+			s.init = append(s.init, st)
+			continue
+		}
+
+		p.next()
+		h := handler{event: p.next().text}
+		switch h.event {
+		case "frame":
+		case "exec", "write":
+			t := p.peek()
+			addr, err := strconv.ParseUint(t.text, 0, 12)
+			if t.str || err != nil {
+				return p.errorf("on %s wants a constant address", h.event)
+			}
+			p.next()
+			h.addr = uint16(addr)
+		default:
+			return p.errorf("unknown event %q, want frame, exec or write", h.event)
+		}
+		p.inEvent = h.event != "frame"
+		body, end, err := p.block()
+		p.inEvent = false
+		if err != nil {
+			return err
+		}
+		if end != "end" {
+			return p.errorf("else outside of if")
+		}
+		h.body = body
+		s.handlers = append(s.handlers, h)
+	}
+	return p.checkVariables()
+}
+
+// block reads statements up to the end or else closing them, which it
+// returns
+func (p *parser) block() ([]statement, string, error) {
+	if err := p.expect("\n"); err != nil {
+		return nil, "", err
+	}
+	var body []statement
+	for p.skipLines(); ; p.skipLines() {
+		if p.pos >= len(p.tokens) {
+			return nil, "", p.errorf("missing end")
+		}
+		switch t := p.peek(); t.text {
+		case "end":
+			p.next()
+			return body, t.text, p.expect("\n")
+		case "else":
+			// The block after else starts with the rest of the line
+			p.next()
+			return body, t.text, nil
+		case "on":
+			return nil, "", p.errorf("on inside a block")
+		}
+		st, err := p.statement()
+		if err != nil {
+			return nil, "", err
+		}
+		body = append(body, st)
+	}
+}
+
+func (p *parser) statement() (statement, error) {
+	t := p.next()
+	st := statement{line: t.line, command: t.text}
+	if t.str {
+		return st, fmt.Errorf("line %d: unexpected string", t.line)
+	}
+
+	var err error
+	switch t.text {
+	case "if", "while":
+		if st.cond, err = p.expr(); err != nil {
+			return st, err
+		}
+		var end string
+		if st.body, end, err = p.block(); err != nil {
+			return st, err
+		}
+		if end == "else" {
+			if t.text == "while" {
+				return st, fmt.Errorf("line %d: else in while", t.line)
+			}
+			if st.els, end, err = p.block(); err != nil {
+				return st, err
+			}
+			if end == "else" {
+				return st, fmt.Errorf("line %d: second else", t.line)
+			}
+		}
+		return st, nil
+	case "press", "release":
+		st.args, err = p.exprs(1)
+	case "rect":
+		st.args, err = p.exprs(4)
+	case "text":
+		if st.args, err = p.exprs(2); err == nil {
+			st.items, err = p.items()
+		}
+	case "print":
+		st.items, err = p.items()
+	case "color":
+		c := p.next()
+		if !c.str {
+			return st, fmt.Errorf("line %d: color wants a string such as \"#FF0000\"", t.line)
+		}
+		st.name = c.text
+	case "snapshot", "restore":
+		n := p.next()
+		if st.name = n.text; n.str || !isName(st.name) {
+			return st, fmt.Errorf("line %d: %s wants a name", t.line, t.text)
+		}
+	case "stop":
+	case "let":
+		st.command = "="
+		if st.name = p.next().text; !isName(st.name) || keywords[st.name] || register(st.name) >= 0 {
+			return st, fmt.Errorf("line %d: let wants a variable name", t.line)
+		}
+		err = p.assignment(&st)
+	case "byte", "word":
+		st.command, st.name = "=", t.text
+		if st.args, err = p.exprs(1); err == nil {
+			err = p.assignment(&st)
+		}
+	default:
+		if !isName(t.text) || keywords[t.text] {
+			return st, fmt.Errorf("line %d: unexpected %q", t.line, t.text)
+		}
+		st.command, st.name = "=", t.text
+		err = p.assignment(&st)
+	}
+	if err != nil {
+		return st, err
+	}
+	return st, p.expect("\n")
+}
+
+func (p *parser) assignment(st *statement) error {
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	if register(st.name) < 0 && !keywords[st.name] {
+		p.assigned[st.name] = true
+	}
+	value, err := p.expr()
+	st.value = value
+	return err
+}
+
+// exprs reads n expressions
+func (p *parser) exprs(n int) ([]*c8.Expr, error) {
+	var exprs []*c8.Expr
+	for i := 0; i < n; i++ {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	return exprs, nil
+}
+
+// items reads strings and expressions up to the end of the line
+func (p *parser) items() ([]item, error) {
+	var items []item
+	for p.peek().text != "\n" || p.peek().str {
+		if t := p.peek(); t.str {
+			p.next()
+			items = append(items, item{text: t.text})
+			continue
+		}
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item{expr: e})
+	}
+	return items, nil
+}
+
+var keywords = map[string]bool{
+	"on": true, "end": true, "if": true, "else": true, "while": true, "let": true,
+	"and": true, "or": true, "not": true, "byte": true, "word": true, "delta": true, "prev": true,
+	"press": true, "release": true, "print": true, "text": true, "rect": true, "color": true,
+	"snapshot": true, "restore": true, "stop": true,
+}
+
+// expr reads a c8.Expr, up to the first token that does not continue it
+func (p *parser) expr() (*c8.Expr, error) {
+	line := p.peek().line
+	var texts []string
+	for _, t := range p.tokens[p.pos:] {
+		if t.str || t.text == "\n" {
+			break
+		}
+		texts = append(texts, t.text)
+	}
+	p.line = line
+	e, n, err := c8.ParseExprTokens(texts, p.name)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", line, err)
+	}
+	p.pos += n
+	return e, nil
+}
+
+// name gives the value of addr and of the variables in expressions
+func (p *parser) name(name string) (func(now, prev *c8.View) int, error) {
+	s := p.script
+	switch {
+	case name == "addr":
+		if !p.inEvent {
+			return nil, fmt.Errorf("addr is only known on exec and write")
+		}
+		return func(now, prev *c8.View) int { return s.addr }, nil
+	case keywords[name] || !isName(name):
+		return nil, nil
+	}
+	p.used = append(p.used, use{name, p.line})
+	return func(now, prev *c8.View) int { return s.vars[name] }, nil
+}
+
+// checkVariables returns an error for the first variable read but never
+// set
+func (p *parser) checkVariables() error {
+	for _, u := range p.used {
+		if !p.assigned[u.name] {
+			return fmt.Errorf("line %d: unknown variable %s", u.line, u.name)
+		}
+	}
+	return nil
+}
+
+func isName(s string) bool {
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		return false
+	}
+	for _, c := range s {
+		if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,346 @@
+// Package script runs user scripts on a machine, for bots, automated tests
+// and overlays. A script is made of statements, one per line, run once when
+// it is attached, and of handlers run on events:
+//
+//	# Keep the paddle of BRIX under the ball
+//	on frame
+//		release 4
+//		release 6
+//		if VC + 4 > V6
+//			press 4
+//		else
+//			press 6
+//		end
+//		text 0 0 "score " V5
+//	end
+//
+//	on exec 0x2A4
+//		print "ball lost at frame " frame
+//	end
+//
+// The events are
+//
+//	on frame         after every frame
+//	on exec ADDR     when execution reaches ADDR, before the instruction
+//	on write ADDR    after an instruction wrote to ADDR
+//
+// and the statements
+//
+//	NAME = EXPR            sets a variable, let NAME = EXPR is the same
+//	V0 = EXPR              sets a register: V0 to VF, I, PC, DT or ST
+//	byte ADDR = EXPR       writes memory, word ADDR = EXPR writes 2 bytes
+//	if EXPR ... else ... end
+//	while EXPR ... end
+//	press KEY              holds a hex key down until released
+//	release KEY
+//	print ITEMS            prints strings and expressions on a line
+//	text X Y ITEMS         draws them on the overlay
+//	rect X Y WIDTH HEIGHT  fills a rectangle of the overlay
+//	color "#RRGGBB"        colour of the rectangles drawn next
+//	snapshot NAME          saves the state of the machine
+//	restore NAME           goes back to a saved state
+//	stop                   stops the machine
+//
+// Expressions are those of c8.Expr, the same as the conditions of
+// achievements, with the variables and addr for the address of the exec or
+// write event being handled. Variables are 0 until set, and reading one
+// that is set nowhere in the script is an error. delta and prev compare
+// the machine with the end of the previous frame. Names are not case
+// sensitive. Overlay coordinates are board pixels, and the overlay shows
+// what was drawn during the last frame.
+package script
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"io/ioutil"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// maxSteps bounds the statements a handler runs, against endless loops
+const maxSteps = 1000000
+
+// Script is a parsed script. It can be attached to a single machine.
+type Script struct {
+	name     string
+	init     []statement
+	handlers []handler
+
+	m         *c8.Machine
+	overlay   c8.Overlay
+	out       io.Writer
+	vars      map[string]int
+	keys      uint16 // Held by press
+	snapshots map[string]*c8.Snapshot
+	color     color.RGBA
+	shapes    []c8.Shape // Drawn since the end of the last frame
+	addr      int        // Of the event being handled
+	steps     int        // Run by the handler
+	view      *c8.View   // Of the machine now, nil once it may have changed
+	prev      *c8.View   // At the end of the previous frame
+}
+
+type handler struct {
+	event string // frame, exec or write
+	addr  uint16
+	body  []statement
+}
+
+// statement is an assignment, when command is "=", or a command
+type statement struct {
+	line    int
+	command string
+	name    string     // Assigned, or of the snapshot or colour
+	args    []*c8.Expr // Address assigned, or of the command
+	items   []item     // Printed
+	value   *c8.Expr   // Assigned
+	cond    *c8.Expr
+	body    []statement
+	els     []statement
+}
+
+// item is a string or an expression printed
+type item struct {
+	text string
+	expr *c8.Expr
+}
+
+// Load parses a script. name is used in errors.
+func Load(name string, r io.Reader) (*Script, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := lex(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	s := &Script{name: name}
+	if err := (&parser{tokens: tokens}).parse(s); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return s, nil
+}
+
+// Attach runs the top level statements of the script and hooks its
+// handlers onto a machine that has just read its ROM. print writes to out,
+// and text and rect draw on overlay when it is not nil.
+func (s *Script) Attach(m *c8.Machine, overlay c8.Overlay, out io.Writer) error {
+	if s.m != nil {
+		return fmt.Errorf("%s: already attached", s.name)
+	}
+	s.m, s.overlay, s.out = m, overlay, out
+	s.vars = map[string]int{}
+	s.snapshots = map[string]*c8.Snapshot{}
+	s.color = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+
+	next := m.Input
+	m.Input = func(frame uint64, keys uint16) uint16 {
+		if next != nil {
+			keys = next(frame, keys)
+		}
+		return keys | s.keys
+	}
+	for _, h := range s.handlers {
+		body := h.body
+		switch h.event {
+		case "frame":
+			m.AddFrameHook(func() error { return s.handle(body, -1) })
+		case "exec":
+			m.AddExecHook(h.addr, func(addr uint16) error { return s.handle(body, int(addr)) })
+		case "write":
+			m.AddWriteHook(h.addr, func(addr uint16) error { return s.handle(body, int(addr)) })
+		}
+	}
+	m.AddFrameHook(func() error {
+		s.prev = m.View()
+		return nil
+	})
+	if s.overlay != nil {
+		m.AddFrameHook(func() error {
+			s.overlay.SetShapes(s.shapes)
+			s.shapes = s.shapes[:0]
+			return nil
+		})
+	}
+	return s.handle(s.init, -1)
+}
+
+// handle runs the statements of an event
+func (s *Script) handle(body []statement, addr int) error {
+	s.addr, s.steps, s.view = addr, 0, nil
+	if err := s.run(body); err != nil {
+		return fmt.Errorf("%s:%v", s.name, err)
+	}
+	return nil
+}
+
+// errorAt is a runtime error, reported with its line
+type errorAt struct {
+	line int
+	err  string
+}
+
+func (e *errorAt) Error() string {
+	return fmt.Sprintf("%d: %s", e.line, e.err)
+}
+
+func (s *Script) run(body []statement) error {
+	for i := range body {
+		if err := s.exec(&body[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Script) exec(st *statement) error {
+	if s.steps++; s.steps > maxSteps {
+		return &errorAt{st.line, fmt.Sprintf("more than %d statements run for one event", maxSteps)}
+	}
+	args := s.evalAll(st.args)
+
+	switch st.command {
+	case "=":
+		return s.assign(st, args)
+	case "if":
+		if s.eval(st.cond) != 0 {
+			return s.run(st.body)
+		}
+		return s.run(st.els)
+	case "while":
+		for s.eval(st.cond) != 0 {
+			if err := s.run(st.body); err != nil {
+				return err
+			}
+			if s.steps++; s.steps > maxSteps {
+				return &errorAt{st.line, fmt.Sprintf("more than %d statements run for one event", maxSteps)}
+			}
+		}
+	case "press", "release":
+		if args[0] < 0 || args[0] > 0xF {
+			return &errorAt{st.line, fmt.Sprintf("there is no key %d", args[0])}
+		}
+		if st.command == "press" {
+			s.keys |= 1 << uint(args[0])
+		} else {
+			s.keys &^= 1 << uint(args[0])
+		}
+	case "print":
+		fmt.Fprintln(s.out, s.format(st.items))
+	case "text":
+		s.shapes = append(s.shapes, c8.Shape{Text: s.format(st.items), X: args[0], Y: args[1], Color: s.color})
+	case "rect":
+		s.shapes = append(s.shapes, c8.Shape{X: args[0], Y: args[1], Width: args[2], Height: args[3], Color: s.color})
+	case "color":
+		clr, err := c8.ParseColor(st.name)
+		if err != nil {
+			return &errorAt{st.line, err.Error()}
+		}
+		s.color = clr
+	case "snapshot":
+		s.snapshots[st.name] = s.m.Snapshot()
+	case "restore":
+		snapshot, ok := s.snapshots[st.name]
+		if !ok {
+			return &errorAt{st.line, fmt.Sprintf("no snapshot %s", st.name)}
+		}
+		if err := s.m.Restore(snapshot); err != nil {
+			return &errorAt{st.line, err.Error()}
+		}
+		s.view = nil
+	case "stop":
+		s.m.Stop()
+	}
+	return nil
+}
+
+func (s *Script) assign(st *statement, args []int) error {
+	val := s.eval(st.value)
+	switch st.name {
+	case "byte":
+		s.m.Poke(uint16(args[0]&0xFFF), byte(val))
+		s.view = nil
+		return nil
+	case "word":
+		s.m.Poke(uint16(args[0]&0xFFF), byte(val>>8))
+		s.m.Poke(uint16((args[0]+1)&0xFFF), byte(val))
+		s.view = nil
+		return nil
+	case "frame", "keys", "addr":
+		return &errorAt{st.line, fmt.Sprintf("%s cannot be set", st.name)}
+	}
+
+	r := register(st.name)
+	if r < 0 {
+		s.vars[st.name] = val
+		return nil
+	}
+	state := s.m.State()
+	switch {
+	case r < 16:
+		state.V[r] = byte(val)
+	case st.name == "i":
+		state.I = uint16(val)
+	case st.name == "pc":
+		state.PC = uint16(val)
+	case st.name == "dt":
+		state.DelayTimer = byte(val)
+	case st.name == "st":
+		state.SoundTimer = byte(val)
+	}
+	s.m.SetState(state)
+	s.view = nil
+	return nil
+}
+
+// register returns the index of a V register, 16 for the others, or -1
+// when the name is not a register
+func register(name string) int {
+	switch name {
+	case "i", "pc", "dt", "st":
+		return 16
+	}
+	if len(name) == 2 && name[0] == 'v' {
+		for r, digit := range "0123456789abcdef" {
+			if rune(name[1]) == digit {
+				return r
+			}
+		}
+	}
+	return -1
+}
+
+func (s *Script) format(items []item) string {
+	var text string
+	for _, it := range items {
+		if it.expr == nil {
+			text += it.text
+			continue
+		}
+		text += fmt.Sprint(s.eval(it.expr))
+	}
+	return text
+}
+
+func (s *Script) evalAll(exprs []*c8.Expr) []int {
+	vals := make([]int, len(exprs))
+	for i, e := range exprs {
+		vals[i] = s.eval(e)
+	}
+	return vals
+}
+
+// eval evaluates an expression on the machine as it is now
+func (s *Script) eval(e *c8.Expr) int {
+	if s.view == nil {
+		s.view = s.m.View()
+	}
+	prev := s.prev
+	if prev == nil {
+		prev = s.view
+	}
+	return e.Eval(s.view, prev)
+}
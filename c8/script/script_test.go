@@ -0,0 +1,214 @@
+package script
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// counter counts the frames in V0 at a tick rate of 4, and writes the
+// count as decimal digits to 0x300: V0 += 1, I = 0x300, BCD of V0 at I,
+// jump back
+var counter = []byte{0x70, 0x01, 0xA3, 0x00, 0xF0, 0x33, 0x12, 0x00}
+
+// run attaches a script to a machine running counter and runs frames,
+// returning what the script printed
+func run(t *testing.T, src string, frames int) (string, *c8.Machine, error) {
+	s, err := Load("test", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := c8.NewMachine()
+	if err := m.LoadROM(bytes.NewReader(counter)); err != nil {
+		t.Fatal(err)
+	}
+	m.TickRate = 4
+	var out bytes.Buffer
+	if err := s.Attach(m, nil, &out); err != nil {
+		return out.String(), m, err
+	}
+	for i := 0; i < frames; i++ {
+		if err := m.RunFrame(); err != nil {
+			return out.String(), m, err
+		}
+	}
+	return out.String(), m, nil
+}
+
+func TestLex(t *testing.T) {
+	tokens, err := lex("Let x_1 = V0>=0x10 # comment\n\tprint \"a \\\"b\\\"\" x_1|2&3\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, t := range tokens {
+		texts = append(texts, t.text)
+	}
+	want := []string{"let", "x_1", "=", "v0", ">=", "0x10", "\n", "print", `a "b"`, "x_1", "|", "2", "&", "3", "\n", "\n"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("lexed %q, want %q", texts, want)
+	}
+	if !tokens[8].str || tokens[9].str || tokens[9].line != 2 {
+		t.Errorf("string token is %+v and name %+v", tokens[8], tokens[9])
+	}
+
+	for _, src := range []string{`print "open`, "print \"two\nlines\"", "x = 1 $ 2", "x = !1"} {
+		if _, err := lex(src); err == nil {
+			t.Errorf("%q lexed", src)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	errors := []struct {
+		src, err string
+	}{
+		{"x = 1 +\n", "line 1: unexpected end of expression"},
+		{"x = (1\n", "line 1: missing )"},
+		{"x = 1 2\n", `line 1: unexpected "2" at the end of the statement`},
+		{"print y\n", "line 1: unknown variable y"},
+		{"x = addr\n", "line 1: addr is only known on exec and write"},
+		{"on frame\nprint addr\nend\n", "line 2: addr is only known on exec and write"},
+		{"on exec V0\nend\n", "line 1: on exec wants a constant address"},
+		{"on exec 0x1000\nend\n", "line 1: on exec wants a constant address"},
+		{"on key 1\nend\n", `line 1: unknown event "key", want frame, exec or write`},
+		{"on frame\nstop\n", "line 3: missing end"},
+		{"if 1\nelse\nelse\nend\n", "line 1: second else"},
+		{"while 1\nelse\nend\n", "line 1: else in while"},
+		{"else\n", `line 1: unexpected "else"`},
+		{"let v0 = 1\n", "line 1: let wants a variable name"},
+		{"let not = 1\n", "line 1: let wants a variable name"},
+		{"color red\n", `line 1: color wants a string such as "#FF0000"`},
+		{"snapshot \"a\"\n", "line 1: snapshot wants a name"},
+		{"rect 1 2 3\n", "line 1: unexpected end of expression"},
+	}
+	for _, test := range errors {
+		_, err := Load("test", strings.NewReader(test.src))
+		if want := "test: " + test.err; err == nil || err.Error() != want {
+			t.Errorf("%q returned %v, want %s", test.src, err, want)
+		}
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	out, _, err := run(t, `
+x = 7
+let y = x / 0
+print "x " x " y " y
+print 6 | 3 & 5 " " -x % 4 " " not x == 0 " " (1 or y / 0) and 2
+print 1 == 1 and x > 6 " " word 0x200
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "x 7 y 0\n7 -3 1 1\n1 28673\n"; out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	out, m, err := run(t, `
+calls = 0
+on exec 0x204
+	calls = calls + 1
+	if V0 == 3
+		print "exec " addr " V0 " V0 " frame " frame
+	end
+end
+on write 0x302
+	if byte 0x302 == 5 and delta V0 > 0
+		print "write " addr " digit " byte addr
+		VA = 0xAA
+	end
+end
+on frame
+	print "frame " frame " calls " calls " V0 " V0 " prev " prev V0
+end
+`, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A frame runs the loop once, and nothing changed before the first
+	want := "frame 1 calls 1 V0 1 prev 1\n" +
+		"frame 2 calls 2 V0 2 prev 1\n" +
+		"exec 516 V0 3 frame 3\n" +
+		"frame 3 calls 3 V0 3 prev 2\n" +
+		"frame 4 calls 4 V0 4 prev 3\n" +
+		"write 770 digit 5\n" +
+		"frame 5 calls 5 V0 5 prev 4\n"
+	if out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+	if m.State().V[0xA] != 0xAA {
+		t.Errorf("VA is %02X, want the value set by the write handler", m.State().V[0xA])
+	}
+}
+
+func TestStatements(t *testing.T) {
+	out, m, err := run(t, `
+i = 0
+while i < 3
+	i = i + 1
+end
+byte 0x400 = 0x1FF
+word 0x402 = 0xBEEF
+V1 = 0x123
+press 4
+press 6
+release 4
+snapshot start
+on frame
+	if frame == 1
+		restore start
+		print "restored V0 " V0 " frame " frame
+		stop
+	end
+end
+print i " " byte 0x400 " " byte 0x402 " " byte 0x403 " " V1
+`, 2)
+	if err != c8.ErrStopped {
+		t.Errorf("the second frame returned %v after stop", err)
+	}
+	if want := "3 255 190 239 35\nrestored V0 0 frame 0\n"; out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+	if keys := m.Input(0, 1); keys != 1|1<<6 {
+		t.Errorf("keys held are %04X, want 6 and the keys given", keys)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	errors := []struct {
+		src, err string
+	}{
+		{"press 16\n", "test:2: there is no key 16"},
+		{"restore nothing\n", "test:2: no snapshot nothing"},
+		{"frame = 1\n", "test:2: frame cannot be set"},
+		{"color \"red\"\n", `test:2: invalid colour "red"`},
+		{"while 1\nend\n", "test:2: more than 1000000 statements run for one event"},
+		{"on frame\n\ti = 0\n\twhile 1\n\t\ti = i + 1\n\tend\nend\n", "test:5: more than 1000000 statements run for one event"},
+	}
+	for _, test := range errors {
+		_, _, err := run(t, "\n"+test.src, 1)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q returned %v, want %s", test.src, err, test.err)
+		}
+	}
+}
+
+func TestAttachTwice(t *testing.T) {
+	s, err := Load("test", strings.NewReader("x = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := s.Attach(c8.NewMachine(), nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Attach(c8.NewMachine(), nil, &out); err == nil {
+		t.Errorf("a script was attached twice")
+	}
+}
@@ -0,0 +1,132 @@
+package c8
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Snapshot is everything a machine needs to go on running exactly as it
+// would have from the moment it was taken. The backends, the trace and the
+// memory accesses are not part of it.
+type Snapshot struct {
+	Memory     []byte
+	V          [16]byte
+	I          uint16
+	PC         uint16
+	DelayTimer byte
+	SoundTimer byte
+	Stack      []uint16 // Return addresses, innermost last
+
+	Hires bool
+	Board []byte // One byte per pixel of the hires board, row after row
+
+	Quirks   Quirks
+	TickRate int
+	Seed     uint64
+	Random   uint64 // State of the random numbers drawn since the seed
+
+	Keys         uint16
+	Beep         bool
+	Instructions uint64
+	Frames       uint64
+}
+
+// Snapshot returns a copy of the state of the machine
+func (m *Machine) Snapshot() *Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := &Snapshot{
+		Memory:       append([]byte(nil), m.memory...),
+		I:            m.regs.index,
+		PC:           m.regs.progCounter,
+		DelayTimer:   m.regs.delayTimer,
+		SoundTimer:   m.regs.soundTimer,
+		Hires:        m.board.hires,
+		Board:        make([]byte, 0, MaxBoardWidth*MaxBoardHeight),
+		Quirks:       m.Quirks,
+		TickRate:     m.TickRate,
+		Seed:         m.seed,
+		Random:       m.rand.state,
+		Keys:         m.keys,
+		Beep:         m.beep,
+		Instructions: m.instructions,
+		Frames:       m.frames,
+	}
+	copy(s.V[:], m.regs.v)
+	for _, sp := range m.stack {
+		s.Stack = append(s.Stack, sp.progCounter)
+	}
+	for row := range m.board.tiles {
+		s.Board = append(s.Board, m.board.tiles[row][:]...)
+	}
+	return s
+}
+
+// Restore puts the machine back in the state of a snapshot
+func (m *Machine) Restore(s *Snapshot) error {
+	if len(s.Memory) != memorySize {
+		return fmt.Errorf("snapshot has %d bytes of memory, want %d", len(s.Memory), memorySize)
+	}
+	if len(s.Board) != MaxBoardWidth*MaxBoardHeight {
+		return fmt.Errorf("snapshot has %d pixels, want %d", len(s.Board), MaxBoardWidth*MaxBoardHeight)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	copy(m.memory, s.Memory)
+	copy(m.regs.v, s.V[:])
+	m.regs.index = s.I
+	m.regs.progCounter = s.PC
+	m.regs.delayTimer = s.DelayTimer
+	m.regs.soundTimer = s.SoundTimer
+	m.stack = m.stack[:0]
+	for _, pc := range s.Stack {
+		m.stack = append(m.stack, stackPtr{progCounter: pc})
+	}
+
+	m.board.hires = s.Hires
+	m.board.sprite = Sprite{}
+	for row := range m.board.tiles {
+		copy(m.board.tiles[row][:], s.Board[row*MaxBoardWidth:])
+	}
+	m.dirty = true
+
+	m.Quirks = s.Quirks
+	m.TickRate = s.TickRate
+	m.seed = s.Seed
+	m.rand.state = s.Random
+	m.keys = s.Keys
+	if s.Beep != m.beep {
+		m.Audio.Beep(s.Beep)
+	}
+	m.beep = s.Beep
+	m.instructions = s.Instructions
+	m.frames = s.Frames
+	m.stopped = false
+	return nil
+}
+
+// Checksum returns a CRC-32 of the snapshot, for comparing the states of
+// machines that should be in sync
+func (s *Snapshot) Checksum() uint32 {
+	data, _ := json.Marshal(s)
+	return crc32.ChecksumIEEE(data)
+}
+
+// Write saves the snapshot as JSON
+func (s *Snapshot) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// ReadSnapshot reads a snapshot saved by Write
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	s := &Snapshot{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,79 @@
+package c8_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"github.com/erdincmutlu/CHIP-8/c8/c8test"
+)
+
+// beeper sounds the buzzer for two frames and draws the 0 of the font one
+// pixel further every frame
+var beeper = []byte{
+	0x60, 0x03, // V0 = 3
+	0xF0, 0x18, // Sound timer = V0
+	0xF0, 0x29, // I = sprite of V0
+	0xD1, 0x15, // Draw 5 rows at V1,V1
+	0x71, 0x01, // V1 += 1
+	0x12, 0x06, // Draw again
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	m := c8.NewMachine()
+	if err := m.LoadROM(bytes.NewReader(beeper)); err != nil {
+		t.Fatal(err)
+	}
+	display, audio := &c8test.Display{}, &c8test.Audio{}
+	m.Display, m.Audio = display, audio
+	m.TickRate = 4
+	if err := m.RunFrame(); err != nil {
+		t.Fatal(err)
+	}
+	var saved bytes.Buffer
+	if err := m.Snapshot().Write(&saved); err != nil {
+		t.Fatal(err)
+	}
+	before := m.Snapshot()
+
+	var frames []string
+	for i := 0; i < 2; i++ {
+		if err := m.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, display.String())
+	}
+	if beeps := audio.Beeps(); !reflect.DeepEqual(beeps, []bool{true, false}) {
+		t.Fatalf("the buzzer went %v, want on then off", beeps)
+	}
+
+	s, err := c8.ReadSnapshot(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	if beeps := audio.Beeps(); !reflect.DeepEqual(beeps, []bool{true, false, true}) {
+		t.Errorf("the buzzer went %v, want it back on after restoring", beeps)
+	}
+	if after := m.Snapshot(); !reflect.DeepEqual(after, before) {
+		t.Errorf("restored %+v, want %+v", after, before)
+	}
+	for i, want := range frames {
+		if err := m.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+		if got := display.String(); got != want {
+			t.Errorf("frame %d after restoring drew\n%s\nwant\n%s", i+2, got, want)
+		}
+	}
+	if beeps := audio.Beeps(); !reflect.DeepEqual(beeps, []bool{true, false, true, false}) {
+		t.Errorf("the buzzer went %v, want it off again", beeps)
+	}
+
+	if err := m.Restore(&c8.Snapshot{}); err == nil {
+		t.Errorf("an empty snapshot was restored")
+	}
+}
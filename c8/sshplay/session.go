@@ -0,0 +1,336 @@
+package sshplay
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"github.com/erdincmutlu/CHIP-8/c8/terminal"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	clearScreen = "\033[H\033[2J"
+	hideCursor  = "\033[?25l"
+	showCursor  = "\033[?25h"
+	ctrlC       = 3
+	ctrlD       = 4
+	escape      = 27
+
+	// escapeWait is how long the rest of an escape sequence is waited for
+	escapeWait = 20 * time.Millisecond
+)
+
+// session is the menu and the games of an SSH session
+type session struct {
+	s     *Server
+	ch    ssh.Channel
+	out   io.Writer
+	input chan byte // Typed, closed when the client stops sending
+	done  chan struct{}
+
+	mu   sync.Mutex
+	rows int // Of the terminal
+}
+
+func newSession(s *Server, ch ssh.Channel) *session {
+	return &session{s: s, ch: ch, out: crlfWriter{ch}, input: make(chan byte, 64), done: make(chan struct{}), rows: 24}
+}
+
+// Payloads of the requests of a session, see RFC 4254
+type ptyRequest struct {
+	Term          string
+	Cols, Rows    uint32
+	Width, Height uint32
+	Modes         string
+}
+
+type windowChange struct {
+	Cols, Rows    uint32
+	Width, Height uint32
+}
+
+type execRequest struct {
+	Command string
+}
+
+// serve answers the requests of the session. A shell shows the menu, and
+// a command is the name of a ROM to play without it.
+func (ss *session) serve(requests <-chan *ssh.Request) {
+	defer ss.ch.Close()
+	start := make(chan string, 1)
+	go func() {
+		started := false
+		for req := range requests {
+			ok := true
+			switch req.Type {
+			case "pty-req":
+				var pty ptyRequest
+				ok = ssh.Unmarshal(req.Payload, &pty) == nil
+				ss.resize(pty.Rows)
+			case "window-change":
+				var change windowChange
+				ok = ssh.Unmarshal(req.Payload, &change) == nil
+				ss.resize(change.Rows)
+			case "shell", "exec":
+				var cmd execRequest
+				if req.Type == "exec" {
+					ok = ssh.Unmarshal(req.Payload, &cmd) == nil
+				}
+				if ok = ok && !started; ok {
+					started = true
+					start <- strings.TrimSpace(cmd.Command)
+				}
+			case "env":
+			default:
+				ok = false
+			}
+			if req.WantReply {
+				req.Reply(ok, nil)
+			}
+		}
+		if !started {
+			close(start)
+		}
+	}()
+
+	name, ok := <-start
+	if !ok {
+		return
+	}
+	go ss.read()
+	defer close(ss.done)
+	status := ss.run(name)
+	fmt.Fprint(ss.out, showCursor)
+	ss.ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+}
+
+func (ss *session) resize(rows uint32) {
+	if rows == 0 {
+		return
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.rows = int(rows)
+}
+
+// read passes on what the client types until the session is over
+func (ss *session) read() {
+	defer close(ss.input)
+	buf := make([]byte, 256)
+	for {
+		n, err := ss.ch.Read(buf)
+		for _, b := range buf[:n] {
+			select {
+			case ss.input <- b:
+			case <-ss.done:
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// run plays the ROM called name, or those picked in the menu when name is
+// empty, and returns the exit status of the session
+func (ss *session) run(name string) uint32 {
+	if name != "" {
+		for _, r := range ss.s.roms {
+			if strings.EqualFold(r.name, name) {
+				ss.play(r)
+				return 0
+			}
+		}
+		fmt.Fprintf(ss.out, "There is no ROM %q\n", name)
+		return 1
+	}
+
+	selected := 0
+	for {
+		r, ok := ss.menu(&selected)
+		if !ok {
+			fmt.Fprint(ss.out, clearScreen)
+			return 0
+		}
+		if ss.play(r) == io.EOF {
+			return 0
+		}
+	}
+}
+
+// key is what a key typed on the terminal means
+type key int
+
+const (
+	keyNone key = iota
+	keyUp
+	keyDown
+	keyEnter
+	keyQuit
+)
+
+// nextKey reads a key of the menu, reporting false when the client is gone
+func (ss *session) nextKey() (key, bool) {
+	b, ok := <-ss.input
+	if !ok {
+		return keyNone, false
+	}
+	switch b {
+	case 'k', 'K':
+		return keyUp, true
+	case 'j', 'J':
+		return keyDown, true
+	case '\r', '\n', ' ':
+		return keyEnter, true
+	case 'q', 'Q', ctrlC, ctrlD:
+		return keyQuit, true
+	case escape:
+		// Arrows are ESC [ A and ESC [ B, and ESC alone leaves
+		switch string(ss.sequence(2)) {
+		case "[A", "OA":
+			return keyUp, true
+		case "[B", "OB":
+			return keyDown, true
+		case "":
+			return keyQuit, true
+		}
+	}
+	return keyNone, true
+}
+
+// sequence reads up to n more bytes of an escape sequence, as long as they
+// come right away
+func (ss *session) sequence(n int) []byte {
+	var seq []byte
+	timeout := time.After(escapeWait)
+	for len(seq) < n {
+		select {
+		case b, ok := <-ss.input:
+			if !ok {
+				return seq
+			}
+			seq = append(seq, b)
+		case <-timeout:
+			return seq
+		}
+	}
+	return seq
+}
+
+// menu lets the client pick a ROM, reporting false when it leaves instead
+func (ss *session) menu(selected *int) (rom, bool) {
+	roms := ss.s.roms
+	if len(roms) == 0 {
+		fmt.Fprint(ss.out, clearScreen+"There are no ROMs to play\n")
+		return rom{}, false
+	}
+	for {
+		ss.drawMenu(*selected)
+		k, ok := ss.nextKey()
+		if !ok {
+			return rom{}, false
+		}
+		switch k {
+		case keyUp:
+			*selected = (*selected + len(roms) - 1) % len(roms)
+		case keyDown:
+			*selected = (*selected + 1) % len(roms)
+		case keyEnter:
+			return roms[*selected], true
+		case keyQuit:
+			return rom{}, false
+		}
+	}
+}
+
+// menuHelp is shown on top of the menu
+const menuHelp = `CHIP-8 over SSH
+Arrows or j and k to choose, Enter to play, q to leave.
+In a game, the keys 0-9 and A-F are the hex keypad, q comes back here.
+
+`
+
+// drawMenu shows as many ROMs around the selected one as the terminal has
+// rows for
+func (ss *session) drawMenu(selected int) {
+	ss.mu.Lock()
+	rows := ss.rows - strings.Count(menuHelp, "\n") - 1
+	ss.mu.Unlock()
+	if rows < 1 {
+		rows = 1
+	}
+	first := selected - rows/2
+	if first > len(ss.s.roms)-rows {
+		first = len(ss.s.roms) - rows
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	var sb strings.Builder
+	sb.WriteString(hideCursor + clearScreen + menuHelp)
+	for i := first; i < first+rows && i < len(ss.s.roms); i++ {
+		if i == selected {
+			sb.WriteString("> ")
+		} else {
+			sb.WriteString("  ")
+		}
+		sb.WriteString(ss.s.roms[i].name + "\n")
+	}
+	fmt.Fprint(ss.out, sb.String())
+}
+
+// play runs a ROM until q is typed. It returns io.EOF when the client is
+// gone.
+func (ss *session) play(r rom) error {
+	m, err := ss.s.load(r.filename)
+	if err != nil {
+		return ss.pause(fmt.Sprintf("%s: %v", r.name, err))
+	}
+	keys, typed := io.Pipe()
+	defer typed.Close()
+	clock := c8.NewRealTimeClock()
+	defer clock.Stop()
+	m.Display = terminal.NewDisplay(ss.out)
+	m.Keypad = terminal.NewKeypad(keys)
+	m.Audio = terminal.NewAudio(ss.out)
+	m.Clock = clock
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Run()
+	}()
+	for {
+		select {
+		case err := <-done:
+			if err == nil {
+				return ss.pause(r.name + " stopped")
+			}
+			return ss.pause(fmt.Sprintf("%s stopped: %v", r.name, err))
+		case b, ok := <-ss.input:
+			if !ok || b == 'q' || b == 'Q' || b == ctrlC {
+				m.Stop()
+				<-done
+				if !ok {
+					return io.EOF
+				}
+				return nil
+			}
+			typed.Write([]byte{b})
+		}
+	}
+}
+
+// pause shows a message until a key is typed
+func (ss *session) pause(message string) error {
+	fmt.Fprintf(ss.out, "\n%s, press a key\n", message)
+	if _, ok := <-ss.input; !ok {
+		return io.EOF
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Package sshplay serves the games of some directories over SSH. Every
+// connection picks a ROM from a menu and plays it on its own machine,
+// drawn on its terminal by the backends of package terminal. No
+// authentication is asked for.
+package sshplay
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"golang.org/x/crypto/ssh"
+)
+
+// Server serves ROMs over SSH
+type Server struct {
+	config *ssh.ServerConfig
+	roms   []rom
+
+	// Load reads a ROM file into a new machine, with c8.NewMachine and
+	// LoadROM unless it is set
+	Load func(filename string) (*c8.Machine, error)
+}
+
+type rom struct {
+	name     string
+	filename string
+}
+
+// NewServer generates a new Server offering the ROMs of dirs, which
+// identifies itself with hostKey
+func NewServer(hostKey ssh.Signer, dirs ...string) (*Server, error) {
+	s := &Server{config: &ssh.ServerConfig{NoClientAuth: true}}
+	s.config.AddHostKey(hostKey)
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+		for _, file := range files {
+			if file.IsDir() || file.Size() == 0 || file.Name()[0] == '.' {
+				continue
+			}
+			s.roms = append(s.roms, rom{name: file.Name(), filename: filepath.Join(dir, file.Name())})
+		}
+	}
+	return s, nil
+}
+
+// LoadHostKey reads the private key of a server, generating and saving a
+// new one when the file does not exist
+func LoadHostKey(filename string) (ssh.Signer, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(data)
+}
+
+// Serve answers the connections of a listener until it is closed
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(nc, s.config)
+	if err != nil {
+		nc.Close()
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+	for nch := range chans {
+		if nch.ChannelType() != "session" {
+			nch.Reject(ssh.UnknownChannelType, "only sessions are served")
+			continue
+		}
+		ch, requests, err := nch.Accept()
+		if err != nil {
+			continue
+		}
+		go newSession(s, ch).serve(requests)
+	}
+}
+
+func (s *Server) load(filename string) (*c8.Machine, error) {
+	if s.Load != nil {
+		return s.Load(filename)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	m := c8.NewMachine()
+	if err := m.LoadROM(file); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// crlfWriter ends the lines written on a terminal in raw mode, which does
+// not go back to the first column on its own
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(bytes.Replace(p, []byte("\n"), []byte("\r\n"), -1)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
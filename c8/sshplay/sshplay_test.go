@@ -0,0 +1,272 @@
+package sshplay
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"golang.org/x/crypto/ssh"
+)
+
+// drawROM draws the 0 of the font at 5,3 then waits for a key, and clears
+// the board once it is pressed
+var drawROM = []byte{
+	0x60, 0x00, // V0 = 0
+	0xF0, 0x29, // I = sprite of V0
+	0x61, 0x05, // V1 = 5
+	0x62, 0x03, // V2 = 3
+	0xD1, 0x25, // Draw 5 rows at V1,V2
+	0xF3, 0x0A, // V3 = key
+	0x00, 0xE0, // Clear
+	0x12, 0x0C, // Jump to the clear
+}
+
+// emptyBoard is how the terminal shows a board with no pixel lit
+var emptyBoard = "+\r\n" + strings.Repeat("|"+strings.Repeat(" ", 64)+"|\r\n", 32) + "+"
+
+type testServer struct {
+	addr string
+	dir  string
+
+	mu       sync.Mutex
+	machines []*c8.Machine
+}
+
+func newTestServer(t *testing.T) *testServer {
+	dir, err := ioutil.TempDir("", "sshplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, rom := range map[string][]byte{"DRAW": drawROM, "WAIT": {0x12, 0x00}} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), rom, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key, err := LoadHostKey(filepath.Join(dir, "keys", "host"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(key, filepath.Join(dir), filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{dir: dir}
+	s.Load = func(filename string) (*c8.Machine, error) {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		m := c8.NewMachine()
+		if err := m.LoadROM(file); err != nil {
+			return nil, err
+		}
+		ts.mu.Lock()
+		ts.machines = append(ts.machines, m)
+		ts.mu.Unlock()
+		return m, nil
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.addr = l.Addr().String()
+	go s.Serve(l)
+	return ts
+}
+
+func (ts *testServer) machine(i int) *c8.Machine {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.machines[i]
+}
+
+// tty is the terminal side of a session
+type tty struct {
+	session *ssh.Session
+	stdin   io.Writer
+
+	mu  sync.Mutex
+	out bytes.Buffer
+}
+
+func dial(t *testing.T, ts *testServer) *ssh.Client {
+	client, err := ssh.Dial("tcp", ts.addr, &ssh.ClientConfig{
+		User:            "player",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// open starts a session with a PTY, running command or the shell when it
+// is empty
+func open(t *testing.T, client *ssh.Client, command string) *tty {
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.RequestPty("xterm", 40, 80, ssh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	term := &tty{session: session}
+	if term.stdin, err = session.StdinPipe(); err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := stdout.Read(buf)
+			term.mu.Lock()
+			term.out.Write(buf[:n])
+			term.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	if command == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(command)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return term
+}
+
+// waitFor waits until the terminal shows text, then forgets the output up
+// to it
+func (term *tty) waitFor(t *testing.T, text string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		term.mu.Lock()
+		out := term.out.String()
+		if i := strings.Index(out, text); i >= 0 {
+			term.out.Next(i + len(text))
+			term.mu.Unlock()
+			return
+		}
+		term.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("the terminal did not show %q", text)
+}
+
+func (term *tty) send(t *testing.T, keys string) {
+	t.Helper()
+	if _, err := io.WriteString(term.stdin, keys); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMenu(t *testing.T) {
+	ts := newTestServer(t)
+	defer os.RemoveAll(ts.dir)
+	client := dial(t, ts)
+	defer client.Close()
+	term := open(t, client, "")
+
+	term.waitFor(t, "> DRAW\r\n  WAIT\r\n")
+	term.send(t, "j")
+	term.waitFor(t, "  DRAW\r\n> WAIT\r\n")
+	term.send(t, "\033[A")
+	term.waitFor(t, "> DRAW\r\n  WAIT\r\n")
+
+	// The game shows the 0, then clears it when a key is typed
+	term.send(t, "\r")
+	term.waitFor(t, "|     XXXX ")
+	term.waitFor(t, "|     X  X ")
+	term.send(t, "7")
+	term.waitFor(t, emptyBoard)
+	if v3 := ts.machine(0).State().V[3]; v3 != 7 {
+		t.Errorf("V3 is %d after typing 7", v3)
+	}
+
+	// q comes back to the menu, then leaves
+	term.send(t, "q")
+	term.waitFor(t, "> DRAW\r\n  WAIT\r\n")
+	term.send(t, "q")
+	if err := term.session.Wait(); err != nil {
+		t.Errorf("session ended with %v", err)
+	}
+}
+
+func TestMachinePerSession(t *testing.T) {
+	ts := newTestServer(t)
+	defer os.RemoveAll(ts.dir)
+
+	// Two connections, played with the ROM name as the command
+	var terms []*tty
+	for i := 0; i < 2; i++ {
+		client := dial(t, ts)
+		defer client.Close()
+		term := open(t, client, "draw")
+		term.waitFor(t, "|     XXXX ")
+		terms = append(terms, term)
+	}
+	terms[1].send(t, "B")
+	terms[1].waitFor(t, emptyBoard)
+	if v3 := ts.machine(1).State().V[3]; v3 != 0xB {
+		t.Errorf("V3 of the second machine is %d, want 11", v3)
+	}
+	if v3 := ts.machine(0).State().V[3]; v3 != 0 {
+		t.Errorf("V3 of the first machine is %d, want 0", v3)
+	}
+
+	// Leaving the game ends the session
+	terms[0].send(t, "q")
+	if err := terms[0].session.Wait(); err != nil {
+		t.Errorf("session ended with %v", err)
+	}
+}
+
+func TestUnknownROM(t *testing.T) {
+	ts := newTestServer(t)
+	defer os.RemoveAll(ts.dir)
+	client := dial(t, ts)
+	defer client.Close()
+	term := open(t, client, "nope")
+	term.waitFor(t, `There is no ROM "nope"`)
+	err := term.session.Wait()
+	if exit, ok := err.(*ssh.ExitError); !ok || exit.ExitStatus() != 1 {
+		t.Errorf("session ended with %v, want exit status 1", err)
+	}
+}
+
+func TestHostKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "host")
+	created, err := LoadHostKey(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadHostKey(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(created.PublicKey().Marshal(), loaded.PublicKey().Marshal()) {
+		t.Errorf("the host key changed once saved")
+	}
+}
@@ -0,0 +1,110 @@
+package c8
+
+// Access is a set of the ways a byte of memory was used
+type Access byte
+
+// Kinds of memory access
+const (
+	AccessRead Access = 1 << iota
+	AccessWrite
+	AccessExecute
+	AccessSprite // Read by DXYN
+)
+
+// State is a copy of the registers of a machine, for frontends to show
+type State struct {
+	V          [16]byte
+	I          uint16
+	PC         uint16
+	DelayTimer byte
+	SoundTimer byte
+	Stack      []uint16 // Return addresses, innermost last
+	Keys       uint16   // Keypad state of the current frame
+
+	Instructions uint64 // Executed since the ROM was read
+	Frames       uint64 // Run since the ROM was read
+}
+
+// State returns a copy of the registers
+func (m *Machine) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := State{
+		I:            m.regs.index,
+		PC:           m.regs.progCounter,
+		DelayTimer:   m.regs.delayTimer,
+		SoundTimer:   m.regs.soundTimer,
+		Keys:         m.keys,
+		Instructions: m.instructions,
+		Frames:       m.frames,
+	}
+	copy(s.V[:], m.regs.v)
+	for _, sp := range m.stack {
+		s.Stack = append(s.Stack, sp.progCounter)
+	}
+	return s
+}
+
+// SetState changes the registers and timers to those of s. The stack, the
+// keys and the counters are left as they are.
+func (m *Machine) SetState(s State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	copy(m.regs.v, s.V[:])
+	m.regs.index = s.I
+	m.regs.progCounter = s.PC
+	m.regs.delayTimer = s.DelayTimer
+	m.regs.soundTimer = s.SoundTimer
+}
+
+// Peek returns a copy of n bytes of memory starting at addr, stopping at
+// the end of memory
+func (m *Machine) Peek(addr uint16, n int) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if int(addr) >= len(m.memory) {
+		return nil
+	}
+	end := int(addr) + n
+	if end > len(m.memory) {
+		end = len(m.memory)
+	}
+	return append([]byte(nil), m.memory[addr:end]...)
+}
+
+// Poke writes a byte of memory, the program sees it on its next access
+func (m *Machine) Poke(addr uint16, val byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if int(addr) < len(m.memory) {
+		m.memory[addr] = val
+		m.accesses[addr] |= AccessWrite
+	}
+}
+
+// TakeAccesses returns how every byte of memory was used since the
+// previous call
+func (m *Machine) TakeAccesses() []Access {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	accesses := append([]Access(nil), m.accesses...)
+	for i := range m.accesses {
+		m.accesses[i] = 0
+	}
+	return accesses
+}
+
+// touch records an access to n bytes starting at addr
+func (m *Machine) touch(addr uint16, a Access, n int) {
+	for i := 0; i < n && int(addr)+i < len(m.accesses); i++ {
+		m.accesses[int(addr)+i] |= a
+		if a == AccessWrite && len(m.writeHooks[addr+uint16(i)]) > 0 {
+			m.writes = append(m.writes, addr+uint16(i))
+		}
+	}
+}
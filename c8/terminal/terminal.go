@@ -0,0 +1,126 @@
+// Package terminal implements the c8 backends on a text terminal
+package terminal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+const (
+	clearScreen = "\033[H\033[2J"
+
+	// Terminals do not report key releases, so a key is considered held
+	// for a while after it is typed
+	keyHoldTime = 200 * time.Millisecond
+)
+
+// Display draws the board as text
+type Display struct {
+	w io.Writer
+}
+
+// NewDisplay generates a new Display writing to w
+func NewDisplay(w io.Writer) *Display {
+	return &Display{w: w}
+}
+
+// Refresh redraws the whole board
+func (d *Display) Refresh(b *c8.Board) {
+	var sb strings.Builder
+	border := "+" + strings.Repeat("-", b.Width()) + "+\n"
+	sb.WriteString(clearScreen)
+	sb.WriteString(border)
+	for row := 0; row < b.Height(); row++ {
+		sb.WriteString("|")
+		for col := 0; col < b.Width(); col++ {
+			if b.Pixel(row, col) > 0 {
+				sb.WriteString("X")
+			} else {
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("|\n")
+	}
+	sb.WriteString(border)
+	fmt.Fprint(d.w, sb.String())
+}
+
+// Keypad reads hex digits typed on the terminal
+type Keypad struct {
+	mu        sync.Mutex
+	pressedAt [16]time.Time
+}
+
+// NewKeypad generates a new Keypad reading from r until it is exhausted
+func NewKeypad(r io.Reader) *Keypad {
+	k := &Keypad{}
+	go k.read(r)
+	return k
+}
+
+func (k *Keypad) read(r io.Reader) {
+	reader := bufio.NewReader(r)
+	for {
+		char, _, err := reader.ReadRune()
+		if err != nil {
+			return
+		}
+
+		key, ok := hexKey(char)
+		if !ok {
+			continue
+		}
+		k.mu.Lock()
+		k.pressedAt[key] = time.Now()
+		k.mu.Unlock()
+	}
+}
+
+// Keys returns the keys typed within the hold time
+func (k *Keypad) Keys() uint16 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var keys uint16
+	for key, at := range k.pressedAt {
+		if time.Since(at) < keyHoldTime {
+			keys |= 1 << uint(key)
+		}
+	}
+	return keys
+}
+
+func hexKey(char rune) (byte, bool) {
+	char = unicode.ToUpper(char)
+	switch {
+	case char >= '0' && char <= '9':
+		return byte(char - '0'), true
+	case char >= 'A' && char <= 'F':
+		return byte(char-'A') + 10, true
+	}
+	return 0, false
+}
+
+// Audio rings the terminal bell
+type Audio struct {
+	w io.Writer
+}
+
+// NewAudio generates a new Audio writing to w
+func NewAudio(w io.Writer) *Audio {
+	return &Audio{w: w}
+}
+
+// Beep rings the bell when the buzzer starts
+func (a *Audio) Beep(on bool) {
+	if on {
+		fmt.Fprint(a.w, "\a")
+	}
+}
@@ -0,0 +1,171 @@
+package c8
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const timelineHeader = "# CHIP-8 input timeline: one line per frame from frame 1, the hex keys held or - for none"
+
+// WriteTimeline saves the movie as text, to be edited and read back with
+// ReadTimeline. A header gives the ROM hash, seed, tick rate, quirks and
+// checksum, then every frame has a line of the keys held during it:
+//
+//	rom b232ef880bd6060fb45fa6effed7edf0ae95670e
+//	seed 42
+//	tickrate 10
+//	quirks shift memoryLeaveIUnchanged
+//	checksum 543B4529
+//	-
+//	4
+//	4 6
+//
+// Frames can be changed, added or removed. The checksum line must then be
+// removed too, as it no longer matches.
+func (mv *Movie) WriteTimeline(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, timelineHeader)
+	fmt.Fprintf(bw, "rom %s\n", mv.ROMHash)
+	fmt.Fprintf(bw, "seed %d\n", mv.Seed)
+	fmt.Fprintf(bw, "tickrate %d\n", mv.TickRate)
+	var quirks []string
+	for i, set := range mv.Quirks.flags() {
+		if *set {
+			quirks = append(quirks, quirkNames[i])
+		}
+	}
+	fmt.Fprintf(bw, "quirks %s\n", strings.Join(quirks, " "))
+	if mv.Checksum != 0 {
+		fmt.Fprintf(bw, "checksum %08X\n", mv.Checksum)
+	}
+	for frame := uint64(1); frame <= mv.Frames; frame++ {
+		fmt.Fprintln(bw, formatKeys(mv.KeysAt(frame)))
+	}
+	return bw.Flush()
+}
+
+func formatKeys(keys uint16) string {
+	if keys == 0 {
+		return "-"
+	}
+	var held []string
+	for key := uint(0); key < 16; key++ {
+		if keys&(1<<key) != 0 {
+			held = append(held, strconv.FormatUint(uint64(key), 16))
+		}
+	}
+	return strings.ToUpper(strings.Join(held, " "))
+}
+
+// ReadTimeline reads a movie saved by WriteTimeline, after any edits.
+// Everything after a # is a comment. The header lines must all come before
+// the first frame.
+func ReadTimeline(r io.Reader) (*Movie, error) {
+	mv := &Movie{TickRate: defaultTickRate}
+	var keys uint16
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		handled, err := mv.readTimelineHeader(fields)
+		if handled && err == nil && mv.Frames > 0 {
+			err = fmt.Errorf("%s must come before the first frame", fields[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if handled {
+			continue
+		}
+
+		held, err := parseKeys(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		mv.Frames++
+		if held != keys {
+			mv.Inputs = append(mv.Inputs, MovieInput{Frame: mv.Frames, Keys: held})
+			keys = held
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if mv.ROMHash == "" {
+		return nil, fmt.Errorf("timeline has no rom line")
+	}
+	return mv, nil
+}
+
+// readTimelineHeader reads a header line, it returns false for frames
+func (mv *Movie) readTimelineHeader(fields []string) (bool, error) {
+	var err error
+	switch fields[0] {
+	case "rom":
+		if len(fields) != 2 || len(fields[1]) != 40 {
+			return true, fmt.Errorf("rom wants the SHA-1 of the ROM")
+		}
+		mv.ROMHash = strings.ToLower(fields[1])
+	case "seed":
+		if len(fields) != 2 {
+			return true, fmt.Errorf("seed wants a number")
+		}
+		mv.Seed, err = strconv.ParseUint(fields[1], 10, 64)
+	case "tickrate":
+		if len(fields) != 2 {
+			return true, fmt.Errorf("tickrate wants a number")
+		}
+		mv.TickRate, err = strconv.Atoi(fields[1])
+	case "quirks":
+		mv.Quirks = Quirks{}
+		flags := mv.Quirks.flags()
+	quirks:
+		for _, name := range fields[1:] {
+			for i, quirk := range quirkNames {
+				if name == quirk {
+					*flags[i] = true
+					continue quirks
+				}
+			}
+			return true, fmt.Errorf("unknown quirk %q", name)
+		}
+	case "checksum":
+		if len(fields) != 2 {
+			return true, fmt.Errorf("checksum wants a hex number")
+		}
+		var sum uint64
+		sum, err = strconv.ParseUint(fields[1], 16, 32)
+		mv.Checksum = uint32(sum)
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+// parseKeys reads the keys of a frame, hex digits with or without spaces
+func parseKeys(fields []string) (uint16, error) {
+	if len(fields) == 1 && fields[0] == "-" {
+		return 0, nil
+	}
+	var keys uint16
+	for _, field := range fields {
+		for _, char := range field {
+			key, err := strconv.ParseUint(string(char), 16, 8)
+			if err != nil {
+				return 0, fmt.Errorf("%q is not a hex key", char)
+			}
+			keys |= 1 << uint(key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,115 @@
+package c8
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTimelineRoundTrip(t *testing.T) {
+	mv := recordBrix(t)
+	var binary bytes.Buffer
+	if err := mv.Write(&binary); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadMovie(&binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text bytes.Buffer
+	if err := read.WriteTimeline(&text); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(text.String(), "\n"); lines != 6+int(mv.Frames) {
+		t.Errorf("timeline has %d lines, want a header of 6 and %d frames", lines, mv.Frames)
+	}
+	timeline, err := ReadTimeline(&text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(timeline, mv) {
+		t.Errorf("read back %+v, want %+v", timeline, mv)
+	}
+}
+
+func TestReadTimeline(t *testing.T) {
+	const rom = "rom B232EF880BD6060FB45FA6EFFED7EDF0AE95670E\n"
+	mv, err := ReadTimeline(strings.NewReader(rom + `
+seed 42  # Comments and blank lines are skipped
+quirks shift vblank
+
+-
+4
+4 6
+46   # The same keys
+-
+a F
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Movie{
+		ROMHash:  "b232ef880bd6060fb45fa6effed7edf0ae95670e",
+		Seed:     42,
+		Quirks:   Quirks{Shift: true, VBlank: true},
+		TickRate: defaultTickRate,
+		Inputs: []MovieInput{
+			{Frame: 2, Keys: 1 << 4},
+			{Frame: 3, Keys: 1<<4 | 1<<6},
+			{Frame: 5, Keys: 0},
+			{Frame: 6, Keys: 1<<0xA | 1<<0xF},
+		},
+		Frames: 6,
+	}
+	if !reflect.DeepEqual(mv, want) {
+		t.Errorf("read %+v, want %+v", mv, want)
+	}
+
+	errors := []struct {
+		timeline, err string
+	}{
+		{"-\n", "timeline has no rom line"},
+		{rom + "-\nseed 1\n", "line 3: seed must come before the first frame"},
+		{rom + "4\nchecksum 1234ABCD\n", "line 3: checksum must come before the first frame"},
+		{rom + "quirks shift\n-\nquirks\n", "line 4: quirks must come before the first frame"},
+		{rom + "tickrate fast\n", `line 2: strconv.Atoi: parsing "fast": invalid syntax`},
+		{rom + "quirks wrap fast\n", `line 2: unknown quirk "fast"`},
+		{rom + "rom 1234\n", "line 2: rom wants the SHA-1 of the ROM"},
+		{rom + "4 g\n", "line 2: 'g' is not a hex key"},
+	}
+	for _, test := range errors {
+		_, err := ReadTimeline(strings.NewReader(test.timeline))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q returned %v, want %s", test.timeline, err, test.err)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		line string
+		keys uint16
+		err  bool
+	}{
+		{"-", 0, false},
+		{"0", 1, false},
+		{"4 6", 1<<4 | 1<<6, false},
+		{"46", 1<<4 | 1<<6, false},
+		{"4 4", 1 << 4, false},
+		{"c D e", 1<<0xC | 1<<0xD | 1<<0xE, false},
+		{"0123456789ABCDEF", 0xFFFF, false},
+		{"- 4", 0, true},
+		{"x", 0, true},
+		{"10", 1<<1 | 1, false},
+	}
+	for _, test := range tests {
+		keys, err := parseKeys(strings.Fields(test.line))
+		if (err != nil) != test.err || keys != test.keys {
+			t.Errorf("%q parsed as %04X, %v", test.line, keys, err)
+		}
+		if back, _ := parseKeys(strings.Fields(formatKeys(keys))); back != keys {
+			t.Errorf("%q formatted as %q, which parses as %04X", test.line, formatKeys(keys), back)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package vnc
+
+import (
+	"encoding/binary"
+	"image/color"
+)
+
+// pixelFormat is how the colours of the pixels are sent, of which only
+// true colour is supported
+type pixelFormat struct {
+	bitsPerPixel, depth             byte
+	bigEndian, trueColour           bool
+	redMax, greenMax, blueMax       uint16
+	redShift, greenShift, blueShift byte
+}
+
+// defaultFormat is the format of the server, until a viewer asks for
+// another
+var defaultFormat = pixelFormat{
+	bitsPerPixel: 32, depth: 24, trueColour: true,
+	redMax: 255, greenMax: 255, blueMax: 255,
+	redShift: 16, greenShift: 8, blueShift: 0,
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// marshal returns the 16 bytes of the format on the wire
+func (f pixelFormat) marshal() []byte {
+	b := []byte{f.bitsPerPixel, f.depth, boolByte(f.bigEndian), boolByte(f.trueColour), 0, 0, 0, 0, 0, 0, f.redShift, f.greenShift, f.blueShift, 0, 0, 0}
+	binary.BigEndian.PutUint16(b[4:], f.redMax)
+	binary.BigEndian.PutUint16(b[6:], f.greenMax)
+	binary.BigEndian.PutUint16(b[8:], f.blueMax)
+	return b
+}
+
+func unmarshalFormat(b []byte) pixelFormat {
+	return pixelFormat{
+		bitsPerPixel: b[0], depth: b[1], bigEndian: b[2] != 0, trueColour: b[3] != 0,
+		redMax:   binary.BigEndian.Uint16(b[4:]),
+		greenMax: binary.BigEndian.Uint16(b[6:]),
+		blueMax:  binary.BigEndian.Uint16(b[8:]),
+		redShift: b[10], greenShift: b[11], blueShift: b[12],
+	}
+}
+
+// pixel returns the bytes of a colour
+func (f pixelFormat) pixel(c color.RGBA) []byte {
+	v := uint32(c.R)*uint32(f.redMax)/255<<f.redShift |
+		uint32(c.G)*uint32(f.greenMax)/255<<f.greenShift |
+		uint32(c.B)*uint32(f.blueMax)/255<<f.blueShift
+	b := make([]byte, 4)
+	switch {
+	case f.bitsPerPixel == 8:
+		return []byte{byte(v)}
+	case f.bitsPerPixel == 16 && f.bigEndian:
+		binary.BigEndian.PutUint16(b, uint16(v))
+		return b[:2]
+	case f.bitsPerPixel == 16:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+		return b[:2]
+	case f.bigEndian:
+		binary.BigEndian.PutUint32(b, v)
+	default:
+		binary.LittleEndian.PutUint32(b, v)
+	}
+	return b
+}
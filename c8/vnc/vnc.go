@@ -0,0 +1,417 @@
+// Package vnc implements the c8 backends as an RFB server, so that any VNC
+// viewer shows the board and plays with the keyboard. The framebuffer is
+// the hires board, each of its pixels drawn as a square of scale pixels in
+// the colours of a palette, lores pixels being two hires pixels wide. Only
+// the parts of the board which changed since the last update of a viewer
+// are sent, in raw encoding, which every viewer supports. The keys are
+// those of the window:
+//
+//	1 2 3 C      1 2 3 4
+//	4 5 6 D  =>  Q W E R
+//	7 8 9 E      A S D F
+//	A 0 B F      Z X C V
+//
+// See RFC 6143 for the protocol.
+package vnc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// tileSize is the side of the squares of board pixels whose changes are
+// sent as a whole
+const tileSize = 8
+
+// keyLayout lists the characters of the hex keys, in order
+const keyLayout = "x123qweasdzc4rfv"
+
+// Message types
+const (
+	setPixelFormat           = 0
+	setEncodings             = 2
+	framebufferUpdateRequest = 3
+	keyEvent                 = 4
+	pointerEvent             = 5
+	clientCutText            = 6
+
+	framebufferUpdate = 0
+	bell              = 2
+)
+
+// Server is an RFB server showing a board
+type Server struct {
+	name    string
+	palette c8.Palette
+	scale   int
+
+	mu      sync.Mutex
+	board   [c8.MaxBoardHeight][c8.MaxBoardWidth]byte // In hires pixels
+	clients map[*client]bool
+}
+
+// NewServer generates a new Server, showing name as the title of the
+// desktop
+func NewServer(name string, palette c8.Palette, scale int) *Server {
+	if scale < 1 {
+		scale = 1
+	}
+	return &Server{name: name, palette: palette, scale: scale, clients: map[*client]bool{}}
+}
+
+// Size returns the size of the framebuffer
+func (s *Server) Size() (width, height int) {
+	return c8.MaxBoardWidth * s.scale, c8.MaxBoardHeight * s.scale
+}
+
+// Refresh keeps the board to send to the viewers
+func (s *Server) Refresh(b *c8.Board) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Lores pixels cover two hires pixels in both directions
+	zoom := c8.MaxBoardWidth / b.Width()
+	for row := 0; row < c8.MaxBoardHeight; row++ {
+		for col := 0; col < c8.MaxBoardWidth; col++ {
+			s.board[row][col] = b.Pixel(row/zoom, col/zoom)
+		}
+	}
+	for c := range s.clients {
+		c.wake()
+	}
+}
+
+// Keys returns the keys held by every viewer
+func (s *Server) Keys() uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys uint16
+	for c := range s.clients {
+		keys |= c.keys
+	}
+	return keys
+}
+
+// Beep rings the bell of the viewers when the buzzer starts
+func (s *Server) Beep(on bool) {
+	if !on {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.mu.Lock()
+		c.bell = true
+		c.mu.Unlock()
+		c.wake()
+	}
+}
+
+// Serve answers the viewers connecting to a listener until it is closed
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// client is a connected viewer
+type client struct {
+	conn    net.Conn
+	keys    uint16        // Held, guarded by the mutex of the server
+	changed chan struct{} // Something is to be sent
+
+	mu      sync.Mutex
+	format  pixelFormat
+	request bool // For an update
+	full    bool // The next update sends the whole board
+	bell    bool
+	sent    [c8.MaxBoardHeight][c8.MaxBoardWidth]byte // Board of the last update
+}
+
+func (c *client) wake() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if err := s.handshake(conn, r); err != nil {
+		return
+	}
+
+	c := &client{conn: conn, changed: make(chan struct{}, 1), format: defaultFormat, full: true}
+	s.mu.Lock()
+	s.clients[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.read(c, r)
+		// Stops the updates too
+		conn.Close()
+	}()
+	for {
+		select {
+		case <-c.changed:
+		case <-done:
+			return
+		}
+		if err := s.update(c); err != nil {
+			return
+		}
+	}
+}
+
+// handshake agrees on the version and security, none, with a viewer and
+// introduces the framebuffer
+func (s *Server) handshake(conn net.Conn, r *bufio.Reader) error {
+	if _, err := io.WriteString(conn, "RFB 003.008\n"); err != nil {
+		return err
+	}
+	version := make([]byte, 12)
+	if _, err := io.ReadFull(r, version); err != nil {
+		return err
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(string(version), "RFB %03d.%03d\n", &major, &minor); err != nil || major != 3 {
+		return fmt.Errorf("unknown version %q", version)
+	}
+
+	if minor < 7 {
+		// 3.3 has the server pick the security
+		if err := binary.Write(conn, binary.BigEndian, uint32(1)); err != nil {
+			return err
+		}
+	} else {
+		if _, err := conn.Write([]byte{1, 1}); err != nil {
+			return err
+		}
+		security, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if security != 1 {
+			return errors.New("security other than none")
+		}
+		if minor >= 8 {
+			if err := binary.Write(conn, binary.BigEndian, uint32(0)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Whether the desktop is shared does not matter, it always is
+	if _, err := r.ReadByte(); err != nil {
+		return err
+	}
+	width, height := s.Size()
+	init := make([]byte, 4)
+	binary.BigEndian.PutUint16(init, uint16(width))
+	binary.BigEndian.PutUint16(init[2:], uint16(height))
+	init = append(init, defaultFormat.marshal()...)
+	nameLength := make([]byte, 4)
+	binary.BigEndian.PutUint32(nameLength, uint32(len(s.name)))
+	init = append(init, nameLength...)
+	init = append(init, s.name...)
+	_, err := conn.Write(init)
+	return err
+}
+
+// read handles the messages of a viewer until it leaves
+func (s *Server) read(c *client, r *bufio.Reader) error {
+	for {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case setPixelFormat:
+			var msg [19]byte
+			if _, err := io.ReadFull(r, msg[:]); err != nil {
+				return err
+			}
+			format := unmarshalFormat(msg[3:])
+			if !format.trueColour || format.bitsPerPixel != 8 && format.bitsPerPixel != 16 && format.bitsPerPixel != 32 {
+				return fmt.Errorf("unsupported pixel format %+v", format)
+			}
+			c.mu.Lock()
+			c.format, c.full = format, true
+			c.mu.Unlock()
+		case setEncodings:
+			var msg struct {
+				Padding byte
+				Count   uint16
+			}
+			if err := binary.Read(r, binary.BigEndian, &msg); err != nil {
+				return err
+			}
+			// Raw is always used
+			if _, err := r.Discard(4 * int(msg.Count)); err != nil {
+				return err
+			}
+		case framebufferUpdateRequest:
+			var msg [9]byte
+			if _, err := io.ReadFull(r, msg[:]); err != nil {
+				return err
+			}
+			c.mu.Lock()
+			c.request = true
+			c.full = c.full || msg[0] == 0
+			c.mu.Unlock()
+			c.wake()
+		case keyEvent:
+			var msg struct {
+				Down    byte
+				Padding [2]byte
+				Keysym  uint32
+			}
+			if err := binary.Read(r, binary.BigEndian, &msg); err != nil {
+				return err
+			}
+			s.press(c, msg.Keysym, msg.Down != 0)
+		case pointerEvent:
+			if _, err := r.Discard(5); err != nil {
+				return err
+			}
+		case clientCutText:
+			var msg struct {
+				Padding [3]byte
+				Length  uint32
+			}
+			if err := binary.Read(r, binary.BigEndian, &msg); err != nil {
+				return err
+			}
+			if _, err := r.Discard(int(msg.Length)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown message type %d", kind)
+		}
+	}
+}
+
+// press holds or releases the hex key of a keysym, which are Latin-1 for
+// letters and digits
+func (s *Server) press(c *client, keysym uint32, down bool) {
+	if keysym >= 'A' && keysym <= 'Z' {
+		keysym += 'a' - 'A'
+	}
+	for key := range keyLayout {
+		if uint32(keyLayout[key]) != keysym {
+			continue
+		}
+		s.mu.Lock()
+		if down {
+			c.keys |= 1 << uint(key)
+		} else {
+			c.keys &^= 1 << uint(key)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// rect is a rectangle of the board, in hires pixels
+type rect struct {
+	x, y, width, height int
+}
+
+// update sends the bell and the changes of the board, if the viewer asked
+// for them
+func (s *Server) update(c *client) error {
+	s.mu.Lock()
+	board := s.board
+	s.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var msg []byte
+	if c.bell {
+		c.bell = false
+		msg = append(msg, bell)
+	}
+	if c.request {
+		rects := changedRects(&c.sent, &board, c.full)
+		if len(rects) > 0 {
+			c.request, c.full, c.sent = false, false, board
+			msg = append(msg, s.encode(rects, &board, c.format)...)
+		}
+	}
+	if len(msg) == 0 {
+		return nil
+	}
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+// changedRects returns the tiles where two boards differ, those next to
+// each other on a row of tiles being merged. All the tiles are returned
+// when full is set.
+func changedRects(old, new *[c8.MaxBoardHeight][c8.MaxBoardWidth]byte, full bool) []rect {
+	var rects []rect
+	for y := 0; y < c8.MaxBoardHeight; y += tileSize {
+		start := -1
+		for x := 0; x <= c8.MaxBoardWidth; x += tileSize {
+			changed := x < c8.MaxBoardWidth && (full || tileChanged(old, new, x, y))
+			switch {
+			case changed && start < 0:
+				start = x
+			case !changed && start >= 0:
+				rects = append(rects, rect{start, y, x - start, tileSize})
+				start = -1
+			}
+		}
+	}
+	return rects
+}
+
+func tileChanged(old, new *[c8.MaxBoardHeight][c8.MaxBoardWidth]byte, x, y int) bool {
+	for row := y; row < y+tileSize; row++ {
+		for col := x; col < x+tileSize; col++ {
+			if old[row][col] != new[row][col] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encode returns the FramebufferUpdate message of rectangles of the board
+func (s *Server) encode(rects []rect, board *[c8.MaxBoardHeight][c8.MaxBoardWidth]byte, format pixelFormat) []byte {
+	colors := make([][]byte, len(s.palette.Colors))
+	for i, clr := range s.palette.Colors {
+		colors[i] = format.pixel(clr)
+	}
+	msg := []byte{framebufferUpdate, 0, byte(len(rects) >> 8), byte(len(rects))}
+	for _, r := range rects {
+		header := []uint16{uint16(r.x * s.scale), uint16(r.y * s.scale), uint16(r.width * s.scale), uint16(r.height * s.scale)}
+		for _, v := range header {
+			msg = append(msg, byte(v>>8), byte(v))
+		}
+		msg = append(msg, 0, 0, 0, 0) // Raw encoding
+		for y := r.y * s.scale; y < (r.y+r.height)*s.scale; y++ {
+			for x := r.x * s.scale; x < (r.x+r.width)*s.scale; x++ {
+				msg = append(msg, colors[int(board[y/s.scale][x/s.scale])%len(colors)]...)
+			}
+		}
+	}
+	return msg
+}
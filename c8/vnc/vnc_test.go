@@ -0,0 +1,367 @@
+package vnc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// drawROM draws the 0 of the font at 5,3 then waits for a key, and clears
+// the board once it is pressed
+var drawROM = []byte{
+	0x60, 0x00, // V0 = 0
+	0xF0, 0x29, // I = sprite of V0
+	0x61, 0x05, // V1 = 5
+	0x62, 0x03, // V2 = 3
+	0xD1, 0x25, // Draw 5 rows at V1,V2
+	0xF3, 0x0A, // V3 = key
+	0x00, 0xE0, // Clear
+	0x12, 0x0C, // Jump to the clear
+}
+
+var testPalette = c8.Palette{Name: "test", Colors: []color.RGBA{{0x10, 0x20, 0x30, 0xFF}, {0xF0, 0xE0, 0xD0, 0xFF}}}
+
+const testScale = 2
+
+// viewer is a minimal RFB client, keeping the framebuffer in 32 bit
+// little endian pixels
+type viewer struct {
+	t      *testing.T
+	conn   net.Conn
+	r      *bufio.Reader
+	width  int
+	height int
+	name   string
+	pixels []uint32
+}
+
+// rectangle is the area of an update
+type rectangle struct {
+	X, Y, Width, Height uint16
+}
+
+func newTestServer(t *testing.T) (*Server, string) {
+	s := NewServer("DRAW", testPalette, testScale)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	return s, l.Addr().String()
+}
+
+func dial(t *testing.T, addr, version string) *viewer {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	v := &viewer{t: t, conn: conn, r: bufio.NewReader(conn)}
+	server := make([]byte, 12)
+	v.read(server)
+	if string(server) != "RFB 003.008\n" {
+		t.Fatalf("server version %q", server)
+	}
+	v.write([]byte(version))
+	if version == "RFB 003.003\n" {
+		if security := v.uint32(); security != 1 {
+			t.Fatalf("security %d, want none", security)
+		}
+	} else {
+		types := make([]byte, 2)
+		v.read(types)
+		if types[0] != 1 || types[1] != 1 {
+			t.Fatalf("security types %v, want none", types)
+		}
+		v.write([]byte{1})
+		if version == "RFB 003.008\n" {
+			if result := v.uint32(); result != 0 {
+				t.Fatalf("security result %d", result)
+			}
+		}
+	}
+
+	v.write([]byte{1}) // Shared
+	var init struct {
+		Width, Height uint16
+		Format        [16]byte
+		NameLength    uint32
+	}
+	if err := binary.Read(v.r, binary.BigEndian, &init); err != nil {
+		t.Fatal(err)
+	}
+	if format := unmarshalFormat(init.Format[:]); format != defaultFormat {
+		t.Fatalf("pixel format %+v", format)
+	}
+	name := make([]byte, init.NameLength)
+	v.read(name)
+	v.width, v.height, v.name = int(init.Width), int(init.Height), string(name)
+	v.pixels = make([]uint32, v.width*v.height)
+	return v
+}
+
+func (v *viewer) read(b []byte) {
+	v.t.Helper()
+	if _, err := io.ReadFull(v.r, b); err != nil {
+		v.t.Fatal(err)
+	}
+}
+
+func (v *viewer) write(b []byte) {
+	v.t.Helper()
+	if _, err := v.conn.Write(b); err != nil {
+		v.t.Fatal(err)
+	}
+}
+
+func (v *viewer) uint32() uint32 {
+	v.t.Helper()
+	b := make([]byte, 4)
+	v.read(b)
+	return binary.BigEndian.Uint32(b)
+}
+
+func (v *viewer) request(incremental bool) {
+	v.t.Helper()
+	msg := []byte{framebufferUpdateRequest, 0, 0, 0, 0, 0, byte(v.width >> 8), byte(v.width), byte(v.height >> 8), byte(v.height)}
+	if incremental {
+		msg[1] = 1
+	}
+	v.write(msg)
+}
+
+func (v *viewer) key(keysym uint32, down bool) {
+	v.t.Helper()
+	msg := []byte{keyEvent, 0, 0, 0, 0, 0, 0, 0}
+	if down {
+		msg[1] = 1
+	}
+	binary.BigEndian.PutUint32(msg[4:], keysym)
+	v.write(msg)
+}
+
+// message reads the type of the next message of the server
+func (v *viewer) message() byte {
+	v.t.Helper()
+	kind, err := v.r.ReadByte()
+	if err != nil {
+		v.t.Fatal(err)
+	}
+	return kind
+}
+
+// update reads a FramebufferUpdate into the framebuffer, and returns its
+// rectangles
+func (v *viewer) update() []rectangle {
+	v.t.Helper()
+	if kind := v.message(); kind != framebufferUpdate {
+		v.t.Fatalf("message type %d, want an update", kind)
+	}
+	header := make([]byte, 3)
+	v.read(header)
+	var rects []rectangle
+	for i := 0; i < int(binary.BigEndian.Uint16(header[1:])); i++ {
+		var rect struct {
+			rectangle
+			Encoding int32
+		}
+		if err := binary.Read(v.r, binary.BigEndian, &rect); err != nil {
+			v.t.Fatal(err)
+		}
+		if rect.Encoding != 0 {
+			v.t.Fatalf("encoding %d, want raw", rect.Encoding)
+		}
+		r := rect.rectangle
+		if int(r.X+r.Width) > v.width || int(r.Y+r.Height) > v.height {
+			v.t.Fatalf("rectangle %+v out of the framebuffer", r)
+		}
+		data := make([]byte, 4*int(r.Width)*int(r.Height))
+		v.read(data)
+		for y := 0; y < int(r.Height); y++ {
+			for x := 0; x < int(r.Width); x++ {
+				v.pixels[(int(r.Y)+y)*v.width+int(r.X)+x] = binary.LittleEndian.Uint32(data[4*(y*int(r.Width)+x):])
+			}
+		}
+		rects = append(rects, r)
+	}
+	return rects
+}
+
+// lit reports whether a lores pixel is in the second colour, checking that
+// all the framebuffer pixels it covers are the same
+func (v *viewer) lit(row, col int) bool {
+	v.t.Helper()
+	on, off := rgb(testPalette.Colors[1]), rgb(testPalette.Colors[0])
+	size := 2 * testScale
+	first := v.pixels[row*size*v.width+col*size]
+	for y := row * size; y < (row+1)*size; y++ {
+		for x := col * size; x < (col+1)*size; x++ {
+			if p := v.pixels[y*v.width+x]; p != first || p != on && p != off {
+				v.t.Fatalf("pixel %d,%d is %06X in lores pixel %d,%d of %06X", x, y, p, col, row, first)
+			}
+		}
+	}
+	return first == on
+}
+
+func rgb(c color.RGBA) uint32 {
+	return uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+}
+
+// zero is the 0 of the font, drawn at 5,3
+var zero = []string{
+	"XXXX",
+	"X  X",
+	"X  X",
+	"X  X",
+	"XXXX",
+}
+
+func checkZero(t *testing.T, v *viewer, shown bool) {
+	t.Helper()
+	for row := 0; row < c8.MaxBoardHeight/2; row++ {
+		for col := 0; col < c8.MaxBoardWidth/2; col++ {
+			want := shown && row >= 3 && row < 8 && col >= 5 && col < 9 && zero[row-3][col-5] == 'X'
+			if v.lit(row, col) != want {
+				t.Fatalf("lores pixel %d,%d lit is %v, want %v", col, row, !want, want)
+			}
+		}
+	}
+}
+
+// waitKeys waits until the viewers hold keys
+func waitKeys(t *testing.T, s *Server, keys uint16) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Keys() != keys {
+		if time.Now().After(deadline) {
+			t.Fatalf("keys are %04X, want %04X", s.Keys(), keys)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUpdates(t *testing.T) {
+	s, addr := newTestServer(t)
+	m := c8.NewMachine()
+	if err := m.LoadROM(bytes.NewReader(drawROM)); err != nil {
+		t.Fatal(err)
+	}
+	m.Display, m.Keypad = s, s
+
+	v := dial(t, addr, "RFB 003.008\n")
+	defer v.conn.Close()
+	if v.width != c8.MaxBoardWidth*testScale || v.height != c8.MaxBoardHeight*testScale || v.name != "DRAW" {
+		t.Fatalf("framebuffer %dx%d %q", v.width, v.height, v.name)
+	}
+
+	// The first update is the whole framebuffer
+	v.request(false)
+	area := 0
+	for _, r := range v.update() {
+		area += int(r.Width) * int(r.Height)
+	}
+	if area != v.width*v.height {
+		t.Errorf("the first update covers %d pixels, want %d", area, v.width*v.height)
+	}
+	checkZero(t, v, false)
+
+	// Then only the tiles of the 0, hires pixels 10 to 17 by 6 to 15
+	v.request(true)
+	for i := 0; i < 3; i++ {
+		if err := m.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rects := v.update()
+	tile := tileSize * testScale
+	want := []rectangle{{uint16(tile), 0, uint16(2 * tile), uint16(tile)}, {uint16(tile), uint16(tile), uint16(2 * tile), uint16(tile)}}
+	if len(rects) != len(want) || rects[0] != want[0] || rects[1] != want[1] {
+		t.Errorf("the update of the 0 is %+v, want %+v", rects, want)
+	}
+	checkZero(t, v, true)
+
+	// A held key clears the board
+	v.request(true)
+	v.key('S', true)
+	waitKeys(t, s, 1<<8)
+	for i := 0; i < 3; i++ {
+		if err := m.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v3 := m.State().V[3]; v3 != 8 {
+		t.Errorf("V3 is %d after pressing S", v3)
+	}
+	v.update()
+	checkZero(t, v, false)
+	v.key('s', false)
+}
+
+func TestVersions(t *testing.T) {
+	s, addr := newTestServer(t)
+	for _, version := range []string{"RFB 003.003\n", "RFB 003.007\n"} {
+		v := dial(t, addr, version)
+		v.request(false)
+		v.update()
+		checkZero(t, v, false)
+
+		// The keys of a viewer are released when it leaves
+		v.key('4', true)
+		waitKeys(t, s, 1<<0xC)
+		s.Beep(true)
+		if kind := v.message(); kind != bell {
+			t.Errorf("message type %d, want the bell", kind)
+		}
+		v.conn.Close()
+		waitKeys(t, s, 0)
+	}
+}
+
+func TestLongName(t *testing.T) {
+	// The name is the ROM path, which can be longer than a byte counts
+	name := strings.Repeat("games/", 50) + "PONG"
+	s := NewServer(name, testPalette, testScale)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.Serve(l)
+	v := dial(t, l.Addr().String(), "RFB 003.008\n")
+	defer v.conn.Close()
+	if v.name != name {
+		t.Errorf("desktop name %q, want %q", v.name, name)
+	}
+}
+
+func TestPixelFormats(t *testing.T) {
+	c := color.RGBA{0xFF, 0x80, 0x00, 0xFF}
+	for _, test := range []struct {
+		format pixelFormat
+		want   []byte
+	}{
+		{defaultFormat, []byte{0x00, 0x80, 0xFF, 0x00}},
+		{pixelFormat{bitsPerPixel: 32, depth: 24, bigEndian: true, trueColour: true, redMax: 255, greenMax: 255, blueMax: 255, redShift: 0, greenShift: 8, blueShift: 16}, []byte{0x00, 0x00, 0x80, 0xFF}},
+		// 5-6-5
+		{pixelFormat{bitsPerPixel: 16, depth: 16, trueColour: true, redMax: 31, greenMax: 63, blueMax: 31, redShift: 11, greenShift: 5, blueShift: 0}, []byte{0xE0, 0xFB}},
+		// 3-3-2
+		{pixelFormat{bitsPerPixel: 8, depth: 8, trueColour: true, redMax: 7, greenMax: 7, blueMax: 3, redShift: 0, greenShift: 3, blueShift: 6}, []byte{0x1F}},
+	} {
+		if got := test.format.pixel(c); string(got) != string(test.want) {
+			t.Errorf("%+v: got % X, want % X", test.format, got, test.want)
+		}
+		if got := unmarshalFormat(test.format.marshal()); got != test.format {
+			t.Errorf("%+v is %+v once marshalled", test.format, got)
+		}
+	}
+}
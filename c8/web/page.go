@@ -0,0 +1,150 @@
+package web
+
+import (
+	"io"
+	"net/http"
+)
+
+func servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, page)
+}
+
+// page shows the board and sends the keys of the left side of the keyboard
+// as the window does, or of the keypad under the board on touch screens.
+// The query of the page, with the token, is passed on to the socket.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Chip 8</title>
+<style>
+body { background: #202020; color: #E0E0E0; font-family: sans-serif; text-align: center; }
+canvas { width: 100%; max-width: 960px; image-rendering: pixelated; border: 1px solid #555; }
+#keypad { display: none; grid-template-columns: repeat(4, 4em); gap: 0.5em; justify-content: center; margin: 1em; }
+#keypad button { height: 3em; font-size: 1.2em; }
+#viewers button { margin-left: 0.5em; }
+</style>
+</head>
+<body>
+<canvas id="board" width="64" height="32"></canvas>
+<p id="status">Connecting</p>
+<div id="keypad"></div>
+<ul id="viewers"></ul>
+<script>
+"use strict";
+var canvas = document.getElementById("board");
+var ctx = canvas.getContext("2d");
+var statusLine = document.getElementById("status");
+var keypad = document.getElementById("keypad");
+var viewers = document.getElementById("viewers");
+
+// Same layout as the window: 1234, QWER, ASDF and ZXCV
+var codes = ["KeyX", "Digit1", "Digit2", "Digit3", "KeyQ", "KeyW", "KeyE", "KeyA",
+	"KeyS", "KeyD", "KeyZ", "KeyC", "Digit4", "KeyR", "KeyF", "KeyV"];
+var layout = [1, 2, 3, 12, 4, 5, 6, 13, 7, 8, 9, 14, 10, 0, 11, 15];
+
+var id = 0, control = false, palette = ["#000000", "#FFFFFF"];
+var width = 64, height = 32, pixels = new Uint8Array(64 * 32);
+
+var proto = location.protocol === "https:" ? "wss://" : "ws://";
+var ws = new WebSocket(proto + location.host + "/ws" + location.search);
+
+function send(ev) {
+	if (control && ws.readyState === WebSocket.OPEN) {
+		ws.send(JSON.stringify(ev));
+	}
+}
+
+function draw() {
+	var img = ctx.createImageData(width, height);
+	for (var i = 0; i < pixels.length; i++) {
+		var c = palette[pixels[i] % palette.length];
+		img.data[i * 4] = parseInt(c.substr(1, 2), 16);
+		img.data[i * 4 + 1] = parseInt(c.substr(3, 2), 16);
+		img.data[i * 4 + 2] = parseInt(c.substr(5, 2), 16);
+		img.data[i * 4 + 3] = 255;
+	}
+	ctx.putImageData(img, 0, 0);
+}
+
+function showViewers(list) {
+	viewers.innerHTML = "";
+	list.forEach(function(v) {
+		if (v.id === id) {
+			control = !!v.control;
+		}
+		var li = document.createElement("li");
+		li.textContent = "Viewer " + v.id + (v.id === id ? " (you)" : "") + (v.control ? ", playing" : ", spectating");
+		viewers.appendChild(li);
+	});
+	// Only those in control see the buttons granting it
+	list.forEach(function(v, i) {
+		if (!control || v.id === id) {
+			return;
+		}
+		var b = document.createElement("button");
+		b.textContent = v.control ? "Revoke control" : "Grant control";
+		b.onclick = function() { send({type: v.control ? "revoke" : "grant", id: v.id}); };
+		viewers.children[i].appendChild(b);
+	});
+	statusLine.textContent = control ? "Playing" : "Spectating";
+	keypad.style.display = control && "ontouchstart" in window ? "grid" : "none";
+}
+
+ws.onmessage = function(e) {
+	var msg = JSON.parse(e.data);
+	switch (msg.type) {
+	case "hello":
+		id = msg.id;
+		palette = msg.palette;
+		break;
+	case "frame":
+		if (msg.full || msg.width !== width || msg.height !== height) {
+			width = canvas.width = msg.width;
+			height = canvas.height = msg.height;
+			pixels = new Uint8Array(width * height);
+		}
+		for (var i = 0; i < msg.diff.length; i += 2) {
+			pixels[msg.diff[i]] = msg.diff[i + 1];
+		}
+		draw();
+		break;
+	case "viewers":
+		showViewers(msg.viewers);
+		break;
+	case "error":
+		statusLine.textContent = msg.error;
+		break;
+	}
+};
+ws.onclose = function() { statusLine.textContent = "Disconnected"; };
+
+function onKey(down) {
+	return function(e) {
+		var key = codes.indexOf(e.code);
+		if (key >= 0 && !e.repeat) {
+			send({type: "key", key: key, down: down});
+			e.preventDefault();
+		}
+	};
+}
+document.addEventListener("keydown", onKey(true));
+document.addEventListener("keyup", onKey(false));
+
+layout.forEach(function(key) {
+	var b = document.createElement("button");
+	b.textContent = key.toString(16).toUpperCase();
+	b.ontouchstart = function(e) { send({type: "key", key: key, down: true}); e.preventDefault(); };
+	b.ontouchend = function(e) { send({type: "key", key: key, down: false}); e.preventDefault(); };
+	keypad.appendChild(b);
+});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,334 @@
+// Package web serves a page from which browsers on the LAN watch or play
+// the running machine. The page talks to the server over a WebSocket at
+// /ws, with one JSON message per frame of the socket.
+//
+// The server first sends {"type": "hello", "id": 3, "palette": [...]}
+// then, up to 60 times a second, the pixels changed since the previous
+// frame message as pairs of index and value, the index being row*width+col:
+//
+//	{"type": "frame", "frame": 120, "width": 64, "height": 32, "diff": [70, 1, 71, 0]}
+//
+// A frame with "full": true lists every lit pixel of a cleared board
+// instead. The viewers are sent whenever they change:
+//
+//	{"type": "viewers", "viewers": [{"id": 1, "control": true}, {"id": 3}]}
+//
+// Viewers spectate, except those which gave the token of the server in
+// the query of the socket, such as /ws?token=abc, and those granted
+// control by another viewer in control. These send keypad events and
+// grant or revoke control:
+//
+//	{"type": "key", "key": 5, "down": true}
+//	{"type": "grant", "id": 3}
+//	{"type": "revoke", "id": 3}
+//
+// Events which cannot be done are answered with {"type": "error", "error": "..."}.
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"golang.org/x/net/websocket"
+)
+
+// queueLength is the number of messages kept for a slow viewer, past which
+// it misses frames and gets a full one when it catches up
+const queueLength = 16
+
+// Server streams the machines given to Attach, the last one being shown
+type Server struct {
+	palette  c8.Palette
+	token    string
+	interval time.Duration // Between frame messages
+	mux      *http.ServeMux
+
+	mu      sync.Mutex
+	m       *c8.Machine
+	clients map[int]*client
+	nextID  int
+	sent    time.Time
+	frame   uint64
+	width   int
+	height  int
+	board   []byte // As of the last frame message, nil before it
+}
+
+// client is a connected viewer
+type client struct {
+	id      int
+	control bool
+	keys    uint16 // Held by the viewer
+	out     chan *message
+	full    bool // Missed a frame message
+}
+
+// message is sent by the server
+type message struct {
+	Type    string   `json:"type"`
+	ID      int      `json:"id,omitempty"`
+	Palette []string `json:"palette,omitempty"`
+	Frame   uint64   `json:"frame,omitempty"`
+	Width   int      `json:"width,omitempty"`
+	Height  int      `json:"height,omitempty"`
+	Full    bool     `json:"full,omitempty"`
+	Diff    []int    `json:"diff,omitempty"`
+	Viewers []viewer `json:"viewers,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+type viewer struct {
+	ID      int  `json:"id"`
+	Control bool `json:"control,omitempty"`
+}
+
+// event is sent by a viewer
+type event struct {
+	Type string `json:"type"`
+	Key  int    `json:"key"`
+	Down bool   `json:"down"`
+	ID   int    `json:"id"`
+}
+
+// NewServer generates a new Server drawing with palette. Viewers giving
+// token control the machine; nobody does when it is empty.
+func NewServer(palette c8.Palette, token string) *Server {
+	s := &Server{
+		palette:  palette,
+		token:    token,
+		interval: time.Second / 60,
+		mux:      http.NewServeMux(),
+		clients:  map[int]*client{},
+	}
+	s.mux.HandleFunc("/", servePage)
+	s.mux.Handle("/ws", websocket.Handler(s.serveSocket))
+	return s
+}
+
+// ServeHTTP serves the page and the WebSocket
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Attach shows a machine which has just read its ROM to the viewers. It
+// must be called before the machine runs.
+func (s *Server) Attach(m *c8.Machine) {
+	next := m.Input
+	m.Input = func(frame uint64, keys uint16) uint16 {
+		if next != nil {
+			keys = next(frame, keys)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.m == m {
+			for _, c := range s.clients {
+				keys |= c.keys
+			}
+		}
+		return keys
+	}
+	m.AddFrameHook(func() error {
+		s.update(m)
+		return nil
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m, s.board = m, nil
+}
+
+// update sends the pixels changed by the last frames of m
+func (s *Server) update(m *c8.Machine) {
+	s.mu.Lock()
+	skip := s.m != m || len(s.clients) == 0 || time.Since(s.sent) < s.interval
+	s.mu.Unlock()
+	if skip {
+		return
+	}
+	// Taken unlocked, as the machine locks itself then s.mu for the keys
+	snapshot := m.Snapshot()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m != m {
+		return
+	}
+	width, height := c8.MaxBoardWidth/2, c8.MaxBoardHeight/2
+	if snapshot.Hires {
+		width, height = c8.MaxBoardWidth, c8.MaxBoardHeight
+	}
+	board := make([]byte, 0, width*height)
+	for row := 0; row < height; row++ {
+		board = append(board, snapshot.Board[row*c8.MaxBoardWidth:row*c8.MaxBoardWidth+width]...)
+	}
+	resized := width != s.width || height != s.height
+	old := s.board
+	s.sent, s.frame, s.width, s.height, s.board = time.Now(), snapshot.Frames, width, height, board
+	if resized || old == nil {
+		for _, c := range s.clients {
+			c.full = true
+		}
+	}
+
+	diff := &message{Type: "frame", Frame: s.frame, Width: width, Height: height, Diff: []int{}}
+	if !resized && old != nil {
+		for i, pixel := range board {
+			if pixel != old[i] {
+				diff.Diff = append(diff.Diff, i, int(pixel))
+			}
+		}
+	}
+	var full *message
+	for _, c := range s.clients {
+		msg := diff
+		if c.full {
+			if full == nil {
+				full = s.fullFrame()
+			}
+			msg = full
+		} else if len(diff.Diff) == 0 {
+			continue
+		}
+		c.send(msg)
+	}
+}
+
+// fullFrame returns the message of the last frame on a cleared board.
+// s.mu must be held.
+func (s *Server) fullFrame() *message {
+	msg := &message{Type: "frame", Frame: s.frame, Width: s.width, Height: s.height, Full: true, Diff: []int{}}
+	for i, pixel := range s.board {
+		if pixel != 0 {
+			msg.Diff = append(msg.Diff, i, int(pixel))
+		}
+	}
+	return msg
+}
+
+// send queues a message for the viewer, unless it is too far behind.
+// s.mu must be held.
+func (c *client) send(msg *message) {
+	select {
+	case c.out <- msg:
+		if msg.Type == "frame" {
+			c.full = false
+		}
+	default:
+		c.full = true
+	}
+}
+
+func (s *Server) serveSocket(ws *websocket.Conn) {
+	defer ws.Close()
+	token := ws.Request().URL.Query().Get("token")
+	c := s.join(s.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range c.out {
+			if err := websocket.JSON.Send(ws, msg); err != nil {
+				// Closing the socket ends the receiving loop, which closes c.out
+				ws.Close()
+				for range c.out {
+				}
+			}
+		}
+	}()
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			break
+		}
+		var ev event
+		if err := json.Unmarshal(data, &ev); err != nil {
+			s.mu.Lock()
+			c.send(&message{Type: "error", Error: fmt.Sprintf("invalid event: %v", err)})
+			s.mu.Unlock()
+			continue
+		}
+		s.handle(c, ev)
+	}
+	s.leave(c)
+	<-done
+}
+
+// join adds a viewer, which receives the last frame sent
+func (s *Server) join(control bool) *client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	c := &client{id: s.nextID, control: control, out: make(chan *message, queueLength), full: true}
+	palette := make([]string, len(s.palette.Colors))
+	for i, clr := range s.palette.Colors {
+		palette[i] = fmt.Sprintf("#%02X%02X%02X", clr.R, clr.G, clr.B)
+	}
+	c.send(&message{Type: "hello", ID: c.id, Palette: palette})
+	if s.board != nil {
+		c.send(s.fullFrame())
+	}
+	s.clients[c.id] = c
+	s.sendViewers()
+	return c
+}
+
+// leave removes a viewer, releasing its keys
+func (s *Server) leave(c *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, c.id)
+	close(c.out)
+	s.sendViewers()
+}
+
+func (s *Server) handle(c *client, ev event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !c.control {
+		c.send(&message{Type: "error", Error: "you are spectating"})
+		return
+	}
+	switch ev.Type {
+	case "key":
+		if ev.Key < 0 || ev.Key > 0xF {
+			c.send(&message{Type: "error", Error: fmt.Sprintf("there is no key %d", ev.Key)})
+			return
+		}
+		if ev.Down {
+			c.keys |= 1 << uint(ev.Key)
+		} else {
+			c.keys &^= 1 << uint(ev.Key)
+		}
+	case "grant", "revoke":
+		other, ok := s.clients[ev.ID]
+		if !ok {
+			c.send(&message{Type: "error", Error: fmt.Sprintf("there is no viewer %d", ev.ID)})
+			return
+		}
+		other.control = ev.Type == "grant"
+		if !other.control {
+			other.keys = 0
+		}
+		s.sendViewers()
+	default:
+		c.send(&message{Type: "error", Error: fmt.Sprintf("unknown event %q, want key, grant or revoke", ev.Type)})
+	}
+}
+
+// sendViewers tells every viewer who is watching. s.mu must be held.
+func (s *Server) sendViewers() {
+	msg := &message{Type: "viewers"}
+	for _, c := range s.clients {
+		msg.Viewers = append(msg.Viewers, viewer{c.id, c.control})
+	}
+	sort.Slice(msg.Viewers, func(i, j int) bool { return msg.Viewers[i].ID < msg.Viewers[j].ID })
+	for _, c := range s.clients {
+		c.send(msg)
+	}
+}
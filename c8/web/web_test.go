@@ -0,0 +1,245 @@
+package web
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"golang.org/x/net/websocket"
+)
+
+// testROM draws the 0 of the font at 5,3 then waits for a key, and clears
+// the board once it is pressed
+var testROM = []byte{
+	0x60, 0x00, // V0 = 0
+	0xF0, 0x29, // I = sprite of V0
+	0x61, 0x05, // V1 = 5
+	0x62, 0x03, // V2 = 3
+	0xD1, 0x25, // Draw 5 rows at V1,V2
+	0xF3, 0x0A, // V3 = key
+	0x00, 0xE0, // Clear
+	0x12, 0x0C, // Jump to the clear
+}
+
+func newTestServer(t *testing.T) (*c8.Machine, *httptest.Server) {
+	m := c8.NewMachine()
+	if err := m.LoadROM(bytes.NewReader(testROM)); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(c8.Palettes[0], "secret")
+	s.interval = 0
+	s.Attach(m)
+	return m, httptest.NewServer(s)
+}
+
+func dial(t *testing.T, ts *httptest.Server, query string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws" + query
+	ws, err := websocket.Dial(url, "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+// receive returns the next message of a type, skipping the others
+func receive(t *testing.T, ws *websocket.Conn, typ string) *message {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg message
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("waiting for %s: %v", typ, err)
+		}
+		if msg.Type == typ {
+			return &msg
+		}
+	}
+}
+
+// viewers receives viewer lists until one has n viewers
+func viewers(t *testing.T, ws *websocket.Conn, n int) []viewer {
+	t.Helper()
+	for {
+		if msg := receive(t, ws, "viewers"); len(msg.Viewers) == n {
+			return msg.Viewers
+		}
+	}
+}
+
+// sendEvent sends an event and waits until the server has handled it, by
+// sending a bad one after it and waiting for its error
+func sendEvent(t *testing.T, ws *websocket.Conn, ev event) {
+	t.Helper()
+	if err := websocket.JSON.Send(ws, ev); err != nil {
+		t.Fatal(err)
+	}
+	websocket.JSON.Send(ws, event{Type: "sync"})
+	for {
+		if msg := receive(t, ws, "error"); strings.Contains(msg.Error, "sync") {
+			return
+		}
+	}
+}
+
+// screen is a board put together from frame messages
+type screen struct {
+	width  int
+	pixels []byte
+}
+
+func (sc *screen) apply(msg *message) {
+	if msg.Full || msg.Width*msg.Height != len(sc.pixels) {
+		sc.width, sc.pixels = msg.Width, make([]byte, msg.Width*msg.Height)
+	}
+	for i := 0; i < len(msg.Diff); i += 2 {
+		sc.pixels[msg.Diff[i]] = byte(msg.Diff[i+1])
+	}
+}
+
+func (sc *screen) row(row, col, n int) string {
+	var s strings.Builder
+	for _, pixel := range sc.pixels[row*sc.width+col : row*sc.width+col+n] {
+		if pixel != 0 {
+			s.WriteByte('#')
+		} else {
+			s.WriteByte('.')
+		}
+	}
+	return s.String()
+}
+
+func TestPage(t *testing.T) {
+	_, ts := newTestServer(t)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "new WebSocket(") {
+		t.Errorf("GET / answered %d with %.40q...", resp.StatusCode, body)
+	}
+}
+
+func TestPlayAndSpectate(t *testing.T) {
+	m, ts := newTestServer(t)
+	defer ts.Close()
+
+	player := dial(t, ts, "?token=secret")
+	defer player.Close()
+	hello := receive(t, player, "hello")
+	if hello.ID != 1 || len(hello.Palette) != len(c8.Palettes[0].Colors) || hello.Palette[1] != "#FFFFFF" {
+		t.Errorf("hello is %+v", hello)
+	}
+	spectator := dial(t, ts, "?token=wrong")
+	defer spectator.Close()
+	want := []viewer{{1, true}, {2, false}}
+	for _, ws := range []*websocket.Conn{player, spectator} {
+		if got := viewers(t, ws, 2); got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("viewers are %v, want %v", got, want)
+		}
+	}
+
+	// Both see the 0 drawn by the first frame
+	m.RunFrame()
+	var screens [2]screen
+	for i, ws := range []*websocket.Conn{player, spectator} {
+		msg := receive(t, ws, "frame")
+		if !msg.Full || msg.Width != 64 || msg.Height != 32 {
+			t.Errorf("first frame is %+v, want a full 64x32 one", msg)
+		}
+		screens[i].apply(msg)
+		if got := screens[i].row(3, 4, 6); got != ".####." {
+			t.Errorf("row 3 is %q", got)
+		}
+		if got := screens[i].row(4, 4, 6); got != ".#..#." {
+			t.Errorf("row 4 is %q", got)
+		}
+	}
+
+	// The spectator cannot press keys
+	websocket.JSON.Send(spectator, event{Type: "key", Key: 5, Down: true})
+	if msg := receive(t, spectator, "error"); msg.Error != "you are spectating" {
+		t.Errorf("spectator pressing a key got %q", msg.Error)
+	}
+	m.RunFrame()
+	if m.State().V[3] != 0 {
+		t.Fatalf("key of the spectator reached the machine")
+	}
+
+	// The player can, which clears the board in a diff
+	sendEvent(t, player, event{Type: "key", Key: 7, Down: true})
+	m.RunFrame()
+	if v3 := m.State().V[3]; v3 != 7 {
+		t.Errorf("V3 is %d after pressing 7, want 7", v3)
+	}
+	for i, ws := range []*websocket.Conn{player, spectator} {
+		msg := receive(t, ws, "frame")
+		if msg.Full || len(msg.Diff) != 2*14 {
+			t.Errorf("frame after the clear is %+v, want a diff of the 14 pixels of the 0", msg)
+		}
+		screens[i].apply(msg)
+		if got := screens[i].row(3, 4, 6); got != "......" {
+			t.Errorf("row 3 is %q after the clear", got)
+		}
+	}
+	sendEvent(t, player, event{Type: "key", Key: 7, Down: false})
+
+	// Control is granted then revoked by the player
+	sendEvent(t, player, event{Type: "grant", ID: 2})
+	if got := viewers(t, spectator, 2); !got[1].Control {
+		t.Errorf("viewers are %v after the grant", got)
+	}
+	sendEvent(t, spectator, event{Type: "key", Key: 0xA, Down: true})
+	sendEvent(t, player, event{Type: "revoke", ID: 2})
+	if got := viewers(t, spectator, 2); got[1].Control {
+		t.Errorf("viewers are %v after the revoke", got)
+	}
+	websocket.JSON.Send(spectator, event{Type: "key", Key: 0xB, Down: true})
+	if msg := receive(t, spectator, "error"); msg.Error != "you are spectating" {
+		t.Errorf("spectator pressing a key after the revoke got %q", msg.Error)
+	}
+
+	// The player leaving is seen by the spectator
+	player.Close()
+	if got := viewers(t, spectator, 1); got[0].ID != 2 {
+		t.Errorf("viewers are %v after the player left", got)
+	}
+}
+
+func TestLateViewer(t *testing.T) {
+	m, ts := newTestServer(t)
+	defer ts.Close()
+	first := dial(t, ts, "")
+	defer first.Close()
+	receive(t, first, "hello")
+	m.RunFrame()
+	receive(t, first, "frame")
+
+	// A viewer joining between frames gets the last one in full
+	late := dial(t, ts, "")
+	defer late.Close()
+	msg := receive(t, late, "frame")
+	var sc screen
+	sc.apply(msg)
+	if !msg.Full || sc.row(3, 5, 4) != "####" {
+		t.Errorf("late viewer got %+v", msg)
+	}
+	viewers(t, late, 2)
+
+	// Bad events are answered without closing the socket
+	late.Write([]byte("{"))
+	if msg := receive(t, late, "error"); !strings.HasPrefix(msg.Error, "invalid event") {
+		t.Errorf("bad event got %q", msg.Error)
+	}
+	websocket.JSON.Send(late, event{Type: "key"})
+	if msg := receive(t, late, "error"); msg.Error != "you are spectating" {
+		t.Errorf("key after the bad event got %q", msg.Error)
+	}
+}
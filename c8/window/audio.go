@@ -0,0 +1,64 @@
+package window
+
+import (
+	"github.com/hajimehoshi/ebiten/audio"
+)
+
+const (
+	sampleRate    = 44100
+	toneFrequency = 440
+	toneVolume    = 0x1000
+)
+
+// squareWave is an endless 16 bit stereo square wave
+type squareWave struct {
+	pos int64
+}
+
+func (s *squareWave) Read(buf []byte) (int, error) {
+	n := len(buf) / 4 * 4
+	period := int64(sampleRate / toneFrequency)
+	for i := 0; i < n; i += 4 {
+		sample := int16(toneVolume)
+		if s.pos%period >= period/2 {
+			sample = -toneVolume
+		}
+		buf[i] = byte(sample)
+		buf[i+1] = byte(sample >> 8)
+		buf[i+2] = byte(sample)
+		buf[i+3] = byte(sample >> 8)
+		s.pos++
+	}
+	return n, nil
+}
+
+func (s *squareWave) Close() error {
+	return nil
+}
+
+// Audio plays the buzzer as a square wave
+type Audio struct {
+	player *audio.Player
+}
+
+// NewAudio generates a new Audio
+func NewAudio() (*Audio, error) {
+	context, err := audio.NewContext(sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	player, err := audio.NewPlayer(context, &squareWave{})
+	if err != nil {
+		return nil, err
+	}
+	return &Audio{player: player}, nil
+}
+
+// Beep starts or pauses the tone
+func (a *Audio) Beep(on bool) {
+	if on {
+		a.player.Play()
+	} else {
+		a.player.Pause()
+	}
+}
@@ -0,0 +1,194 @@
+package window
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+)
+
+const (
+	cheatHelp = "new, eq N, changed, unchanged, inc, dec, freeze ADDR [N] [NAME], unfreeze ADDR, save"
+
+	// Told for a machine without cheats, see Prog.Attach
+	noCheats = "no cheats while recording, replaying or playing over the network"
+)
+
+// cheatPanel searches memory and freezes bytes through typed commands. The
+// keypad does not see the keys while it is shown.
+type cheatPanel struct {
+	show    bool
+	dir     string // Where cheats are saved, by ROM hash
+	search  *c8.Search
+	command string
+	message string
+}
+
+// CheatFile returns the file the cheats of a ROM are saved in
+func CheatFile(dir, romHash string) string {
+	return filepath.Join(dir, romHash+".txt")
+}
+
+// SetCheatDir sets the directory the cheat panel saves cheats into
+func (p *Prog) SetCheatDir(dir string) {
+	p.cheats.dir = dir
+}
+
+// update edits and runs the command line. It must be called from the
+// ebiten update loop.
+func (c *cheatPanel) update(m *c8.Machine) {
+	for _, char := range ebiten.InputChars() {
+		c.command += string(char)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(c.command) > 0 {
+		c.command = c.command[:len(c.command)-1]
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		c.message = c.run(m, strings.Fields(c.command))
+		c.command = ""
+	}
+}
+
+// run executes a command and returns what to tell the user
+func (c *cheatPanel) run(m *c8.Machine, args []string) string {
+	if len(args) == 0 {
+		return cheatHelp
+	}
+	comparisons := map[string]c8.Comparison{
+		"eq":        c8.Equal,
+		"changed":   c8.Changed,
+		"unchanged": c8.Unchanged,
+		"inc":       c8.Increased,
+		"dec":       c8.Decreased,
+	}
+
+	if m.Cheats == nil && (args[0] == "freeze" || args[0] == "unfreeze" || args[0] == "save") {
+		return noCheats
+	}
+
+	switch cmd := args[0]; cmd {
+	case "new":
+		c.search = c8.NewSearch(m)
+		return fmt.Sprintf("%d candidates", len(c.search.Candidates()))
+	case "eq", "changed", "unchanged", "inc", "dec":
+		if c.search == nil {
+			c.search = c8.NewSearch(m)
+		}
+		var value uint64
+		if cmd == "eq" {
+			if len(args) != 2 {
+				return "eq wants a value"
+			}
+			var err error
+			if value, err = strconv.ParseUint(args[1], 0, 8); err != nil {
+				return fmt.Sprintf("invalid value %q", args[1])
+			}
+		}
+		c.search.Filter(m, comparisons[cmd], byte(value))
+		return fmt.Sprintf("%d candidates", len(c.search.Candidates()))
+	case "freeze":
+		if len(args) < 2 {
+			return "freeze wants an address"
+		}
+		addr, err := strconv.ParseUint(args[1], 16, 12)
+		if err != nil {
+			return fmt.Sprintf("invalid address %q", args[1])
+		}
+		cheat := c8.Cheat{Addr: uint16(addr), Value: m.Peek(uint16(addr), 1)[0]}
+		if len(args) > 2 {
+			value, err := strconv.ParseUint(args[2], 0, 8)
+			if err != nil {
+				return fmt.Sprintf("invalid value %q", args[2])
+			}
+			cheat.Value = byte(value)
+			cheat.Name = strings.Join(args[3:], " ")
+		}
+		m.Cheats.Freeze(cheat)
+		return fmt.Sprintf("%03X frozen at %d", cheat.Addr, cheat.Value)
+	case "unfreeze":
+		if len(args) != 2 {
+			return "unfreeze wants an address"
+		}
+		addr, err := strconv.ParseUint(args[1], 16, 12)
+		if err != nil {
+			return fmt.Sprintf("invalid address %q", args[1])
+		}
+		m.Cheats.Unfreeze(uint16(addr))
+		return fmt.Sprintf("%03X unfrozen", addr)
+	case "save":
+		if err := c.save(m); err != nil {
+			return err.Error()
+		}
+		return "saved to " + CheatFile(c.dir, m.ROMHash())
+	}
+	return cheatHelp
+}
+
+func (c *cheatPanel) save(m *c8.Machine) error {
+	if c.dir == "" {
+		return fmt.Errorf("no cheat directory")
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(CheatFile(c.dir, m.ROMHash()))
+	if err != nil {
+		return err
+	}
+	title := m.ROMHash()
+	if info := m.Info(); info != nil {
+		title = info.Title
+	}
+	if err := m.Cheats.Write(file, title); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// draw shows the candidates of the search, the frozen bytes and the
+// command line over the whole screen
+func (c *cheatPanel) draw(screen *ebiten.Image, m *c8.Machine) {
+	screenWidth, screenHeight := screen.Size()
+	drawRect(screen, 0, 0, float64(screenWidth), float64(screenHeight), hudBackground, 1)
+	rows := screenHeight/lineHeight - 4
+
+	var left strings.Builder
+	if c.search == nil {
+		left.WriteString("No search, type new\n")
+	} else {
+		candidates := c.search.Candidates()
+		fmt.Fprintf(&left, "%d candidates\n", len(candidates))
+		var values []byte
+		if len(candidates) <= rows {
+			values = m.Peek(0, 0x1000)
+		}
+		for _, addr := range candidates {
+			if values == nil {
+				break
+			}
+			fmt.Fprintf(&left, "%03X %3d was %3d\n", addr, values[addr], c.search.Previous(addr))
+		}
+	}
+
+	var right strings.Builder
+	right.WriteString("Frozen\n")
+	if m.Cheats == nil {
+		right.WriteString(noCheats + "\n")
+	} else {
+		for _, cheat := range m.Cheats.List() {
+			fmt.Fprintf(&right, "%03X %3d %s\n", cheat.Addr, cheat.Value, cheat.Name)
+		}
+	}
+
+	ebitenutil.DebugPrintAt(screen, left.String(), hudMargin, hudMargin)
+	ebitenutil.DebugPrintAt(screen, right.String(), hudMargin+hudColumn, hudMargin)
+	ebitenutil.DebugPrintAt(screen, c.message, hudMargin, screenHeight-2*lineHeight-hudMargin)
+	ebitenutil.DebugPrintAt(screen, "> "+c.command+"_", hudMargin, screenHeight-lineHeight-hudMargin)
+}
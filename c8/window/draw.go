@@ -0,0 +1,338 @@
+// Package window implements the c8 backends on an ebiten window
+package window
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"sync"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+)
+
+// Scaling step when resizing the window with the hotkeys
+const scaleStep = 1
+
+var letterboxColor = color.Black
+
+// aPixel is a white pixel, scaled and coloured to draw everything else
+var aPixel *ebiten.Image
+
+// frame is the window copy of the board
+type frame struct {
+	width, height int
+	pixels        [c8.MaxBoardHeight][c8.MaxBoardWidth]byte
+	sprite        c8.Sprite
+}
+
+// Prog represent a program state
+type Prog struct {
+	mu     sync.Mutex
+	frame  frame
+	toasts []toast
+	shapes []c8.Shape // Of the overlay
+
+	palettes    []c8.Palette
+	romPalettes []c8.Palette // Before palettes, the colours the ROM database gives the game
+	palette     int
+	phosphor    phosphor
+	grid        Grid
+	showGrid    bool
+	hud         hud
+	memView     memView
+	cheats      cheatPanel
+
+	machine      *c8.Machine
+	screenHeight int  // As of the last Draw
+	paused       bool // The clock only ticks when advancing a frame
+
+	// The launcher is shown while no machine runs
+	launcher *Launcher
+	load     LoadFunc
+
+	calls chan func() // Run by the next Update, from other goroutines
+
+	windowScale  float64
+	integerScale bool
+
+	keypad *Keypad
+	clock  *Clock
+}
+
+// NewProg generates a new Prog object drawing with the first of the given
+// palettes. The palette hotkey cycles through the others.
+func NewProg(palettes []c8.Palette) (*Prog, error) {
+	p := &Prog{
+		frame:        frame{width: pixelsHorizontally, height: pixelsVertically},
+		palettes:     palettes,
+		grid:         Grid{Spacing: defaultGridSpacing, Color: color.RGBA{0xFF, 0x00, 0x00, 0xBB}},
+		windowScale:  10,
+		integerScale: true,
+		memView:      newMemView(),
+		keypad:       &Keypad{},
+		clock:        newClock(),
+		calls:        make(chan func(), 1),
+	}
+
+	var err error
+	aPixel, err = ebiten.NewImage(1, 1, ebiten.FilterDefault)
+	if err != nil {
+		return nil, err
+	}
+	aPixel.Fill(color.White)
+	return p, nil
+}
+
+// SetPhosphor selects the persistence filter. decay is the fraction of its
+// intensity a pixel loses every frame after it is turned off.
+func (p *Prog) SetPhosphor(mode PhosphorMode, decay float64) {
+	p.phosphor = phosphor{mode: mode, decay: decay}
+}
+
+// SetScaling sets the initial window scale, as given to WindowSize, and
+// whether the board is only scaled by whole numbers
+func (p *Prog) SetScaling(scale float64, integer bool) {
+	p.windowScale = scale
+	p.integerScale = integer
+}
+
+// Attach makes the window the display, keypad and clock of the machine,
+// and the machine the one shown by the debug panels. The keys and colours
+// the ROM database gives the game are used. A machine without cheats,
+// such as one recording a movie, keeps none.
+func (p *Prog) Attach(m *c8.Machine) {
+	m.Display = p
+	m.Keypad = p.keypad
+	m.Clock = p.clock
+	p.machine = m
+
+	p.romPalettes = nil
+	p.keypad.bind(nil)
+	if info := m.Info(); info != nil {
+		p.keypad.bind(info.Keys)
+		if palette, err := c8.NewPalette(info.Title, info.Colors...); err == nil {
+			p.romPalettes = []c8.Palette{palette}
+			p.palette = 0
+		}
+	}
+	p.palette %= len(p.allPalettes())
+}
+
+func (p *Prog) allPalettes() []c8.Palette {
+	return append(append([]c8.Palette(nil), p.romPalettes...), p.palettes...)
+}
+
+// SetLauncher makes the window show the launcher while no game runs, and
+// the launcher hotkey stop the game and go back to it. load prepares the
+// machine of the picked ROM.
+func (p *Prog) SetLauncher(l *Launcher, load LoadFunc) {
+	p.launcher = l
+	p.load = load
+}
+
+// Launch loads a ROM with the function given to SetLauncher and starts it
+func (p *Prog) Launch(filename string) error {
+	m, err := p.load(filename)
+	if err != nil {
+		return err
+	}
+	p.Start(m, filename)
+	return nil
+}
+
+// LoadROM stops the running game, if any, and starts a ROM like Launch.
+// It can be called from any goroutine, and returns once the next Update
+// did it.
+func (p *Prog) LoadROM(filename string) error {
+	done := make(chan error, 1)
+	p.calls <- func() {
+		if p.load == nil {
+			done <- fmt.Errorf("the window cannot load ROMs without a launcher")
+			return
+		}
+		if p.machine != nil {
+			p.stopGame()
+		}
+		done <- p.Launch(filename)
+	}
+	return <-done
+}
+
+// Start attaches the machine of a ROM and runs it in its own goroutine,
+// logging the error it stops with if any
+func (p *Prog) Start(m *c8.Machine, romName string) {
+	p.mu.Lock()
+	p.frame = frame{width: pixelsHorizontally, height: pixelsVertically}
+	p.mu.Unlock()
+	p.Attach(m)
+	go func() {
+		if err := m.Run(); err != nil {
+			log.Printf("%s: %v", romName, err)
+		}
+	}()
+	ebiten.SetWindowTitle("Chip 8 - " + romName)
+}
+
+// stopGame stops the running machine and goes back to the launcher
+func (p *Prog) stopGame() {
+	p.machine.Stop()
+	p.machine.Audio.Beep(false)
+	p.clock.stop()
+	p.clock = newClock()
+	p.machine = nil
+	p.paused = false
+	p.memView.show, p.memView.selected = false, -1
+	p.cheats.show, p.cheats.search = false, nil
+	ebiten.SetWindowTitle("Chip 8")
+}
+
+// Refresh copies the board to be drawn on the next frame
+func (p *Prog) Refresh(b *c8.Board) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.frame.width, p.frame.height = b.Width(), b.Height()
+	p.frame.sprite = b.LastSprite()
+	for row := 0; row < b.Height(); row++ {
+		for col := 0; col < b.Width(); col++ {
+			p.frame.pixels[row][col] = b.Pixel(row, col)
+		}
+	}
+}
+
+// Update is to update screen
+func (p *Prog) Update() error {
+	for pending := true; pending; {
+		select {
+		case call := <-p.calls:
+			call()
+		default:
+			pending = false
+		}
+	}
+
+	// The cheat panel takes every key but its own while typing commands
+	if p.cheats.show && p.machine != nil {
+		if inpututil.IsKeyJustPressed(cheatKey) {
+			p.cheats.show = false
+		} else {
+			p.cheats.update(p.machine)
+		}
+		if !p.paused {
+			p.tick()
+		}
+		return nil
+	}
+
+	advance := false
+	switch {
+	case inpututil.IsKeyJustPressed(pauseKey):
+		p.paused = !p.paused
+	case inpututil.IsKeyJustPressed(advanceKey):
+		p.paused, advance = true, true
+	case inpututil.IsKeyJustPressed(hudKey):
+		p.hud.show = !p.hud.show
+	case inpututil.IsKeyJustPressed(memoryKey):
+		p.memView.show = !p.memView.show
+	case inpututil.IsKeyJustPressed(cheatKey) && p.machine != nil && !p.memView.editing():
+		p.cheats.show = true
+		return nil
+	case inpututil.IsKeyJustPressed(paletteKey):
+		p.palette = (p.palette + 1) % len(p.allPalettes())
+	case inpututil.IsKeyJustPressed(gridKey):
+		p.showGrid = !p.showGrid
+	case inpututil.IsKeyJustPressed(fullscreenKey):
+		p.toggleFullscreen()
+	case inpututil.IsKeyJustPressed(growKey):
+		p.setWindowScale(p.windowScale + scaleStep)
+	case inpututil.IsKeyJustPressed(shrinkKey):
+		p.setWindowScale(p.windowScale - scaleStep)
+	case inpututil.IsKeyJustPressed(launcherKey) && p.launcher != nil && p.machine != nil && !p.memView.editing():
+		p.stopGame()
+		return nil
+	}
+	if p.launcher != nil && p.machine == nil {
+		if filename := p.launcher.update(); filename != "" {
+			return p.Launch(filename)
+		}
+		return nil
+	}
+	if p.memView.show && p.machine != nil {
+		p.memView.update(p.machine, p.screenHeight)
+	}
+	if !p.memView.editing() {
+		p.keypad.update()
+	}
+	if !p.paused || advance {
+		p.tick()
+	}
+	return nil
+}
+
+// tick lets the machine run a frame, and moves the phosphor on by the
+// frame it drew last, so that pixels fade with the frames of the machine
+// rather than with the refresh rate of the monitor
+func (p *Prog) tick() {
+	if !p.clock.tick() {
+		return
+	}
+	p.mu.Lock()
+	f := p.frame
+	p.mu.Unlock()
+	p.phosphor.advance(&f)
+}
+
+// Draw draws the current game to the given screen
+func (p *Prog) Draw(screen *ebiten.Image) error {
+	p.mu.Lock()
+	f := p.frame
+	p.mu.Unlock()
+
+	palette := p.allPalettes()[p.palette]
+	if p.launcher != nil && p.machine == nil {
+		p.launcher.draw(screen, palette)
+		return nil
+	}
+	screenWidth, screenHeight := screen.Size()
+	p.screenHeight = screenHeight
+	l := fit(screenWidth, screenHeight, f.width, f.height, p.integerScale)
+
+	screen.Fill(letterboxColor)
+	drawRect(screen, l.x, l.y, float64(f.width)*l.scale, float64(f.height)*l.scale, palette.Color(0), 1)
+	p.phosphor.filter(&f, func(row, col int, pixel byte, intensity float64) {
+		drawAPixel(screen, l, row, col, palette.Color(pixel), intensity)
+	})
+	if p.showGrid {
+		p.drawGrid(screen, l, &f)
+	}
+	p.drawShapes(screen, l)
+	if p.cheats.show && p.machine != nil {
+		p.cheats.draw(screen, p.machine)
+	} else if p.memView.show && p.machine != nil {
+		p.memView.draw(screen, p.machine)
+	} else if p.hud.show {
+		p.drawHUD(screen)
+	}
+	p.drawToasts(screen)
+	if p.paused && p.machine != nil {
+		text := fmt.Sprintf("PAUSED after frame %d, F6 advances, F5 resumes", p.machine.State().Frames)
+		ebitenutil.DebugPrintAt(screen, text, hudMargin, screenHeight-lineHeight-hudMargin)
+	}
+	return nil
+}
+
+func drawAPixel(screen *ebiten.Image, l layout, row, col int, clr color.RGBA, intensity float64) {
+	drawRect(screen, l.x+float64(col)*l.scale, l.y+float64(row)*l.scale, l.scale, l.scale, clr, intensity)
+}
+
+// drawRect fills a rectangle given in screen pixels with a colour whose
+// alpha is further scaled by intensity
+func drawRect(screen *ebiten.Image, x, y, width, height float64, clr color.RGBA, intensity float64) {
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(width, height)
+	op.GeoM.Translate(x, y)
+	op.ColorM.Scale(float64(clr.R)/0xFF, float64(clr.G)/0xFF, float64(clr.B)/0xFF, float64(clr.A)/0xFF*intensity)
+	screen.DrawImage(aPixel, op)
+}
@@ -0,0 +1,81 @@
+package window
+
+import (
+	"image/color"
+	"strconv"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+)
+
+const (
+	defaultGridSpacing = 8
+	labelWidth         = 6 * 3  // Debug font is 6x16, labels have up to 3 digits
+	labelHeight        = 16 + 2 // Plus a margin
+)
+
+var (
+	spriteColor    = color.RGBA{0x00, 0xA0, 0xFF, 0xFF}
+	collisionColor = color.RGBA{0xFF, 0x00, 0xFF, 0xA0}
+)
+
+// Grid is a debugging overlay drawn over the board
+type Grid struct {
+	Spacing int        // Board pixels between lines
+	Color   color.RGBA // Line colour, its alpha is the opacity
+	Labels  bool       // Show row and column numbers
+}
+
+// SetGrid sets the grid overlay. It starts hidden when show is false and
+// the grid hotkey toggles it.
+func (p *Prog) SetGrid(grid Grid, show bool) {
+	if grid.Spacing <= 0 {
+		grid.Spacing = defaultGridSpacing
+	}
+	p.grid = grid
+	p.showGrid = show
+}
+
+// drawGrid draws the grid lines, the outline of the last sprite and the
+// pixels that caused its collision
+func (p *Prog) drawGrid(screen *ebiten.Image, l layout, f *frame) {
+	width := float64(f.width) * l.scale
+	height := float64(f.height) * l.scale
+	for row := p.grid.Spacing; row < f.height; row += p.grid.Spacing {
+		drawRect(screen, l.x, l.y+float64(row)*l.scale, width, 1, p.grid.Color, 1)
+	}
+	for col := p.grid.Spacing; col < f.width; col += p.grid.Spacing {
+		drawRect(screen, l.x+float64(col)*l.scale, l.y, 1, height, p.grid.Color, 1)
+	}
+
+	for _, pt := range f.sprite.Collisions {
+		drawAPixel(screen, l, pt.Y, pt.X, collisionColor, 1)
+	}
+	if f.sprite.Width > 0 && f.sprite.Height > 0 {
+		drawOutline(screen, l.x+float64(f.sprite.X)*l.scale, l.y+float64(f.sprite.Y)*l.scale,
+			float64(f.sprite.Width)*l.scale, float64(f.sprite.Height)*l.scale, spriteColor)
+	}
+
+	if !p.grid.Labels {
+		return
+	}
+	step := float64(p.grid.Spacing) * l.scale
+	if step >= labelWidth {
+		for col := 0; col < f.width; col += p.grid.Spacing {
+			ebitenutil.DebugPrintAt(screen, strconv.Itoa(col), int(l.x+float64(col)*l.scale)+2, int(l.y))
+		}
+	}
+	if step >= labelHeight {
+		for row := p.grid.Spacing; row < f.height; row += p.grid.Spacing {
+			ebitenutil.DebugPrintAt(screen, strconv.Itoa(row), int(l.x)+2, int(l.y+float64(row)*l.scale))
+		}
+	}
+}
+
+// drawOutline draws a one pixel wide rectangle
+func drawOutline(screen *ebiten.Image, x, y, width, height float64, clr color.RGBA) {
+	drawRect(screen, x, y, width, 1, clr, 1)
+	drawRect(screen, x, y+height-1, width, 1, clr, 1)
+	drawRect(screen, x, y, 1, height, clr, 1)
+	drawRect(screen, x+width-1, y, 1, height, clr, 1)
+}
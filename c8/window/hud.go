@@ -0,0 +1,115 @@
+package window
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+)
+
+const (
+	hudInstructions = 6 // Shown from the PC onwards
+	hudColumn       = 6 * 26
+	hudMargin       = 4
+	charWidth       = 6
+	lineHeight      = 16
+)
+
+var hudBackground = color.RGBA{0x00, 0x00, 0x00, 0xC0}
+
+// keypadLayout is the hex keypad as it appears on a COSMAC VIP
+var keypadLayout = [4][4]byte{
+	{0x1, 0x2, 0x3, 0xC},
+	{0x4, 0x5, 0x6, 0xD},
+	{0x7, 0x8, 0x9, 0xE},
+	{0xA, 0x0, 0xB, 0xF},
+}
+
+// hud is the debug panel drawn over the board
+type hud struct {
+	show bool
+
+	// Rates measured over the last second
+	since        time.Time
+	instructions uint64
+	frames       uint64
+	ips          float64
+	eps          float64 // Emulated frames per second
+}
+
+// measure updates the rates once a second
+func (h *hud) measure(s c8.State) {
+	now := time.Now()
+	if h.since.IsZero() {
+		h.since, h.instructions, h.frames = now, s.Instructions, s.Frames
+		return
+	}
+	elapsed := now.Sub(h.since).Seconds()
+	if elapsed < 1 {
+		return
+	}
+	h.ips = float64(s.Instructions-h.instructions) / elapsed
+	h.eps = float64(s.Frames-h.frames) / elapsed
+	h.since, h.instructions, h.frames = now, s.Instructions, s.Frames
+}
+
+// drawHUD draws the registers, stack, upcoming instructions, keypad and
+// performance of the machine
+func (p *Prog) drawHUD(screen *ebiten.Image) {
+	if p.machine == nil {
+		return
+	}
+	s := p.machine.State()
+	p.hud.measure(s)
+
+	var left strings.Builder
+	fmt.Fprintf(&left, "PC %04X  I %04X\n", s.PC, s.I)
+	fmt.Fprintf(&left, "DT %02X    ST %02X\n", s.DelayTimer, s.SoundTimer)
+	for row := 0; row < 4; row++ {
+		for col := 0; col < 4; col++ {
+			reg := row*4 + col
+			fmt.Fprintf(&left, "V%X %02X ", reg, s.V[reg])
+		}
+		left.WriteString("\n")
+	}
+	left.WriteString("SP")
+	for _, addr := range s.Stack {
+		fmt.Fprintf(&left, " %03X", addr)
+	}
+	left.WriteString("\n")
+	fmt.Fprintf(&left, "IPS %.0f\nEPS %.1f FPS %.1f\n", p.hud.ips, p.hud.eps, ebiten.CurrentFPS())
+
+	var right strings.Builder
+	code := p.machine.Peek(s.PC, 2*hudInstructions)
+	for i := 0; i+1 < len(code); i += 2 {
+		op := uint16(code[i])<<8 | uint16(code[i+1])
+		marker := " "
+		if i == 0 {
+			marker = ">"
+		}
+		fmt.Fprintf(&right, "%s%03X %04X %s\n", marker, int(s.PC)+i, op, c8.Disassemble(op))
+	}
+	right.WriteString("\n")
+	for _, row := range keypadLayout {
+		for _, key := range row {
+			if s.Keys&(1<<key) != 0 {
+				fmt.Fprintf(&right, "%X ", key)
+			} else {
+				right.WriteString(". ")
+			}
+		}
+		right.WriteString("\n")
+	}
+
+	lines := strings.Count(left.String(), "\n")
+	if n := strings.Count(right.String(), "\n"); n > lines {
+		lines = n
+	}
+	drawRect(screen, 0, 0, hudColumn+hudMargin+26*charWidth, float64(lines*lineHeight+2*hudMargin), hudBackground, 1)
+	ebitenutil.DebugPrintAt(screen, left.String(), hudMargin, hudMargin)
+	ebitenutil.DebugPrintAt(screen, right.String(), hudMargin+hudColumn, hudMargin)
+}
@@ -0,0 +1,121 @@
+package window
+
+import (
+	"sync/atomic"
+
+	"github.com/hajimehoshi/ebiten"
+)
+
+// Hotkeys handled by the window itself
+const (
+	hudKey        = ebiten.KeyF1
+	paletteKey    = ebiten.KeyF2
+	gridKey       = ebiten.KeyF3
+	memoryKey     = ebiten.KeyF4
+	launcherKey   = ebiten.KeyEscape
+	pauseKey      = ebiten.KeyF5
+	advanceKey    = ebiten.KeyF6
+	cheatKey      = ebiten.KeyF7
+	fullscreenKey = ebiten.KeyF11
+	growKey       = ebiten.KeyEqual
+	shrinkKey     = ebiten.KeyMinus
+)
+
+// keyMap maps the hex keypad onto the left side of a QWERTY keyboard:
+//
+//	1 2 3 C      1 2 3 4
+//	4 5 6 D  =>  Q W E R
+//	7 8 9 E      A S D F
+//	A 0 B F      Z X C V
+var keyMap = [16]ebiten.Key{
+	ebiten.KeyX, ebiten.Key1, ebiten.Key2, ebiten.Key3,
+	ebiten.KeyQ, ebiten.KeyW, ebiten.KeyE, ebiten.KeyA,
+	ebiten.KeyS, ebiten.KeyD, ebiten.KeyZ, ebiten.KeyC,
+	ebiten.Key4, ebiten.KeyR, ebiten.KeyF, ebiten.KeyV,
+}
+
+// gameKeys are the keys bound to the names the ROM database uses for the
+// controls of a game
+var gameKeys = map[string]ebiten.Key{
+	"up":           ebiten.KeyUp,
+	"down":         ebiten.KeyDown,
+	"left":         ebiten.KeyLeft,
+	"right":        ebiten.KeyRight,
+	"a":            ebiten.KeySpace,
+	"b":            ebiten.KeyEnter,
+	"player2Up":    ebiten.KeyI,
+	"player2Down":  ebiten.KeyK,
+	"player2Left":  ebiten.KeyJ,
+	"player2Right": ebiten.KeyL,
+	"player2A":     ebiten.KeyU,
+	"player2B":     ebiten.KeyO,
+}
+
+// Keypad reads the hex keys from the window keyboard
+type Keypad struct {
+	keys     uint32
+	bindings map[ebiten.Key]byte // Keys of the game, besides keyMap
+}
+
+// bind adds the controls of a game, as named by the ROM database, to the
+// keys of keyMap
+func (k *Keypad) bind(controls map[string]byte) {
+	k.bindings = map[ebiten.Key]byte{}
+	for name, key := range controls {
+		if ebitenKey, ok := gameKeys[name]; ok {
+			k.bindings[ebitenKey] = key & 0xF
+		}
+	}
+}
+
+// update polls the keyboard, it must be called from the ebiten update loop
+func (k *Keypad) update() {
+	var keys uint32
+	for key, ebitenKey := range keyMap {
+		if ebiten.IsKeyPressed(ebitenKey) {
+			keys |= 1 << uint(key)
+		}
+	}
+	for ebitenKey, key := range k.bindings {
+		if ebiten.IsKeyPressed(ebitenKey) {
+			keys |= 1 << key
+		}
+	}
+	atomic.StoreUint32(&k.keys, keys)
+}
+
+// Keys returns the keys held during the last update
+func (k *Keypad) Keys() uint16 {
+	return uint16(atomic.LoadUint32(&k.keys))
+}
+
+// Clock ticks once per ebiten update, so frames follow the window refresh
+type Clock struct {
+	ticks chan struct{}
+}
+
+func newClock() *Clock {
+	return &Clock{ticks: make(chan struct{}, 1)}
+}
+
+// tick lets the next frame run without waiting for it. It returns false
+// when the machine has yet to run the frame of the previous tick.
+func (c *Clock) tick() bool {
+	select {
+	case c.ticks <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Tick blocks until the next ebiten update
+func (c *Clock) Tick() {
+	<-c.ticks
+}
+
+// stop makes Tick return at once from now on, so that a stopped machine
+// gets to see it is stopped. tick must not be called afterwards.
+func (c *Clock) stop() {
+	close(c.ticks)
+}
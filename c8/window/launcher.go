@@ -0,0 +1,272 @@
+package window
+
+import (
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+)
+
+const (
+	thumbnailWidth  = 3 * pixelsHorizontally // Preferred, the columns share the screen width
+	thumbnailMargin = 8
+	gamepadDeadZone = 0.5
+)
+
+var launcherBackground = color.RGBA{0x20, 0x20, 0x20, 0xFF}
+
+// LoadFunc prepares a machine for a ROM picked in the launcher. The window
+// attaches and runs it.
+type LoadFunc func(filename string) (*c8.Machine, error)
+
+// Launcher lists the ROMs of some directories as thumbnails of themselves
+// running headless, and lets the user pick one to play
+type Launcher struct {
+	roms     []*launcherROM
+	selected int
+	top      int // First row shown
+	columns  int // As of the last draw
+	rows     int // Visible, as of the last draw
+
+	dirs    []string
+	stickX  int // Direction the gamepad stick was held in on the last update
+	stickY  int
+	pressed bool // A gamepad button was held on the last update
+}
+
+// launcherROM is a ROM of the launcher and its thumbnail
+type launcherROM struct {
+	name     string
+	filename string
+	machine  *c8.Machine // Created once the ROM is first shown
+	err      error       // Why the thumbnail stopped
+	screen   thumbnail
+	image    *ebiten.Image
+	palette  string // Of the image
+}
+
+// thumbnail is the display of a launcher machine
+type thumbnail struct {
+	frame frame
+	dirty bool
+}
+
+// Refresh copies the board, it is called from the ebiten update loop
+func (t *thumbnail) Refresh(b *c8.Board) {
+	t.frame.width, t.frame.height = b.Width(), b.Height()
+	for row := 0; row < b.Height(); row++ {
+		for col := 0; col < b.Width(); col++ {
+			t.frame.pixels[row][col] = b.Pixel(row, col)
+		}
+	}
+	t.dirty = true
+}
+
+// NewLauncher generates a new Launcher listing the files of the given
+// directories. Directories that do not exist are skipped.
+func NewLauncher(dirs ...string) (*Launcher, error) {
+	l := &Launcher{dirs: dirs, columns: 1, rows: 1}
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+		for _, file := range files {
+			if file.IsDir() || file.Size() == 0 || file.Name()[0] == '.' {
+				continue
+			}
+			l.roms = append(l.roms, &launcherROM{
+				name:     file.Name(),
+				filename: filepath.Join(dir, file.Name()),
+			})
+		}
+	}
+	return l, nil
+}
+
+// update moves the selection and runs a frame of every visible thumbnail.
+// It returns the file name of the ROM to start, if one was picked.
+func (l *Launcher) update() string {
+	if len(l.roms) == 0 {
+		return ""
+	}
+
+	dx, dy, pick := l.gamepad()
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		dx = -1
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		dx = 1
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp):
+		dy = -1
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown):
+		dy = 1
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter), inpututil.IsKeyJustPressed(ebiten.KeySpace):
+		pick = true
+	}
+	if selected := l.selected + dx + dy*l.columns; selected >= 0 && selected < len(l.roms) {
+		l.selected = selected
+	}
+	if row := l.selected / l.columns; row < l.top {
+		l.top = row
+	} else if row >= l.top+l.rows {
+		l.top = row - l.rows + 1
+	}
+	if pick {
+		return l.roms[l.selected].filename
+	}
+
+	for i := l.top * l.columns; i < len(l.roms) && i < (l.top+l.rows)*l.columns; i++ {
+		l.roms[i].run()
+	}
+	return ""
+}
+
+// gamepad returns the move and pick of the first gamepad with its stick or
+// first button newly pressed
+func (l *Launcher) gamepad() (dx, dy int, pick bool) {
+	stickX, stickY, pressed := 0, 0, false
+	for _, id := range ebiten.GamepadIDs() {
+		if ebiten.GamepadAxisNum(id) >= 2 {
+			stickX = direction(ebiten.GamepadAxis(id, 0))
+			stickY = direction(ebiten.GamepadAxis(id, 1))
+		}
+		pressed = ebiten.GamepadButtonNum(id) > 0 && ebiten.IsGamepadButtonPressed(id, ebiten.GamepadButton0)
+		if stickX != 0 || stickY != 0 || pressed {
+			break
+		}
+	}
+	if stickX != l.stickX {
+		dx = stickX
+	}
+	if stickY != l.stickY {
+		dy = stickY
+	}
+	pick = pressed && !l.pressed
+	l.stickX, l.stickY, l.pressed = stickX, stickY, pressed
+	return dx, dy, pick
+}
+
+func direction(axis float64) int {
+	switch {
+	case axis < -gamepadDeadZone:
+		return -1
+	case axis > gamepadDeadZone:
+		return 1
+	}
+	return 0
+}
+
+// run executes a frame of the thumbnail, loading the ROM the first time
+func (r *launcherROM) run() {
+	if r.err != nil {
+		return
+	}
+	if r.machine == nil {
+		r.machine = c8.NewMachine()
+		r.machine.Display = &r.screen
+		var file *os.File
+		if file, r.err = os.Open(r.filename); r.err != nil {
+			return
+		}
+		r.err = r.machine.LoadROM(file)
+		file.Close()
+		if r.err != nil {
+			return
+		}
+	}
+	r.err = r.machine.RunFrame()
+}
+
+// draw shows the thumbnails as a grid filling the screen, with the picking
+// keys on top
+func (l *Launcher) draw(screen *ebiten.Image, palette c8.Palette) {
+	screenWidth, screenHeight := screen.Size()
+	screen.Fill(launcherBackground)
+	if len(l.roms) == 0 {
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("No ROMs found in %v", l.dirs), thumbnailMargin, thumbnailMargin)
+		return
+	}
+	ebitenutil.DebugPrintAt(screen, "Arrows or stick to choose, Enter or button 0 to play, Esc comes back here",
+		thumbnailMargin, 0)
+
+	l.columns = screenWidth / thumbnailWidth
+	if l.columns < 1 {
+		l.columns = 1
+	}
+	cellWidth := float64(screenWidth) / float64(l.columns)
+	width := cellWidth - 2*thumbnailMargin
+	height := width * pixelsVertically / pixelsHorizontally
+	cellHeight := height + lineHeight + 2*thumbnailMargin
+	l.rows = int((float64(screenHeight) - lineHeight) / cellHeight)
+	if l.rows < 1 {
+		l.rows = 1
+	}
+
+	for i := l.top * l.columns; i < len(l.roms) && i < (l.top+l.rows)*l.columns; i++ {
+		r := l.roms[i]
+		x := float64(i%l.columns)*cellWidth + thumbnailMargin
+		y := float64(i/l.columns-l.top)*cellHeight + lineHeight + thumbnailMargin
+		r.draw(screen, palette, x, y, width, height)
+		if i == l.selected {
+			drawOutline(screen, x-2, y-2, width+4, height+lineHeight+4, selectedColor)
+		}
+		name := r.name
+		if r.err != nil && r.err != c8.ErrStopped {
+			name += " (" + r.err.Error() + ")"
+		}
+		ebitenutil.DebugPrintAt(screen, name, int(x), int(y+height))
+	}
+}
+
+// draw shows the thumbnail scaled to the given rectangle
+func (r *launcherROM) draw(screen *ebiten.Image, palette c8.Palette, x, y, width, height float64) {
+	if r.image == nil {
+		var err error
+		r.image, err = ebiten.NewImage(c8.MaxBoardWidth, c8.MaxBoardHeight, ebiten.FilterNearest)
+		if err != nil {
+			r.err = err
+			return
+		}
+		if r.screen.frame.width == 0 {
+			r.screen.frame.width, r.screen.frame.height = pixelsHorizontally, pixelsVertically
+		}
+		r.screen.dirty = true
+	}
+	if r.screen.dirty || r.palette != palette.Name {
+		r.screen.dirty, r.palette = false, palette.Name
+		r.image.ReplacePixels(r.screen.pixels(palette))
+	}
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(width/c8.MaxBoardWidth, height/c8.MaxBoardHeight)
+	op.GeoM.Translate(x, y)
+	screen.DrawImage(r.image, op)
+}
+
+// pixels returns the board as RGBA bytes of a hires image, lores pixels
+// taking two by two of them
+func (t *thumbnail) pixels(palette c8.Palette) []byte {
+	f := &t.frame
+	scale := c8.MaxBoardWidth / f.width
+	pix := make([]byte, 4*c8.MaxBoardWidth*c8.MaxBoardHeight)
+	for row := 0; row < c8.MaxBoardHeight; row++ {
+		for col := 0; col < c8.MaxBoardWidth; col++ {
+			clr := palette.Color(f.pixels[row/scale][col/scale])
+			i := 4 * (row*c8.MaxBoardWidth + col)
+			pix[i], pix[i+1], pix[i+2], pix[i+3] = clr.R, clr.G, clr.B, 0xFF
+		}
+	}
+	return pix
+}
@@ -0,0 +1,63 @@
+package window
+
+import (
+	"math"
+
+	"github.com/hajimehoshi/ebiten"
+)
+
+const (
+	pixelsHorizontally = 64
+	pixelsVertically   = 32
+)
+
+// layout is where the board goes on the screen
+type layout struct {
+	scale float64 // Screen pixels per board pixel
+	x, y  float64 // Top left corner of the board
+}
+
+// fit scales a board of the given size to fill the screen while keeping its
+// aspect ratio, centring it between bars when the ratios differ. With
+// integer set the scale is rounded down to a whole number of pixels.
+func fit(screenWidth, screenHeight, boardWidth, boardHeight int, integer bool) layout {
+	scale := math.Min(float64(screenWidth)/float64(boardWidth), float64(screenHeight)/float64(boardHeight))
+	if integer && scale >= 1 {
+		scale = math.Floor(scale)
+	}
+	return layout{
+		scale: scale,
+		x:     (float64(screenWidth) - float64(boardWidth)*scale) / 2,
+		y:     (float64(screenHeight) - float64(boardHeight)*scale) / 2,
+	}
+}
+
+// WindowSize returns the size of a window showing a lores pixel as a
+// square of scale screen pixels. Hires boards use half of that.
+func WindowSize(scale float64) (int, int) {
+	return int(math.Round(pixelsHorizontally * scale)), int(math.Round(pixelsVertically * scale))
+}
+
+// setWindowScale resizes the window
+func (p *Prog) setWindowScale(scale float64) {
+	if scale < 1 {
+		scale = 1
+	}
+	p.windowScale = scale
+	if !ebiten.IsFullscreen() {
+		ebiten.SetScreenSize(WindowSize(scale))
+	}
+}
+
+// toggleFullscreen switches between the window and the whole monitor. In
+// fullscreen the screen has the size of the monitor so that the layout,
+// not ebiten, decides how the board is scaled.
+func (p *Prog) toggleFullscreen() {
+	if ebiten.IsFullscreen() {
+		ebiten.SetFullscreen(false)
+		ebiten.SetScreenSize(WindowSize(p.windowScale))
+		return
+	}
+	ebiten.SetScreenSize(ebiten.ScreenSizeInFullscreen())
+	ebiten.SetFullscreen(true)
+}
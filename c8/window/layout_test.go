@@ -0,0 +1,31 @@
+package window
+
+import "testing"
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		screenWidth, screenHeight int
+		boardWidth, boardHeight   int
+		integer                   bool
+		want                      layout
+	}{
+		{640, 320, 64, 32, true, layout{10, 0, 0}},
+		{640, 320, 128, 64, true, layout{5, 0, 0}},
+		// Bars on the sides, then above and below
+		{700, 320, 64, 32, true, layout{10, 30, 0}},
+		{1920, 1080, 128, 64, true, layout{15, 0, 60}},
+		{1000, 1000, 64, 32, false, layout{15.625, 0, 250}},
+		// A fractional scale is rounded down, leaving bars on every side
+		{700, 400, 64, 32, true, layout{10, 30, 40}},
+		{700, 400, 64, 32, false, layout{10.9375, 0, 25}},
+		// A screen smaller than the board is not rounded down to nothing
+		{32, 16, 64, 32, true, layout{0.5, 0, 0}},
+	}
+	for _, test := range tests {
+		got := fit(test.screenWidth, test.screenHeight, test.boardWidth, test.boardHeight, test.integer)
+		if got != test.want {
+			t.Errorf("%dx%d board on a %dx%d screen, integer %v, is %+v, want %+v",
+				test.boardWidth, test.boardHeight, test.screenWidth, test.screenHeight, test.integer, got, test.want)
+		}
+	}
+}
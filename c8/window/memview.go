@@ -0,0 +1,193 @@
+package window
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+)
+
+const (
+	memoryBytes   = 0x1000
+	bytesPerRow   = 16
+	memoryRows    = memoryBytes / bytesPerRow
+	hexColumn     = 5    // Characters before the first byte, "0200 "
+	accessFadeOut = 0.05 // Heat lost every frame
+)
+
+var (
+	accessColors = []struct {
+		access c8.Access
+		color  color.RGBA
+	}{
+		{c8.AccessExecute, color.RGBA{0x00, 0xC0, 0x00, 0xFF}},
+		{c8.AccessRead, color.RGBA{0x00, 0x60, 0xFF, 0xFF}},
+		{c8.AccessWrite, color.RGBA{0xFF, 0x20, 0x20, 0xFF}},
+		{c8.AccessSprite, color.RGBA{0xFF, 0xC0, 0x00, 0xFF}},
+	}
+	pcColor       = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	indexColor    = color.RGBA{0x00, 0xFF, 0xFF, 0xFF}
+	selectedColor = color.RGBA{0xFF, 0x00, 0xFF, 0xFF}
+)
+
+// memView shows the whole address space as a hex and ASCII grid, with
+// bytes coloured by how they were recently used
+type memView struct {
+	show bool
+	top  int // First row shown
+
+	heat [memoryBytes][4]float64 // Per byte and per entry of accessColors
+
+	selected int    // Address being edited, or -1
+	typed    string // Hex digits typed for the selected byte
+}
+
+func newMemView() memView {
+	return memView{selected: -1}
+}
+
+// editing reports whether typed keys go to the memory viewer rather than
+// to the keypad
+func (v *memView) editing() bool {
+	return v.show && v.selected >= 0
+}
+
+// update scrolls, selects and edits bytes. It must be called from the
+// ebiten update loop.
+func (v *memView) update(m *c8.Machine, screenHeight int) {
+	rows := v.visibleRows(screenHeight)
+	_, wheel := ebiten.Wheel()
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyPageDown) || wheel < 0:
+		v.scroll(rows/2, rows)
+	case inpututil.IsKeyJustPressed(ebiten.KeyPageUp) || wheel > 0:
+		v.scroll(-rows/2, rows)
+	case inpututil.IsKeyJustPressed(ebiten.KeyHome):
+		v.top = int(m.State().PC) / bytesPerRow
+		v.scroll(0, rows)
+	}
+
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		v.selected, v.typed = v.addressAt(ebiten.CursorPosition()), ""
+	}
+	if v.selected < 0 {
+		return
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		v.selected = -1
+		return
+	}
+	for _, char := range ebiten.InputChars() {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", char) {
+			continue
+		}
+		v.typed += string(char)
+		if len(v.typed) == 2 {
+			var val byte
+			fmt.Sscanf(v.typed, "%02x", &val)
+			m.Poke(uint16(v.selected), val)
+			v.selected, v.typed = (v.selected+1)%memoryBytes, ""
+		}
+	}
+}
+
+func (v *memView) visibleRows(screenHeight int) int {
+	return screenHeight/lineHeight - 1
+}
+
+func (v *memView) scroll(by, rows int) {
+	v.top += by
+	if v.top > memoryRows-rows {
+		v.top = memoryRows - rows
+	}
+	if v.top < 0 {
+		v.top = 0
+	}
+}
+
+// addressAt returns the address of the byte drawn at the given screen
+// position, or -1
+func (v *memView) addressAt(x, y int) int {
+	row := y/lineHeight - 1
+	col := x / charWidth
+	if row < 0 || col < hexColumn || col >= hexColumn+3*bytesPerRow {
+		return -1
+	}
+	addr := (v.top+row)*bytesPerRow + (col-hexColumn)/3
+	if addr >= memoryBytes {
+		return -1
+	}
+	return addr
+}
+
+// draw shows the memory of the machine over the whole screen
+func (v *memView) draw(screen *ebiten.Image, m *c8.Machine) {
+	accesses := m.TakeAccesses()
+	for addr, a := range accesses {
+		for i, ac := range accessColors {
+			if a&ac.access != 0 {
+				v.heat[addr][i] = 1
+			} else if v.heat[addr][i] > 0 {
+				v.heat[addr][i] -= accessFadeOut
+			}
+		}
+	}
+
+	screenWidth, screenHeight := screen.Size()
+	rows := v.visibleRows(screenHeight)
+	v.scroll(0, rows)
+	s := m.State()
+	data := m.Peek(uint16(v.top*bytesPerRow), rows*bytesPerRow)
+
+	drawRect(screen, 0, 0, float64(screenWidth), float64(screenHeight), hudBackground, 1)
+	header := fmt.Sprintf("MEMORY  PC %03X  I %03X  PgUp/PgDn Home, click a byte to edit", s.PC, s.I)
+	if v.selected >= 0 {
+		header = fmt.Sprintf("EDIT %03X: %-2s  type two hex digits, Esc to stop", v.selected, v.typed)
+	}
+	ebitenutil.DebugPrintAt(screen, header, 0, 0)
+
+	var text strings.Builder
+	for row := 0; row*bytesPerRow < len(data); row++ {
+		base := (v.top + row) * bytesPerRow
+		fmt.Fprintf(&text, "%04X ", base)
+		var ascii strings.Builder
+		for col := 0; col < bytesPerRow && row*bytesPerRow+col < len(data); col++ {
+			addr := base + col
+			val := data[row*bytesPerRow+col]
+			x := float64((hexColumn + 3*col) * charWidth)
+			y := float64((row + 1) * lineHeight)
+			v.drawHeat(screen, addr, x, y)
+			switch addr {
+			case v.selected:
+				drawOutline(screen, x-1, y, 2*charWidth+2, lineHeight, selectedColor)
+			case int(s.PC):
+				drawOutline(screen, x-1, y, 2*charWidth+2, lineHeight, pcColor)
+			case int(s.I):
+				drawOutline(screen, x-1, y, 2*charWidth+2, lineHeight, indexColor)
+			}
+
+			fmt.Fprintf(&text, "%02X ", val)
+			if val >= 0x20 && val < 0x7F {
+				ascii.WriteByte(val)
+			} else {
+				ascii.WriteByte('.')
+			}
+		}
+		fmt.Fprintf(&text, " %s\n", ascii.String())
+	}
+	ebitenutil.DebugPrintAt(screen, text.String(), 0, lineHeight)
+}
+
+// drawHeat colours the background of a byte by its recent accesses, the
+// most recent kind on top
+func (v *memView) drawHeat(screen *ebiten.Image, addr int, x, y float64) {
+	for i, ac := range accessColors {
+		if heat := v.heat[addr][i]; heat > 0 {
+			drawRect(screen, x-1, y, 2*charWidth+2, lineHeight, ac.color, heat*0.6)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package window
+
+import (
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+)
+
+// SetShapes replaces the shapes drawn over the board, making the window
+// the c8.Overlay of scripts. It can be called from any goroutine.
+func (p *Prog) SetShapes(shapes []c8.Shape) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.shapes = append(p.shapes[:0], shapes...)
+}
+
+// drawShapes draws the overlay at the scale of the board. Text is drawn
+// in the debug font, whatever its colour.
+func (p *Prog) drawShapes(screen *ebiten.Image, l layout) {
+	p.mu.Lock()
+	shapes := append([]c8.Shape(nil), p.shapes...)
+	p.mu.Unlock()
+
+	for _, s := range shapes {
+		x, y := l.x+float64(s.X)*l.scale, l.y+float64(s.Y)*l.scale
+		if s.Text != "" {
+			ebitenutil.DebugPrintAt(screen, s.Text, int(x), int(y))
+			continue
+		}
+		drawRect(screen, x, y, float64(s.Width)*l.scale, float64(s.Height)*l.scale, s.Color, 1)
+	}
+}
@@ -0,0 +1,102 @@
+package window
+
+import (
+	"fmt"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// PhosphorMode selects how previous frames linger on the screen
+type PhosphorMode int
+
+const (
+	// PhosphorOff draws every frame as it is
+	PhosphorOff PhosphorMode = iota
+	// PhosphorBlend fades pixels out over the following frames
+	PhosphorBlend
+	// PhosphorOr draws a pixel lit in either of the last two frames
+	PhosphorOr
+)
+
+// minIntensity is the intensity below which a fading pixel is not drawn
+const minIntensity = 0.02
+
+// ParsePhosphorMode reads off, blend or or
+func ParsePhosphorMode(s string) (PhosphorMode, error) {
+	switch s {
+	case "off":
+		return PhosphorOff, nil
+	case "blend":
+		return PhosphorBlend, nil
+	case "or":
+		return PhosphorOr, nil
+	}
+	return PhosphorOff, fmt.Errorf("unknown phosphor mode %q", s)
+}
+
+// phosphor imitates the persistence of a CRT, which hides the flicker of
+// sprites erased and redrawn with XOR. It advances with the frames of the
+// machine, however often the window is drawn.
+type phosphor struct {
+	mode  PhosphorMode
+	decay float64 // Fraction of the intensity lost every frame
+
+	intensity [c8.MaxBoardHeight][c8.MaxBoardWidth]float64
+	lastLit   [c8.MaxBoardHeight][c8.MaxBoardWidth]byte // Plane bits the pixel last had
+	current   frame
+	previous  frame
+}
+
+// advance moves the filter on by a frame of the machine
+func (f *phosphor) advance(fr *frame) {
+	if fr.width != f.current.width || fr.height != f.current.height {
+		// Nothing lingers across a change of resolution
+		*f = phosphor{mode: f.mode, decay: f.decay}
+	}
+
+	if f.mode == PhosphorBlend {
+		for row := 0; row < fr.height; row++ {
+			for col := 0; col < fr.width; col++ {
+				if pixel := fr.pixels[row][col]; pixel > 0 {
+					f.intensity[row][col] = 1
+					f.lastLit[row][col] = pixel
+				} else {
+					f.intensity[row][col] *= 1 - f.decay
+				}
+			}
+		}
+	}
+	f.previous = f.current
+	f.current = *fr
+}
+
+// filter calls draw for every pixel of fr to show, with its plane bits and
+// an intensity between 0 and 1. It only reads the filter.
+func (f *phosphor) filter(fr *frame, draw func(row, col int, pixel byte, intensity float64)) {
+	mode := f.mode
+	if fr.width != f.current.width || fr.height != f.current.height {
+		mode = PhosphorOff
+	}
+
+	for row := 0; row < fr.height; row++ {
+		for col := 0; col < fr.width; col++ {
+			pixel := fr.pixels[row][col]
+			switch mode {
+			case PhosphorBlend:
+				if pixel > 0 {
+					draw(row, col, pixel, 1)
+				} else if f.intensity[row][col] >= minIntensity {
+					draw(row, col, f.lastLit[row][col], f.intensity[row][col])
+				}
+			case PhosphorOr:
+				if pixel|f.previous.pixels[row][col] > 0 {
+					draw(row, col, pixel|f.previous.pixels[row][col], 1)
+				}
+			default:
+				if pixel > 0 {
+					draw(row, col, pixel, 1)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package window
+
+import (
+	"time"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+)
+
+// How long a toast stays on screen
+const toastDuration = 4 * time.Second
+
+// toast is a message shown over the game for a while
+type toast struct {
+	text  string
+	until time.Time
+}
+
+// Toast shows a message, such as an unlocked achievement, at the top of the
+// window for a few seconds. It can be called from any goroutine.
+func (p *Prog) Toast(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.toasts = append(p.toasts, toast{text: text, until: time.Now().Add(toastDuration)})
+}
+
+// drawToasts draws the toasts still showing, newest last, centred at the
+// top of the screen
+func (p *Prog) drawToasts(screen *ebiten.Image) {
+	p.mu.Lock()
+	now := time.Now()
+	showing := p.toasts[:0]
+	for _, t := range p.toasts {
+		if now.Before(t.until) {
+			showing = append(showing, t)
+		}
+	}
+	p.toasts = showing
+	toasts := append([]toast(nil), showing...)
+	p.mu.Unlock()
+
+	screenWidth, _ := screen.Size()
+	for i, t := range toasts {
+		width := len(t.text)*charWidth + 2*hudMargin
+		x := (screenWidth - width) / 2
+		y := hudMargin + i*(lineHeight+2*hudMargin)
+		drawRect(screen, float64(x), float64(y), float64(width), lineHeight+hudMargin, hudBackground, 1)
+		ebitenutil.DebugPrintAt(screen, t.text, x+hudMargin, y)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// config is read from the JSON file given with -config, for example
+//
+//	{
+//		"palette": "mine",
+//		"palettes": {"mine": ["#000000", "#FF8000", "#0080FF", "#FFFFFF"]},
+//		"roms": ["/home/me/chip8"],
+//		"databases": ["/home/me/chip8/programs.json"],
+//		"achievements": ["/home/me/chip8/achievements.json"]
+//	}
+//
+// The databases are in the format of c8.Database and override the
+// built-in one, as do the achievements in the format of c8.Achievements.
+type config struct {
+	Palette      string              `json:"palette"`
+	Palettes     map[string][]string `json:"palettes"`
+	ROMs         []string            `json:"roms"` // Listed by the launcher after the bundled ones
+	Databases    []string            `json:"databases"`
+	Achievements []string            `json:"achievements"`
+}
+
+// loadDatabases adds the databases and achievements of the config to the
+// default ones
+func (cfg *config) loadDatabases() error {
+	for _, filename := range cfg.Databases {
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		err = c8.DefaultDatabase.Load(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	for _, filename := range cfg.Achievements {
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		err = c8.DefaultAchievements.Load(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	return nil
+}
+
+// romDirs returns the directories listed by the launcher
+func (cfg *config) romDirs() []string {
+	return append([]string{"c8games", "c8prog"}, cfg.ROMs...)
+}
+
+func readConfig(filename string) (*config, error) {
+	cfg := &config{}
+	if filename == "" {
+		return cfg, nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return cfg, nil
+}
+
+// palettes returns the palettes to cycle through, starting with the one
+// chosen on the command line or in the config file
+func (cfg *config) palettes(chosen string) ([]c8.Palette, error) {
+	all := append([]c8.Palette(nil), c8.Palettes...)
+
+	var names []string
+	for name := range cfg.Palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, err := c8.NewPalette(name, cfg.Palettes[name]...)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, p)
+	}
+
+	if chosen == "" {
+		chosen = cfg.Palette
+	}
+	if chosen == "" {
+		return all, nil
+	}
+	for i, p := range all {
+		if p.Name == chosen {
+			return append(append([]c8.Palette(nil), all[i:]...), all[:i]...), nil
+		}
+	}
+	p, err := c8.ParsePalette(chosen)
+	if err != nil {
+		return nil, err
+	}
+	return append([]c8.Palette{p}, all...), nil
+}
@@ -1,38 +1,515 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
 
 	"github.com/erdincmutlu/CHIP-8/c8"
+	"github.com/erdincmutlu/CHIP-8/c8/control"
+	"github.com/erdincmutlu/CHIP-8/c8/gym"
+	"github.com/erdincmutlu/CHIP-8/c8/script"
+	"github.com/erdincmutlu/CHIP-8/c8/terminal"
+	"github.com/erdincmutlu/CHIP-8/c8/vnc"
+	"github.com/erdincmutlu/CHIP-8/c8/web"
+	"github.com/erdincmutlu/CHIP-8/c8/window"
 	"github.com/hajimehoshi/ebiten"
+	xterminal "golang.org/x/crypto/ssh/terminal"
 )
 
-var prog *c8.Prog
+var prog *window.Prog
+
+// api is the HTTP control API given with -http, every machine is attached
+// to it
+var api *control.Server
+
+// spectators is the browser page given with -web, every machine is
+// attached to it
+var spectators *web.Server
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("usage \"go run main.go ROM_NAME\"\n")
+	if len(os.Args) > 1 && os.Args[1] == "serve-ssh" {
+		if err := serveSSH(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
 		return
 	}
 
-	err := c8.ReadROM(os.Args[1])
-	if err != nil {
+	frontend := flag.String("frontend", "window", "where to run the ROM: window, terminal, headless, gym or vnc")
+	var opts machineOptions
+	flag.BoolVar(&opts.trace, "trace", false, "print every executed instruction")
+	flag.Uint64Var(&opts.seed, "seed", 0, "seed of the CXNN random numbers, random when 0")
+	flag.StringVar(&opts.script, "script", "", "script to run on the ROM, see package c8/script")
+	httpAddr := flag.String("http", "", "serve the HTTP control API on this address, such as 127.0.0.1:8080")
+	webAddr := flag.String("web", "", "serve a page to watch and play from browsers on this address, such as :8000")
+	vncAddr := flag.String("vnc", ":5900", "address the vnc frontend listens on for VNC viewers")
+	webToken := flag.String("web-token", "", "token in the URL of the browsers allowed to play, random when empty")
+	flag.StringVar(&opts.netplay.host, "netplay-host", "", "play as player 1 of netplay, waiting for player 2 on this UDP address, such as :7000")
+	flag.StringVar(&opts.netplay.join, "netplay-join", "", "play as player 2 of netplay, with player 1 at this UDP address")
+	flag.BoolVar(&opts.netplay.loopback, "netplay-loopback", false, "try netplay with a second machine in the background as player 2")
+	flag.IntVar(&opts.netplay.Delay, "netplay-delay", 2, "frames between pressing keys and netplay using them")
+	flag.DurationVar(&opts.netplay.link.Latency, "netplay-latency", 0, "latency simulated by -netplay-loopback, such as 50ms")
+	flag.Float64Var(&opts.netplay.link.Loss, "netplay-loss", 0, "fraction of the packets -netplay-loopback drops")
+	progressFile := flag.String("progress", defaultProgressFile(), "file the unlocked achievements are saved in")
+	flag.StringVar(&opts.cheatDir, "cheats", defaultCheatDir(), "directory of the cheat files, named by ROM SHA-1, F7 edits them in the window, unused with -record, -replay and netplay")
+	flag.StringVar(&opts.record, "record", "", "record the keys of the ROM into this movie file, an editable timeline if it ends in .txt")
+	flag.StringVar(&opts.replay, "replay", "", "replay this movie or timeline file, then hand the keypad back")
+	palette := flag.String("palette", "", "palette name or comma separated hex colours, e.g. \"#000000,#33FF66\"")
+	configFile := flag.String("config", "", "JSON config file")
+	phosphor := flag.String("phosphor", "off", "persistence filter against flicker: off, blend or or")
+	decay := flag.Float64("decay", 0.4, "fraction of its brightness a pixel loses every frame with -phosphor blend")
+	scale := flag.Float64("scale", 10, "window or VNC pixels per lores pixel")
+	fullscreen := flag.Bool("fullscreen", false, "start in fullscreen, F11 toggles it")
+	integerScale := flag.Bool("integer", true, "only scale the board by whole numbers")
+	grid := flag.Int("grid", 0, "show a grid every N pixels with the last sprite and collision, F3 toggles it")
+	gridColor := flag.String("grid-color", "#FF0000", "grid colour")
+	gridOpacity := flag.Float64("grid-opacity", 0.7, "grid opacity between 0 and 1")
+	gridLabels := flag.Bool("grid-labels", false, "show row and column numbers on the grid")
+	var gymCfg gymOptions
+	flag.IntVar(&gymCfg.envs, "envs", 1, "number of gym environments")
+	flag.StringVar(&gymCfg.Reward, "reward", "0", "gym reward expression, such as \"delta V5\"")
+	flag.StringVar(&gymCfg.Done, "done", "0", "gym expression ending an episode, such as \"VE == 0\"")
+	flag.IntVar(&gymCfg.FrameSkip, "frameskip", 4, "frames per gym step")
+	flag.Uint64Var(&gymCfg.MaxFrames, "max-frames", 0, "frames after which a gym episode ends, unless 0")
+	flag.BoolVar(&gymCfg.rgb, "rgb", false, "send gym observations in the colours of the palette")
+	flag.Parse()
+
+	if flag.NArg() < 1 && (*frontend != "window" || opts.record != "" || opts.replay != "" || opts.netplay.enabled()) {
+		fmt.Printf("usage \"go run main.go [flags] ROM_NAME\", the window shows a launcher without ROM_NAME\n")
+		fmt.Printf("or \"go run main.go serve-ssh [-addr :2222]\" to play the ROMs over SSH\n")
+		flag.PrintDefaults()
 		return
 	}
+	romName := flag.Arg(0)
+
+	cfg, err := readConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	palettes, err := cfg.palettes(*palette)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.loadDatabases(); err != nil {
+		log.Fatal(err)
+	}
+	if opts.achievements, err = loadAchievements(*progressFile); err != nil {
+		log.Fatal(err)
+	}
+	if *httpAddr != "" {
+		startAPI(*httpAddr, *frontend, palettes[0])
+	}
+	if *webAddr != "" {
+		startWeb(*webAddr, *webToken, palettes[0])
+	}
+
+	switch *frontend {
+	case "window":
+		mode, err := window.ParsePhosphorMode(*phosphor)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *decay <= 0 || *decay > 1 {
+			log.Fatalf("decay %v is not between 0 and 1", *decay)
+		}
+		if *scale < 1 {
+			log.Fatalf("scale %v is less than 1", *scale)
+		}
+		prog, err = window.NewProg(palettes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		prog.SetPhosphor(mode, *decay)
+		prog.SetScaling(*scale, *integerScale)
+		clr, err := c8.ParseColor(*gridColor)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *gridOpacity < 0 || *gridOpacity > 1 {
+			log.Fatalf("grid opacity %v is not between 0 and 1", *gridOpacity)
+		}
+		clr.A = byte(*gridOpacity * 0xFF)
+		prog.SetGrid(window.Grid{Spacing: *grid, Color: clr, Labels: *gridLabels}, *grid > 0)
+		prog.SetCheatDir(opts.cheatDir)
+		runWindow(romName, cfg.romDirs(), opts, *scale, *fullscreen)
+	case "terminal":
+		if err := runTerminal(romName, opts); err != nil {
+			log.Fatal(err)
+		}
+	case "headless":
+		m, movie, err := newMachine(romName, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		movie.stopAfterReplay()
+		if err := runMachine(m, movie); err != nil {
+			log.Fatal(err)
+		}
+	case "vnc":
+		m, movie, err := newMachine(romName, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// The framebuffer is in hires pixels, half a lores pixel
+		server := vnc.NewServer(romName, palettes[0], int(*scale)/2)
+		l, err := net.Listen("tcp", *vncAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Serving VNC viewers on %s", l.Addr())
+		go server.Serve(l)
+		clock := c8.NewRealTimeClock()
+		defer clock.Stop()
+		m.Display, m.Keypad, m.Audio, m.Clock = server, server, server, clock
+		if err := runMachine(m, movie); err != nil {
+			log.Fatal(err)
+		}
+	case "gym":
+		gymCfg.ROM = romName
+		if err := runGym(gymCfg, palettes[0]); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown frontend %q", *frontend)
+	}
+}
+
+// runTerminal plays a ROM on the terminal of stdin and stdout. A terminal
+// is put in raw mode, so that keys arrive as soon as they are typed, and
+// restored before returning.
+func runTerminal(romName string, opts machineOptions) error {
+	m, movie, err := newMachine(romName, opts)
+	if err != nil {
+		return err
+	}
+	var in io.Reader = os.Stdin
+	var out io.Writer = os.Stdout
+	if fd := int(os.Stdin.Fd()); xterminal.IsTerminal(fd) {
+		state, err := xterminal.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer xterminal.Restore(fd, state)
+		// Ctrl-C is read as a byte rather than interrupting
+		in, out = interruptReader{os.Stdin, m}, crlfWriter{os.Stdout}
+	}
+	clock := c8.NewRealTimeClock()
+	defer clock.Stop()
+	m.Display = terminal.NewDisplay(out)
+	m.Keypad = terminal.NewKeypad(in)
+	m.Audio = terminal.NewAudio(out)
+	m.Clock = clock
+	return runMachine(m, movie)
+}
+
+// runMachine runs a machine until it stops, or until the program is
+// interrupted, and then finishes its movie, so that Ctrl-C does not lose
+// a recording
+func runMachine(m *c8.Machine, movie *movieSession) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	done := make(chan error, 1)
+	go func() { done <- m.Run() }()
+	var err error
+	select {
+	case err = <-done:
+	case <-interrupt:
+		m.Stop()
+		err = <-done
+	}
+	if err != nil {
+		return err
+	}
+	return movie.finish()
+}
+
+// interruptReader stops a machine when Ctrl-C is read from a terminal in
+// raw mode
+type interruptReader struct {
+	r io.Reader
+	m *c8.Machine
+}
+
+func (i interruptReader) Read(p []byte) (int, error) {
+	n, err := i.r.Read(p)
+	if bytes.IndexByte(p[:n], 3) >= 0 {
+		i.m.Stop()
+	}
+	return n, err
+}
+
+// crlfWriter ends the lines written on a terminal in raw mode, which does
+// not go back to the first column on its own
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(bytes.Replace(p, []byte("\n"), []byte("\r\n"), -1)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// gymOptions are the flags of the gym frontend
+type gymOptions struct {
+	gym.Config
+	envs int
+	rgb  bool
+}
+
+// runGym serves gym environments of a ROM over stdin and stdout, see
+// gym.Serve. Nothing else is printed on stdout, the logs go to stderr.
+func runGym(opts gymOptions, palette c8.Palette) error {
+	if opts.envs < 1 {
+		return fmt.Errorf("%d environments, want at least 1", opts.envs)
+	}
+	v, err := gym.NewVec(opts.envs, opts.Config)
+	if err != nil {
+		return err
+	}
+	var rgb *c8.Palette
+	if opts.rgb {
+		rgb = &palette
+	}
+	return gym.Serve(v, rgb, os.Stdin, os.Stdout)
+}
+
+// machineOptions are the flags every machine is created with
+type machineOptions struct {
+	trace        bool
+	seed         uint64
+	cheatDir     string
+	achievements *achievements
+	script       string
+	netplay      netplayOptions
+	record       string // Movie files of the ROM given on the command line
+	replay       string
+}
+
+// defaultCheatDir returns where cheats are kept when -cheats is not given
+func defaultCheatDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".chip8", "cheats")
+}
+
+// readROM loads a ROM file into a machine, returning its size
+func readROM(m *c8.Machine, filename string) (int, error) {
+	rom, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	return len(rom), m.LoadROM(bytes.NewReader(rom))
+}
+
+// newMachine reads a ROM into a new machine and attaches everything the
+// flags ask for. The movie is opened first and started last, see openMovie.
+func newMachine(romName string, opts machineOptions) (*c8.Machine, *movieSession, error) {
+	// The peers of netplay must run with the same input, that of the keypads
+	if opts.netplay.enabled() && (opts.script != "" || api != nil || spectators != nil) {
+		return nil, nil, fmt.Errorf("netplay cannot run with -script, -http or -web, which drive the machine of one player only")
+	}
+	m := c8.NewMachine()
+	size, err := readROM(m, romName)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("File is %d bytes", size)
+	if info := m.Info(); info != nil {
+		log.Printf("ROM is %s for %s", info.Title, info.Platform)
+	}
+	if d := m.Detection(); d != nil {
+		log.Printf("ROM is not in the database, guessing %s with %.0f%% confidence: %s",
+			d.Platform.Name, 100*d.Confidence, strings.Join(d.Reasons, ", "))
+	}
+	if opts.trace {
+		m.Trace = os.Stdout
+	}
+	if opts.seed != 0 {
+		m.SetSeed(opts.seed)
+	}
+	movie, err := openMovie(m, opts.record, opts.replay)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Seed is %d", m.Seed())
+	// Cheats are not part of movies, nor of the machine of the other player
+	if opts.record == "" && opts.replay == "" && !opts.netplay.enabled() {
+		if m.Cheats, err = readCheats(opts.cheatDir, m.ROMHash()); err != nil {
+			return nil, nil, err
+		}
+	}
+	opts.achievements.track(m)
+	if opts.script != "" {
+		if err := attachScript(m, opts.script); err != nil {
+			return nil, nil, err
+		}
+	}
+	if api != nil {
+		api.Attach(m)
+	}
+	if spectators != nil {
+		spectators.Attach(m)
+	}
+	if opts.netplay.enabled() {
+		if err := opts.netplay.connect(m, romName); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := movie.start(); err != nil {
+		return nil, nil, err
+	}
+	return m, movie, nil
+}
+
+// startAPI serves the HTTP control API. Only the window can load other
+// ROMs, the other frontends run the ROM they were started with.
+func startAPI(addr, frontend string, palette c8.Palette) {
+	load := func(filename string) error {
+		if prog == nil {
+			return fmt.Errorf("the %s frontend cannot load ROMs", frontend)
+		}
+		return prog.LoadROM(filename)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	api = control.NewServer(listener.Addr().String(), load, palette)
+	log.Printf("HTTP control API on http://%s", listener.Addr())
+	go func() {
+		log.Fatal(http.Serve(listener, api))
+	}()
+}
+
+// startWeb serves the page to watch and play from browsers, those opening
+// it with token being in control
+func startWeb(addr, token string, palette c8.Palette) {
+	if token == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			log.Fatal(err)
+		}
+		token = hex.EncodeToString(b)
+	}
+	spectators = web.NewServer(palette, token)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Watch on http://%s/ and play on http://%s/?token=%s", listener.Addr(), listener.Addr(), token)
+	go func() {
+		log.Fatal(http.Serve(listener, spectators))
+	}()
+}
 
-	go c8.RunROM()
+// attachScript runs a script on the machine, drawing on the window if
+// there is one
+func attachScript(m *c8.Machine, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	s, err := script.Load(filename, file)
+	if err != nil {
+		return err
+	}
+	var overlay c8.Overlay
+	if prog != nil {
+		overlay = prog
+	}
+	return s.Attach(m, overlay, os.Stdout)
+}
 
-	prog, err = c8.NewProg()
+// readCheats reads the cheats saved for a ROM, if there are any
+func readCheats(dir, romHash string) (*c8.Cheats, error) {
+	if dir == "" {
+		return &c8.Cheats{}, nil
+	}
+	filename := window.CheatFile(dir, romHash)
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return &c8.Cheats{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	cheats, err := c8.ReadCheats(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if n := len(cheats.List()); n > 0 {
+		log.Printf("%d cheats from %s", n, filename)
+	}
+	return cheats, nil
+}
+
+// runWindow plays romName in the window, or starts with the launcher
+// listing romDirs when romName is empty
+func runWindow(romName string, romDirs []string, opts machineOptions, scale float64, fullscreen bool) {
+	audio, err := window.NewAudio()
+	if err != nil {
+		log.Fatal(err)
+	}
+	launcher, err := window.NewLauncher(romDirs...)
 	if err != nil {
 		log.Fatal(err)
 	}
+	// Only the ROM given on the command line is recorded or replayed
+	launched := opts
+	launched.record, launched.replay = "", ""
+	prog.SetLauncher(launcher, func(filename string) (*c8.Machine, error) {
+		m, _, err := newMachine(filename, launched)
+		if err != nil {
+			return nil, err
+		}
+		m.Audio = audio
+		return m, nil
+	})
+
+	title := "Chip 8"
+	var movie *movieSession
+	if romName != "" {
+		var m *c8.Machine
+		m, movie, err = newMachine(romName, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m.Audio = audio
+		prog.Start(m, romName)
+		title += " - " + romName
+	}
 
-	err = ebiten.Run(update, c8.BoardWidth, c8.BoardHeight, 1, "Chip 8 - "+os.Args[1])
+	width, height := window.WindowSize(scale)
+	if fullscreen {
+		width, height = ebiten.ScreenSizeInFullscreen()
+		ebiten.SetFullscreen(true)
+	}
+	err = ebiten.Run(update, width, height, 1, title)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := movie.finish(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func update(screen *ebiten.Image) error {
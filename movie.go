@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+)
+
+// movieSession records or replays the movie files given on the command
+// line. A nil session does neither.
+type movieSession struct {
+	m        *c8.Machine
+	recorder *c8.Recorder
+	record   string
+	movie    *c8.Movie // Replayed
+	player   *c8.Player
+}
+
+// openMovie reads the movie to replay on a machine which has just read its
+// ROM, and gives the machine the seed and quirks of the movie. It is called
+// before anything else is attached to the machine, so that scripts and the
+// control API start from the machine the movie starts from. Either file is
+// optional.
+func openMovie(m *c8.Machine, record, replay string) (*movieSession, error) {
+	if record == "" && replay == "" {
+		return nil, nil
+	}
+	s := &movieSession{m: m, record: record}
+	if replay != "" {
+		mv, err := readMovie(replay)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", replay, err)
+		}
+		if err := mv.Prepare(m); err != nil {
+			return nil, fmt.Errorf("%s: %v", replay, err)
+		}
+		s.movie = mv
+	}
+	return s, nil
+}
+
+// start replays and records the movie. It is called once everything else
+// is attached, so that the keys of the movie replace all others and the
+// recording has the keys added by scripts, the control API and browsers.
+func (s *movieSession) start() error {
+	if s == nil {
+		return nil
+	}
+	if s.movie != nil {
+		var err error
+		if s.player, err = c8.NewPlayer(s.m, s.movie); err != nil {
+			return err
+		}
+		fmt.Printf("Replaying %d frames with seed %d\n", s.movie.Frames, s.movie.Seed)
+	}
+	if s.record != "" {
+		// After the player, which sets the seed and quirks it records
+		s.recorder = c8.NewRecorder(s.m)
+	}
+	return nil
+}
+
+// stopAfterReplay makes the machine stop once the whole movie has played,
+// rather than going on without keys
+func (s *movieSession) stopAfterReplay() {
+	if s == nil || s.player == nil {
+		return
+	}
+	s.m.AddFrameHook(func() error {
+		if s.player.Done() {
+			return c8.ErrStopped
+		}
+		return nil
+	})
+}
+
+// finish stops the machine and saves the recording
+func (s *movieSession) finish() error {
+	if s == nil {
+		return nil
+	}
+	s.m.Stop()
+	if s.player != nil && s.player.Done() {
+		fmt.Printf("Replay of %d frames matches the recording\n", s.movie.Frames)
+	}
+	if s.recorder == nil {
+		return nil
+	}
+	file, err := os.Create(s.record)
+	if err != nil {
+		return err
+	}
+	mv := s.recorder.Movie(s.m)
+	write := mv.Write
+	if isTimeline(s.record) {
+		write = mv.WriteTimeline
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	fmt.Printf("Recorded %d frames into %s\n", mv.Frames, s.record)
+	return file.Close()
+}
+
+// isTimeline reports whether a movie file is saved as an editable text
+// timeline rather than in the binary format
+func isTimeline(filename string) bool {
+	return strings.HasSuffix(filename, ".txt")
+}
+
+// readMovie reads a movie in either format
+func readMovie(filename string) (*c8.Movie, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mv, err := c8.ReadMovie(file)
+	if err != c8.ErrNotMovie {
+		return mv, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return c8.ReadTimeline(file)
+}
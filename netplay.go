@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"github.com/erdincmutlu/CHIP-8/c8/netplay"
+)
+
+// netplayOptions are the flags of netplay, which is off unless one of
+// host, join or loopback is given
+type netplayOptions struct {
+	netplay.Config
+	host     string // Address player 1 listens on
+	join     string // Address of player 1, for player 2
+	loopback bool
+	link     netplay.Link // Simulated with loopback
+}
+
+func (opts *netplayOptions) enabled() bool {
+	return opts.host != "" || opts.join != "" || opts.loopback
+}
+
+// connect makes a machine which has just read its ROM play with the other
+// player. With loopback, the other player is a second machine running the
+// same ROM in the background, whose keypad nobody holds.
+func (opts *netplayOptions) connect(m *c8.Machine, romName string) error {
+	if opts.loopback {
+		peer := c8.NewMachine()
+		if _, err := readROM(peer, romName); err != nil {
+			return err
+		}
+		_, session, err := netplay.Loopback(m, peer, opts.Config, opts.link)
+		if err != nil {
+			return err
+		}
+		clock := c8.NewRealTimeClock()
+		peer.Clock = clock
+		go func() {
+			defer clock.Stop()
+			err := peer.Run()
+			log.Printf("Player 2 stopped: %v, %+v", err, session.Stats())
+		}()
+		return nil
+	}
+
+	cfg := opts.Config
+	var conn net.PacketConn
+	var peer net.Addr
+	var err error
+	if opts.host != "" {
+		cfg.Player = 1
+		if conn, err = net.ListenPacket("udp", opts.host); err != nil {
+			return err
+		}
+		log.Printf("Waiting for player 2 on %s", conn.LocalAddr())
+	} else {
+		cfg.Player = 2
+		if peer, err = net.ResolveUDPAddr("udp", opts.join); err != nil {
+			return err
+		}
+		if conn, err = net.ListenPacket("udp", ":0"); err != nil {
+			return err
+		}
+	}
+	session, err := netplay.Connect(m, conn, peer, cfg)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	fmt.Printf("Playing as player %d\n", cfg.Player)
+	m.AddFrameHook(func() error {
+		// Once a minute
+		if frame := m.State().Frames; frame%3600 == 0 {
+			log.Printf("Netplay after %d frames: %+v", frame, session.Stats())
+		}
+		return nil
+	})
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/erdincmutlu/CHIP-8/c8/sshplay"
+)
+
+// serveSSH runs the serve-ssh command, an SSH server where every
+// connection plays the ROMs of the launcher on a machine of its own
+func serveSSH(args []string) error {
+	flags := flag.NewFlagSet("serve-ssh", flag.ExitOnError)
+	addr := flags.String("addr", ":2222", "address to listen on")
+	hostKey := flags.String("host-key", defaultHostKey(), "private key of the server, generated when missing")
+	configFile := flags.String("config", "", "JSON config file")
+	flags.Parse(args)
+
+	cfg, err := readConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if err := cfg.loadDatabases(); err != nil {
+		return err
+	}
+	key, err := sshplay.LoadHostKey(*hostKey)
+	if err != nil {
+		return err
+	}
+	s, err := sshplay.NewServer(key, cfg.romDirs()...)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Serving the ROMs over SSH on %s", l.Addr())
+	return s.Serve(l)
+}
+
+// defaultHostKey returns where the key of the SSH server is kept when
+// -host-key is not given
+func defaultHostKey() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "ssh_host_key"
+	}
+	return filepath.Join(home, ".chip8", "ssh_host_key")
+}
@@ -0,0 +1,107 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command wasm is the emulator built for browsers, run by the page
+// index.html next to it. It is built from the root of the repository with
+//
+//	GOOS=js GOARCH=wasm go build -o wasm/chip8.wasm ./wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" wasm
+//
+// wasm_exec.js being in misc/wasm before Go 1.24, after which the wasm
+// directory can be served as is. The page plays the ROM picked with its
+// file input, or the one at the URL given with ?rom=URL, and keeps the save
+// states in localStorage.
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+	"time"
+
+	"github.com/erdincmutlu/CHIP-8/c8"
+	"github.com/erdincmutlu/CHIP-8/c8/browser"
+)
+
+// localStorage keeps the save states in the storage of the browser
+type localStorage struct {
+	v js.Value
+}
+
+func (s localStorage) Get(key string) (string, bool) {
+	v := s.v.Call("getItem", key)
+	if v.Type() != js.TypeString {
+		return "", false
+	}
+	return v.String(), true
+}
+
+func (s localStorage) Set(key, value string) (err error) {
+	// setItem throws when the storage is full
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	s.v.Call("setItem", key, value)
+	return nil
+}
+
+// errorValue is the message of an error for the page, null when there is
+// none
+func errorValue(err error) interface{} {
+	if err == nil {
+		return nil
+	}
+	return err.Error()
+}
+
+func main() {
+	e := browser.NewEmulator(c8.Palettes[0], localStorage{js.Global().Get("localStorage")})
+	pixels := js.Global().Get("Uint8Array").New(4 * browser.Width * browser.Height)
+
+	funcs := map[string]func(args []js.Value) interface{}{
+		// load(name, rom) plays a ROM given as a Uint8Array
+		"load": func(args []js.Value) interface{} {
+			rom := make([]byte, args[1].Get("length").Int())
+			js.CopyBytesToGo(rom, args[1])
+			return errorValue(e.Load(args[0].String(), rom))
+		},
+		// frame(elapsed) runs the frames due after elapsed milliseconds,
+		// returning the pixels when they changed
+		"frame": func(args []js.Value) interface{} {
+			err := e.Advance(time.Duration(args[0].Float() * float64(time.Millisecond)))
+			result := map[string]interface{}{"beep": e.Beeping(), "error": errorValue(err), "pixels": nil}
+			if p, changed := e.Pixels(); changed {
+				js.CopyBytesToJS(pixels, p)
+				result["pixels"] = pixels
+			}
+			return result
+		},
+		// key(key, down) holds or releases a key of the hex keypad
+		"key": func(args []js.Value) interface{} {
+			e.SetKey(args[0].Int(), args[1].Bool())
+			return nil
+		},
+		"save": func(args []js.Value) interface{} {
+			return errorValue(e.Save())
+		},
+		"restore": func(args []js.Value) interface{} {
+			return errorValue(e.Restore())
+		},
+	}
+
+	api := js.Global().Get("Object").New()
+	for name, f := range funcs {
+		f := f
+		api.Set(name, js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return f(args)
+		}))
+	}
+	api.Set("width", browser.Width)
+	api.Set("height", browser.Height)
+	js.Global().Set("chip8", api)
+	js.Global().Call("chip8Ready")
+
+	// The page calls the functions until it is closed
+	select {}
+}